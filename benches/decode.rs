@@ -0,0 +1,73 @@
+//! 解码性能基准
+//!
+//! 运行：cargo bench --bench decode
+
+use std::hint::black_box;
+use std::time::Instant;
+use tdx_rust::protocol::*;
+
+/// 读取测试数据中的响应帧
+fn load_response(name: &str) -> Vec<u8> {
+    let path = format!("tdx-test/test-data/{}.json", name);
+    let content = std::fs::read_to_string(&path).expect("读取测试数据失败");
+    let value: serde_json::Value = serde_json::from_str(&content).expect("解析测试数据失败");
+    hex::decode(value["response"].as_str().unwrap().replace(' ', "")).unwrap()
+}
+
+/// 构造800根日K线的响应数据
+fn kline_data() -> Vec<u8> {
+    let mut data = 800u16.to_le_bytes().to_vec();
+    for i in 0..800u32 {
+        data.extend_from_slice(&(20200101 + i).to_le_bytes());
+        for diff in [10000 + i as i32, 50, 120, -80] {
+            data.extend_from_slice(&encode_varint(diff));
+        }
+        data.extend_from_slice(&[0x00, 0x40, 0x9c, 0x45]); // 成交量
+        data.extend_from_slice(&[0x00, 0x24, 0x74, 0x49]); // 成交额
+    }
+    data
+}
+
+/// 运行基准并输出每次耗时
+fn bench<F: FnMut()>(name: &str, iterations: u32, mut f: F) {
+    for _ in 0..iterations / 10 {
+        f();
+    }
+    let start = Instant::now();
+    for _ in 0..iterations {
+        f();
+    }
+    let per_iter = start.elapsed().as_nanos() / iterations as u128;
+    println!("{:<32} {:>10} ns/iter", name, per_iter);
+}
+
+fn main() {
+    let quote_frame = load_response("quote");
+    let quote_data = ResponseFrame::decode(&quote_frame).unwrap().data;
+    let kline = kline_data();
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+
+    bench("ResponseFrame::decode", 100_000, || {
+        black_box(ResponseFrame::decode(black_box(&quote_frame)).unwrap());
+    });
+
+    bench("Quote::decode_response", 100_000, || {
+        black_box(Quote::decode_response(black_box(&quote_data)).unwrap());
+    });
+
+    let mut quotes = Vec::new();
+    bench("Quote::decode_response_into", 100_000, || {
+        Quote::decode_response_into(black_box(&quote_data), &mut quotes).unwrap();
+        black_box(&quotes);
+    });
+
+    bench("KlineMsg::decode_response", 2_000, || {
+        black_box(KlineMsg::decode_response(black_box(&kline), cache).unwrap());
+    });
+
+    let mut list = Vec::new();
+    bench("KlineMsg::decode_response_into", 2_000, || {
+        KlineMsg::decode_response_into(black_box(&kline), cache, &mut list).unwrap();
+        black_box(&list);
+    });
+}
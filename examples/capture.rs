@@ -0,0 +1,234 @@
+//! 从真实服务器重新采集测试数据（tdx-test/test-data/*.json）
+//!
+//! 为避免误连服务器，需设置环境变量 TDX_CAPTURE_HOST 才会执行：
+//!
+//! ```text
+//! TDX_CAPTURE_HOST=124.71.187.122 cargo run --example capture
+//! ```
+//!
+//! 每个请求都用消息构造函数重新生成，并先与文件中已有的请求帧比对（忽略消息ID），
+//! 不一致时报错退出（说明编码逻辑或测试数据需要人工确认）。
+//! 写入的响应帧使用测试数据中的消息ID，以便测试用固定的消息ID构造请求。
+//! 比对通过后更新响应帧、数据域和解码摘要，其余说明字段保持不变
+
+use serde_json::Value;
+use std::path::{Path, PathBuf};
+use tdx_rust::*;
+
+const DATA_DIR: &str = "tdx-test/test-data";
+const SUMMARY_LEN: usize = 500;
+
+type BoxError = Box<dyn std::error::Error>;
+
+/// 已发送的请求帧和收到的响应帧
+struct Captured {
+    request: Vec<u8>,
+    response: Vec<u8>,
+}
+
+/// 取出最近一次请求的发送帧和接收帧
+fn last_exchange(client: &Client) -> Result<Captured, BoxError> {
+    let frames = client.raw_frames();
+    let n = frames.len();
+    if n < 2 || !frames[n - 2].sent || frames[n - 1].sent {
+        return Err("原始帧捕获中没有完整的请求/响应".into());
+    }
+    Ok(Captured {
+        request: frames[n - 2].data.clone(),
+        response: frames[n - 1].data.clone(),
+    })
+}
+
+/// 比对请求帧并写入新的响应
+fn update_fixture(name: &str, captured: &Captured, summary: String) -> Result<(), BoxError> {
+    let path: PathBuf = Path::new(DATA_DIR).join(format!("{}.json", name));
+    let mut fixture: Value = serde_json::from_str(&std::fs::read_to_string(&path)?)?;
+
+    // 客户端会重新分配消息ID，比对和写入时统一使用测试数据中的消息ID
+    let stored = hex::decode(
+        fixture["request"]
+            .as_str()
+            .unwrap_or_default()
+            .replace(' ', ""),
+    )?;
+    if stored.len() < 12 {
+        return Err(format!("{}: 测试数据中的请求帧不完整", name).into());
+    }
+    if captured.request.len() < 12 || captured.response.len() < 16 {
+        return Err(format!("{}: 捕获的请求帧或响应帧不完整", name).into());
+    }
+    let mut request = captured.request.clone();
+    request[1..5].copy_from_slice(&stored[1..5]);
+    if stored != request {
+        return Err(format!(
+            "{}: 请求帧与测试数据不一致\n  文件: {}\n  生成: {}",
+            name,
+            hex::encode(&stored),
+            hex::encode(&request)
+        )
+        .into());
+    }
+    let mut captured_response = captured.response.clone();
+    captured_response[5..9].copy_from_slice(&stored[1..5]);
+
+    let response = ResponseFrame::decode(&captured_response)?;
+    let mut summary = summary;
+    if summary.chars().count() > SUMMARY_LEN {
+        summary = summary.chars().take(SUMMARY_LEN).collect::<String>() + "...";
+    }
+
+    fixture["request_data"] = Value::String(hex::encode(&captured.request[12..]));
+    fixture["response"] = Value::String(hex::encode(&captured_response));
+    fixture["response_data"] = Value::String(hex::encode(response.data()));
+    fixture["summary"] = Value::String(summary);
+
+    std::fs::write(&path, serde_json::to_string_pretty(&fixture)? + "\n")?;
+    println!("已更新 {}", path.display());
+    Ok(())
+}
+
+/// 写入新的K线测试数据（文件不存在时创建，存在时覆盖）
+fn write_kline_fixture(name: &str, description: &str, captured: &Captured) -> Result<(), BoxError> {
+    if captured.request.len() < 12 || captured.response.len() < 16 {
+        return Err(format!("{}: 捕获的请求帧或响应帧不完整", name).into());
+    }
+    let response = ResponseFrame::decode(&captured.response)?;
+    let fixture = serde_json::json!({
+        "name": "K线数据",
+        "type": "TypeKline",
+        "type_value": "0x052D",
+        "description": description,
+        "request": hex::encode(&captured.request),
+        "request_data": hex::encode(&captured.request[12..]),
+        "response": hex::encode(&captured.response),
+        "response_data": hex::encode(response.data()),
+        "params": {},
+    });
+    let path: PathBuf = Path::new(DATA_DIR).join(format!("{}.json", name));
+    std::fs::write(&path, serde_json::to_string_pretty(&fixture)? + "\n")?;
+    println!("已写入 {}", path.display());
+    Ok(())
+}
+
+#[tokio::main(flavor = "multi_thread")]
+async fn main() -> Result<(), BoxError> {
+    let host = match std::env::var("TDX_CAPTURE_HOST") {
+        Ok(host) => host,
+        Err(_) => {
+            println!("未设置 TDX_CAPTURE_HOST，跳过采集");
+            return Ok(());
+        }
+    };
+
+    let options = ClientOptions::default().with_raw_capture(4, 0);
+    let client = Client::connect_with(&host, options).await?;
+
+    // 握手在建立连接时完成，消息ID固定为1
+    let connect = last_exchange(&client)?;
+    let info = client.server_info().map(|i| i.info).unwrap_or_default();
+    update_fixture("connect", &connect, info)?;
+
+    client.send_frame(Heartbeat::request(2)).await?;
+    update_fixture("heartbeat", &last_exchange(&client)?, String::new())?;
+
+    let resp = client.send_frame(Count::request(3, Exchange::SZ)).await?;
+    let count = Count::decode_response(resp.data())?;
+    update_fixture("count", &last_exchange(&client)?, format!("{}", count))?;
+
+    let resp = client.send_frame(Code::request(4, Exchange::SZ, 0)).await?;
+    let codes = Code::decode_response(resp.data())?;
+    update_fixture(
+        "code",
+        &last_exchange(&client)?,
+        format!("{:?}", codes.codes),
+    )?;
+
+    let codes = ["sz000001".to_string(), "sh600008".to_string()];
+    let resp = client.send_frame(Quote::request(5, &codes)?).await?;
+    let quotes = Quote::decode_response(resp.data())?;
+    update_fixture("quote", &last_exchange(&client)?, format!("{:?}", quotes))?;
+
+    let resp = client
+        .send_frame(KlineMsg::request(6, KlineType::Day, "sz000001", 0, 10)?)
+        .await?;
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+    let klines = KlineMsg::decode_response(resp.data(), cache)?;
+    update_fixture("kline", &last_exchange(&client)?, format!("{:?}", klines))?;
+
+    let today = chrono::Local::now().format("%Y%m%d").to_string();
+    let resp = client
+        .send_frame(MinuteMsg::request(7, "sz000001")?)
+        .await?;
+    let minute = MinuteMsg::decode_response(resp.data(), &today, "sz000001")?;
+    update_fixture("minute", &last_exchange(&client)?, format!("{:?}", minute))?;
+
+    let resp = client
+        .send_frame(TradeMsg::request(8, "sz000001", 0, 10)?)
+        .await?;
+    let cache = TradeCache {
+        date: today.clone(),
+        code: "sz000001".to_string(),
+    };
+    let trades = TradeMsg::decode_response(resp.data(), &cache)?;
+    update_fixture("trade", &last_exchange(&client)?, format!("{:?}", trades))?;
+
+    let resp = client
+        .send_frame(HistoryMinuteMsg::request(9, "20240101", "sz000001")?)
+        .await?;
+    let minute = HistoryMinuteMsg::decode_response(resp.data(), "20240101", "sz000001")?;
+    update_fixture(
+        "history_minute",
+        &last_exchange(&client)?,
+        format!("{:?}", minute),
+    )?;
+
+    let resp = client
+        .send_frame(HistoryTradeMsg::request(10, "20240101", "sz000001", 0, 10)?)
+        .await?;
+    let cache = TradeCache {
+        date: "20240101".to_string(),
+        code: "sz000001".to_string(),
+    };
+    let trades = HistoryTradeMsg::decode_response(resp.data(), &cache)?;
+    update_fixture(
+        "history_trade",
+        &last_exchange(&client)?,
+        format!("{:?}", trades),
+    )?;
+
+    let resp = client
+        .send_frame(CallAuctionMsg::request(11, "sz000001")?)
+        .await?;
+    let auction = CallAuctionMsg::decode_response(resp.data())?;
+    update_fixture(
+        "call_auction",
+        &last_exchange(&client)?,
+        format!("{:?}", auction),
+    )?;
+
+    let resp = client.send_frame(GbbqMsg::request(12, "sz000001")?).await?;
+    let gbbq = GbbqMsg::decode_response(resp.data())?;
+    update_fixture("gbbq", &last_exchange(&client)?, format!("{:?}", gbbq))?;
+
+    // 2024年春节前后的日K线和周K线，用于核对本地周K线合并规则（tests/kline_test.rs）。
+    // 一次取最近800根，覆盖到2024年初
+    for (name, kline_type, description) in [
+        (
+            "kline_day_cny2024",
+            KlineType::Day,
+            "平安银行日K线（最近800根），覆盖2024年春节",
+        ),
+        (
+            "kline_week_cny2024",
+            KlineType::Week,
+            "平安银行周K线（最近800根），覆盖2024年春节",
+        ),
+    ] {
+        client
+            .send_frame(KlineMsg::request(13, kline_type, "sz000001", 0, 800)?)
+            .await?;
+        write_kline_fixture(name, description, &last_exchange(&client)?)?;
+    }
+
+    Ok(())
+}
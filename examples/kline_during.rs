@@ -1,5 +1,5 @@
 //! 使用 get_kline_all_during 获取指定时间范围的 K 线数据示例
-//! 查询 000001 在 2026-01-01 00:00:00 到 2026-01-10 00:00:00 的日 K 线数据
+//! 查询 sz000001 在 2026-01-01 00:00:00 到 2026-01-10 00:00:00 的日 K 线数据
 
 use tdx_rust::*;
 
@@ -9,7 +9,7 @@ async fn main() -> Result<(), ClientError> {
     let client = dial("124.71.187.122").await?;
     println!("连接成功！");
 
-    let code = "000001";
+    let code = "sz000001";
 
     // 2026-01-01 00:00:00 Beijing Time (UTC+8) -> 1767196800
     // 2026-01-10 00:00:00 Beijing Time (UTC+8) -> 1767974400
@@ -0,0 +1,177 @@
+//! K线本地文件缓存
+
+use crate::client::{Client, ClientError};
+use crate::protocol::*;
+use log::warn;
+use std::io;
+use std::path::PathBuf;
+
+/// K线本地文件缓存
+///
+/// 已收盘的K线保存在本地文件中，只有缺失的最新部分才向服务器请求。
+/// 当前交易时段（或当前周/月）尚未收盘的K线不会写入缓存。
+pub struct KlineFileCache<'a> {
+    client: &'a Client,
+    dir: PathBuf,
+}
+
+impl<'a> KlineFileCache<'a> {
+    /// 创建缓存，`dir` 为缓存文件所在目录
+    pub fn new(client: &'a Client, dir: impl Into<PathBuf>) -> Self {
+        Self {
+            client,
+            dir: dir.into(),
+        }
+    }
+
+    /// 缓存文件路径
+    fn path(&self, kline_type: KlineType, code: &str) -> PathBuf {
+        self.dir.join(format!("{}_{}.bin", code, kline_type as u8))
+    }
+
+    /// 读取缓存的K线，文件不存在或已损坏时返回空列表
+    async fn load(&self, kline_type: KlineType, code: &str) -> Result<Vec<Kline>, ClientError> {
+        let path = self.path(kline_type, code);
+        match tokio::fs::read(&path).await {
+            Ok(data) => match decode_klines(&data) {
+                Ok(list) => Ok(list),
+                Err(e) => {
+                    warn!("K线缓存文件损坏，将重新下载 {:?}: {}", path, e);
+                    Ok(Vec::new())
+                }
+            },
+            Err(e) if e.kind() == io::ErrorKind::NotFound => Ok(Vec::new()),
+            Err(e) => Err(ClientError::Cache(e)),
+        }
+    }
+
+    /// 保存K线到缓存文件
+    async fn save(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        list: &[Kline],
+    ) -> Result<(), ClientError> {
+        tokio::fs::create_dir_all(&self.dir)
+            .await
+            .map_err(ClientError::Cache)?;
+        tokio::fs::write(self.path(kline_type, code), encode_klines(list))
+            .await
+            .map_err(ClientError::Cache)
+    }
+
+    /// 获取时间范围内的K线（优先读取缓存）
+    ///
+    /// start_time 和 end_time 均为 Unix 时间戳（秒），股票上市日期之前的K线不返回
+    pub async fn cached_kline(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        start_time: u64,
+        end_time: u64,
+    ) -> Result<KlineResponse, ClientError> {
+        let code = qualify_code(code)?;
+        // 股票上市日期之前没有有效K线
+        let start_time = match self.client.ipo_floor(&code).await {
+            Some(ipo_time) => start_time.max(ipo_time.max(0) as u64),
+            None => start_time,
+        };
+        let mut cached = self.load(kline_type, &code).await?;
+
+        // 只请求缓存之后的K线
+        let fetched = match cached.last() {
+            Some(last) => {
+                let last_time = last.time;
+                self.client
+                    .get_kline_all_util(kline_type, &code, |k| k.time > last_time)
+                    .await?
+            }
+            None => {
+                self.client
+                    .get_kline_all_util(kline_type, &code, |k| k.time as u64 >= start_time)
+                    .await?
+            }
+        };
+
+        // 未收盘的K线只返回、不缓存
+        let mut fetched = fetched.list;
+        let closed_len = fetched
+            .iter()
+            .position(|k| self.client.is_partial(kline_type, k))
+            .unwrap_or(fetched.len());
+        let partial = fetched.split_off(closed_len);
+
+        // 缓存未覆盖起始时间时，只补充缓存之前缺失的部分（上市晚于起始时间时服务器返回空页）
+        let head = match cached.first() {
+            Some(first) if first.time as u64 > start_time => {
+                let newer = fetched.len() + partial.len() + cached.len();
+                self.fetch_before(kline_type, &code, first.time, newer, start_time)
+                    .await?
+            }
+            _ => Vec::new(),
+        };
+
+        if !head.is_empty() || !fetched.is_empty() {
+            let mut list = head;
+            list.append(&mut cached);
+            list.extend(fetched);
+            cached = list;
+            self.save(kline_type, &code, &cached).await?;
+        }
+
+        cached.extend(partial);
+        cached.retain(|k| k.time as u64 >= start_time && k.time as u64 <= end_time);
+
+        let partial = cached
+            .last()
+            .map_or(false, |k| self.client.is_partial(kline_type, k));
+        Ok(KlineResponse {
+            // 拼接后可能超过 u16 上限，以 list 长度为准
+            count: u16::try_from(cached.len()).unwrap_or(u16::MAX),
+            list: cached,
+            partial,
+        })
+    }
+
+    /// 获取早于 `before` 的K线，直到覆盖 `start_time` 或没有更早的数据
+    ///
+    /// `newer` 为不早于 `before` 的K线数量，即从最新往前数的起始位置
+    async fn fetch_before(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        before: i64,
+        newer: usize,
+        start_time: u64,
+    ) -> Result<Vec<Kline>, ClientError> {
+        const BATCH_SIZE: u16 = 800;
+        let mut list = Vec::new();
+        let mut start = match u16::try_from(newer) {
+            Ok(start) => start,
+            Err(_) => return Ok(list),
+        };
+
+        loop {
+            let resp = self
+                .client
+                .get_kline(kline_type, code, start, BATCH_SIZE)
+                .await?;
+            let done = resp.list.len() < BATCH_SIZE as usize
+                || resp
+                    .list
+                    .first()
+                    .map_or(true, |k| k.time as u64 <= start_time);
+            merge_kline_page(&mut list, resp.list);
+            if done {
+                break;
+            }
+            start = match start.checked_add(BATCH_SIZE) {
+                Some(start) => start,
+                None => break,
+            };
+        }
+
+        list.retain(|k| k.time < before);
+        Ok(list)
+    }
+}
@@ -0,0 +1,78 @@
+//! 原始帧捕获（调试用）
+
+use std::collections::VecDeque;
+
+/// 原始帧捕获配置
+///
+/// 两个上限同时生效，为0表示不限制
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct RawCaptureConfig {
+    pub max_frames: usize, // 最多保留的帧数
+    pub max_bytes: usize,  // 最多保留的总字节数
+}
+
+/// 捕获的原始帧
+#[derive(Debug, Clone)]
+pub struct CapturedFrame {
+    pub sent: bool,    // true 为发送的请求帧，false 为接收的响应帧
+    pub data: Vec<u8>, // 完整的帧字节（响应帧为解压前的数据）
+}
+
+/// 原始帧环形缓冲区
+///
+/// 超出帧数或字节数上限时淘汰最旧的帧；单帧超过字节上限时不保留
+#[derive(Debug)]
+pub struct RawCapture {
+    config: RawCaptureConfig,
+    frames: VecDeque<CapturedFrame>,
+    bytes: usize,
+}
+
+impl RawCapture {
+    /// 创建缓冲区
+    pub fn new(config: RawCaptureConfig) -> Self {
+        Self {
+            config,
+            frames: VecDeque::new(),
+            bytes: 0,
+        }
+    }
+
+    /// 记录一帧
+    pub fn push(&mut self, sent: bool, data: &[u8]) {
+        if self.config.max_bytes > 0 && data.len() > self.config.max_bytes {
+            return;
+        }
+
+        self.frames.push_back(CapturedFrame {
+            sent,
+            data: data.to_vec(),
+        });
+        self.bytes += data.len();
+
+        while (self.config.max_frames > 0 && self.frames.len() > self.config.max_frames)
+            || (self.config.max_bytes > 0 && self.bytes > self.config.max_bytes)
+        {
+            match self.frames.pop_front() {
+                Some(frame) => self.bytes -= frame.data.len(),
+                None => break,
+            }
+        }
+    }
+
+    /// 当前保留的帧（从旧到新）
+    pub fn frames(&self) -> Vec<CapturedFrame> {
+        self.frames.iter().cloned().collect()
+    }
+
+    /// 当前保留的总字节数
+    pub fn bytes(&self) -> usize {
+        self.bytes
+    }
+
+    /// 清空缓冲区
+    pub fn clear(&mut self) {
+        self.frames.clear();
+        self.bytes = 0;
+    }
+}
@@ -1,14 +1,20 @@
 //! TDX 客户端实现（异步）
 
+use crate::capture::{CapturedFrame, RawCapture, RawCaptureConfig};
+use crate::metrics::{Metrics, MetricsSnapshot};
 use crate::protocol::*;
-use chrono::{FixedOffset, Utc};
-use log::debug;
+use crate::sink::SinkError;
+use crate::transport::{connect_tcp, ConnectFuture, Connector, Transport};
+use chrono::{Datelike, FixedOffset, TimeZone, Utc};
+use log::{debug, warn};
+use rand::Rng;
+use std::collections::{HashMap, HashSet};
+use std::fmt;
 use std::io;
 use std::sync::atomic::{AtomicU32, Ordering};
 use std::sync::Arc;
-use std::time::Duration;
+use std::time::{Duration, Instant};
 use tokio::io::{AsyncReadExt, AsyncWriteExt};
-use tokio::net::TcpStream;
 use tokio::sync::Mutex;
 use tokio::time;
 
@@ -25,107 +31,821 @@ pub enum ClientError {
     Timeout,
     #[error("连接已关闭")]
     Disconnected,
+    #[error("会话已过期，需要重新握手")]
+    SessionExpired,
+    #[error("服务器返回错误响应: control=0x{0:02X}")]
+    ServerError(u8),
     #[error("不支持的市场: {0}")]
     UnsupportedMarket(String),
+    #[error("缓存错误: {0}")]
+    Cache(io::Error),
+    #[error("消息ID不匹配: 期望 {expected}, 得到 {actual}")]
+    MsgIdMismatch { expected: u32, actual: u32 },
+    #[error("写入失败: {0}")]
+    Sink(#[source] SinkError),
     #[error("其他错误: {0}")]
     Other(String),
 }
 
+/// 错误分类（用于重试策略）
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ErrorKind {
+    /// 连接错误：TCP 断开、超时等，可重连后重试
+    Connection,
+    /// 协议错误：服务器返回了异常的帧，不应重试
+    Protocol,
+    /// 解码错误：数据无法解析，通常是实现缺陷，应上报
+    Decode,
+    /// 其他错误（参数错误等）
+    Other,
+}
+
+impl ClientError {
+    /// 获取错误分类
+    ///
+    /// 底层原因可通过 `std::error::Error::source` 获取并 `downcast_ref`
+    pub fn kind(&self) -> ErrorKind {
+        match self {
+            ClientError::Io(_)
+            | ClientError::Timeout
+            | ClientError::Disconnected
+            | ClientError::SessionExpired => ErrorKind::Connection,
+            ClientError::Protocol(e) => match e {
+                FrameError::InvalidPrefix
+                | FrameError::UnknownMessageType(_)
+                | FrameError::FrameTooLarge { .. } => ErrorKind::Protocol,
+                FrameError::InsufficientData
+                | FrameError::LengthMismatch
+                | FrameError::DecompressionError(_) => ErrorKind::Decode,
+                FrameError::Io(_) => ErrorKind::Connection,
+            },
+            ClientError::Message(MessageError::InvalidCode(_) | MessageError::AmbiguousCode(_)) => {
+                ErrorKind::Other
+            }
+            ClientError::Message(MessageError::VersionMismatch { .. }) => ErrorKind::Protocol,
+            ClientError::Message(_) => ErrorKind::Decode,
+            ClientError::ServerError(_) | ClientError::MsgIdMismatch { .. } => ErrorKind::Protocol,
+            ClientError::UnsupportedMarket(_)
+            | ClientError::Cache(_)
+            | ClientError::Sink(_)
+            | ClientError::Other(_) => ErrorKind::Other,
+        }
+    }
+
+    /// 是否为连接错误（可重连后重试）
+    pub fn is_connection(&self) -> bool {
+        self.kind() == ErrorKind::Connection
+    }
+
+    /// 是否为协议错误（服务器返回异常帧）
+    pub fn is_protocol(&self) -> bool {
+        self.kind() == ErrorKind::Protocol
+    }
+
+    /// 是否为解码错误（数据无法解析）
+    pub fn is_decode(&self) -> bool {
+        self.kind() == ErrorKind::Decode
+    }
+}
+
+/// 请求回调，每个请求帧发送前调用
+#[derive(Clone)]
+pub struct RequestHook(pub Arc<dyn Fn(&RequestFrame) + Send + Sync>);
+
+impl fmt::Debug for RequestHook {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "RequestHook")
+    }
+}
+
+/// 服务器通知回调
+#[derive(Clone)]
+pub struct NoticeHandler(pub Arc<dyn Fn(&ServerNotice) + Send + Sync>);
+
+impl fmt::Debug for NoticeHandler {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "NoticeHandler")
+    }
+}
+
+/// 自定义解压函数，参数为压缩数据和帧头声明的解压长度
+#[derive(Clone)]
+pub struct Decompressor(pub Arc<dyn Fn(&[u8], u16) -> Result<Vec<u8>, FrameError> + Send + Sync>);
+
+impl fmt::Debug for Decompressor {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Decompressor")
+    }
+}
+
+/// 重新握手的触发条件，参数为请求失败的错误
+#[derive(Clone)]
+pub struct RehandshakePredicate(pub Arc<dyn Fn(&ClientError) -> bool + Send + Sync>);
+
+impl fmt::Debug for RehandshakePredicate {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "RehandshakePredicate")
+    }
+}
+
+/// 自动重新握手策略
+///
+/// 请求失败且满足条件时，重新连接并握手（按 [`ReconnectBackoff`] 重试），再重发失败的请求
+#[derive(Debug, Clone)]
+pub struct RehandshakePolicy {
+    /// 额外视为会话失效的响应 control 值（control 为 0x0C 且数据域为空的响应始终视为会话过期）
+    pub controls: Vec<u8>,
+    /// 触发条件，默认为会话过期和版本不匹配
+    pub predicate: RehandshakePredicate,
+    /// 单个请求最多重新握手的次数
+    pub max_retries: u32,
+}
+
+impl Default for RehandshakePolicy {
+    fn default() -> Self {
+        Self {
+            controls: Vec::new(),
+            predicate: RehandshakePredicate(Arc::new(|e| {
+                matches!(
+                    e,
+                    ClientError::SessionExpired
+                        | ClientError::Message(MessageError::VersionMismatch { .. })
+                )
+            })),
+            max_retries: 1,
+        }
+    }
+}
+
+/// 重连退避策略
+///
+/// 第 n 次重试（从0开始）前等待 `min(base × 2^n, max)`，再随机浮动 ±`jitter` 比例，
+/// 避免大量客户端在服务器故障恢复后同时重连
+#[derive(Debug, Clone, Copy)]
+pub struct ReconnectBackoff {
+    /// 初始等待时间
+    pub base: Duration,
+    /// 最大等待时间
+    pub max: Duration,
+    /// 随机浮动比例（0~1）
+    pub jitter: f64,
+    /// 最大尝试次数（0表示不限）
+    pub max_attempts: u32,
+}
+
+impl Default for ReconnectBackoff {
+    fn default() -> Self {
+        Self {
+            base: Duration::from_millis(500),
+            max: Duration::from_secs(30),
+            jitter: 0.2,
+            max_attempts: 5,
+        }
+    }
+}
+
+impl ReconnectBackoff {
+    /// 第 `attempt` 次重试（从0开始）前的等待时间
+    pub fn delay(&self, attempt: u32) -> Duration {
+        let exp = self.base.saturating_mul(1u32 << attempt.min(16));
+        let delay = exp.min(self.max);
+        let jitter = self.jitter.clamp(0.0, 1.0);
+        if jitter == 0.0 {
+            return delay;
+        }
+        let factor = 1.0 + rand::thread_rng().gen_range(-jitter..jitter);
+        delay.mul_f64(factor)
+    }
+}
+
+/// 客户端配置
+#[derive(Debug, Clone)]
+pub struct ClientOptions {
+    /// 读写超时
+    pub timeout: Duration,
+    /// 握手时上报的客户端标识，None 表示使用标准通达信客户端的默认值
+    pub identity: Option<ClientIdentity>,
+    /// 演练模式：不建立连接，请求只记录日志并返回空的成功响应
+    pub dry_run: bool,
+    /// 请求回调
+    pub request_hook: Option<RequestHook>,
+    /// 原始帧捕获，None 表示不捕获
+    pub raw_capture: Option<RawCaptureConfig>,
+    /// 最大帧长度，默认为协议上限 65535（见 [`DEFAULT_MAX_FRAME_SIZE`]）。
+    /// 服务器声明的长度超过该值时丢弃该帧并返回错误
+    pub max_frame_size: usize,
+    /// 服务器通知回调
+    pub notice_handler: Option<NoticeHandler>,
+    /// 握手失败后的重试次数，每次重试都会重新建立 TCP 连接
+    pub handshake_retries: u32,
+    /// 自定义解压函数，按帧头第10字节（标准服务器固定为0）选择，未注册时使用 zlib
+    pub decompressors: HashMap<u8, Decompressor>,
+    /// 重连退避策略
+    pub reconnect_backoff: ReconnectBackoff,
+    /// 运行指标的键前缀，None 表示不统计
+    pub metrics_prefix: Option<String>,
+    /// 自定义连接函数，None 表示使用 TCP 连接
+    pub connector: Option<Connector>,
+    /// 当前时间来源
+    pub time_source: TimeSource,
+    /// 休市日（YYYYMMDD，周末无需包含），用于判断周/月等K线是否已收盘
+    pub holidays: HashSet<u32>,
+    /// 批量发送（如 [`Pipeline`](crate::Pipeline)）时是否将所有请求帧合并为一次写入
+    pub coalesce_writes: bool,
+    /// TCP 保活的空闲时长和探测间隔，None 表示不开启
+    pub tcp_keepalive: Option<Duration>,
+    /// 自动重新握手策略，None 表示请求失败时直接返回错误
+    pub rehandshake: Option<RehandshakePolicy>,
+}
+
+impl Default for ClientOptions {
+    fn default() -> Self {
+        Self {
+            timeout: Duration::from_secs(10),
+            identity: None,
+            dry_run: false,
+            request_hook: None,
+            raw_capture: None,
+            max_frame_size: DEFAULT_MAX_FRAME_SIZE,
+            notice_handler: None,
+            handshake_retries: 0,
+            decompressors: HashMap::new(),
+            reconnect_backoff: ReconnectBackoff::default(),
+            metrics_prefix: None,
+            connector: None,
+            time_source: TimeSource::LocalClock,
+            holidays: HashSet::new(),
+            coalesce_writes: true,
+            tcp_keepalive: None,
+            rehandshake: None,
+        }
+    }
+}
+
+impl ClientOptions {
+    /// 设置超时时间
+    pub fn with_timeout(mut self, timeout: Duration) -> Self {
+        self.timeout = timeout;
+        self
+    }
+
+    /// 设置握手时上报的客户端版本号与标识
+    ///
+    /// 握手被拒绝并返回 [`MessageError::VersionMismatch`] 时，可按其中要求的版本号重新设置
+    pub fn with_client_identity(mut self, version: &str, id: &[u8]) -> Self {
+        self.identity = Some(ClientIdentity {
+            version: version.to_string(),
+            id: id.to_vec(),
+        });
+        self
+    }
+
+    /// 设置演练模式
+    pub fn with_dry_run(mut self, dry_run: bool) -> Self {
+        self.dry_run = dry_run;
+        self
+    }
+
+    /// 设置请求回调
+    pub fn with_request_hook<F>(mut self, hook: F) -> Self
+    where
+        F: Fn(&RequestFrame) + Send + Sync + 'static,
+    {
+        self.request_hook = Some(RequestHook(Arc::new(hook)));
+        self
+    }
+
+    /// 设置最大帧长度，只有小于 65535 时才会生效
+    pub fn with_max_frame_size(mut self, max_frame_size: usize) -> Self {
+        self.max_frame_size = max_frame_size;
+        self
+    }
+
+    /// 设置服务器通知回调
+    ///
+    /// 服务器推送的帧（消息类型未知且消息ID不是本客户端发出的）会被解码为
+    /// [`ServerNotice`] 交给回调，不会被当作当前请求的响应
+    pub fn with_notice_handler<F>(mut self, handler: F) -> Self
+    where
+        F: Fn(&ServerNotice) + Send + Sync + 'static,
+    {
+        self.notice_handler = Some(NoticeHandler(Arc::new(handler)));
+        self
+    }
+
+    /// 设置连接函数，替换默认的 TCP 连接
+    ///
+    /// 建立连接和重连时都会调用，可返回任意 [`Transport`]，
+    /// 如测试时用 `tokio::io::duplex` 创建的内存管道模拟服务器和读写故障
+    pub fn with_connector<F>(mut self, connector: F) -> Self
+    where
+        F: Fn(&str) -> ConnectFuture + Send + Sync + 'static,
+    {
+        self.connector = Some(Connector(Arc::new(connector)));
+        self
+    }
+
+    /// 设置当前时间来源，用于判断K线是否收盘和是否处于交易时段
+    pub fn with_time_source(mut self, time_source: TimeSource) -> Self {
+        self.time_source = time_source;
+        self
+    }
+
+    /// 设置休市日（YYYYMMDD），可由 [`holidays_from_trading_days`] 推导
+    pub fn with_holidays(mut self, holidays: HashSet<u32>) -> Self {
+        self.holidays = holidays;
+        self
+    }
+
+    /// 设置握手重试次数
+    ///
+    /// 仅在 TCP 连接成功但握手出现连接类错误（如读超时）时重试，
+    /// 重试前等待 200ms×重试序号；TCP 连接失败直接返回，以便尽快切换服务器
+    pub fn with_handshake_retries(mut self, retries: u32) -> Self {
+        self.handshake_retries = retries;
+        self
+    }
+
+    /// 注册自定义解压函数
+    ///
+    /// 协议没有公开的压缩算法标志，标准服务器只使用 zlib，帧头第10字节固定为0。
+    /// 该字节为 `flag` 且压缩长度与解压长度不同时，使用 `decompress` 代替 zlib，
+    /// 用于对接使用其他压缩算法（如 lz4）的中转服务器
+    pub fn with_decompressor<F>(mut self, flag: u8, decompress: F) -> Self
+    where
+        F: Fn(&[u8], u16) -> Result<Vec<u8>, FrameError> + Send + Sync + 'static,
+    {
+        self.decompressors
+            .insert(flag, Decompressor(Arc::new(decompress)));
+        self
+    }
+
+    /// 设置重连退避策略（指数增长，随机浮动 ±`jitter` 比例）
+    pub fn with_reconnect_backoff(mut self, base: Duration, max: Duration, jitter: f64) -> Self {
+        self.reconnect_backoff = ReconnectBackoff {
+            base,
+            max,
+            jitter,
+            ..self.reconnect_backoff
+        };
+        self
+    }
+
+    /// 开启运行指标统计（请求数、错误数、重连次数、字节数、往返耗时分布）
+    ///
+    /// 通过 [`Client::metrics`] 获取快照，或用 [`Client::metrics_json`] 以 `prefix`
+    /// 为键前缀输出 JSON，无需接入额外的监控库
+    pub fn with_metrics(mut self, prefix: &str) -> Self {
+        self.metrics_prefix = Some(prefix.to_string());
+        self
+    }
+
+    /// 开启自动重新握手，响应的 control 为 `controls` 之一或会话过期时，重新握手后重试请求
+    ///
+    /// 触发条件默认为会话过期和版本不匹配，可用 [`ClientOptions::with_rehandshake_when`] 替换
+    pub fn with_rehandshake_on(mut self, controls: &[u8]) -> Self {
+        self.rehandshake
+            .get_or_insert_with(Default::default)
+            .controls = controls.to_vec();
+        self
+    }
+
+    /// 开启自动重新握手，请求失败的错误满足 `predicate` 时重新握手后重试请求
+    pub fn with_rehandshake_when<F>(mut self, predicate: F) -> Self
+    where
+        F: Fn(&ClientError) -> bool + Send + Sync + 'static,
+    {
+        self.rehandshake
+            .get_or_insert_with(Default::default)
+            .predicate = RehandshakePredicate(Arc::new(predicate));
+        self
+    }
+
+    /// 开启 TCP 保活，连接空闲 `interval` 后由系统每隔 `interval` 探测一次
+    ///
+    /// 与协议心跳相互独立，可在两次心跳之间发现网络分区造成的半开连接，重连时同样生效。
+    /// 只作用于默认的 TCP 连接，自定义连接函数需自行调用 [`set_tcp_keepalive`](crate::transport::set_tcp_keepalive)
+    pub fn with_tcp_keepalive(mut self, interval: Duration) -> Self {
+        self.tcp_keepalive = Some(interval);
+        self
+    }
+
+    /// 设置批量发送时是否合并写入
+    ///
+    /// 默认开启，整批请求在一次写入中发出，减少系统调用和往返延迟；
+    /// 个别服务器不能正确处理同一报文段中的多个请求时可关闭，改为逐帧写入
+    pub fn with_coalesce_writes(mut self, coalesce: bool) -> Self {
+        self.coalesce_writes = coalesce;
+        self
+    }
+
+    /// 开启原始帧捕获，保留最近的帧直到超出帧数或总字节数上限（0表示不限制）
+    pub fn with_raw_capture(mut self, max_frames: usize, max_bytes: usize) -> Self {
+        self.raw_capture = Some(RawCaptureConfig {
+            max_frames,
+            max_bytes,
+        });
+        self
+    }
+}
+
+/// 分页下载进度
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Progress {
+    /// 已获取的条数
+    pub fetched: usize,
+    /// 总条数，服务器未提供时为 None
+    pub total: Option<usize>,
+}
+
+/// 健康检查报告
+#[derive(Debug, Clone)]
+pub struct HealthReport {
+    /// 心跳是否成功
+    pub alive: bool,
+    /// 心跳往返耗时
+    pub rtt: Option<Duration>,
+    /// 深圳市场的代码数量，请求失败时为 None
+    pub count: Option<u16>,
+    /// 握手时服务器返回的信息
+    pub server_info: Option<String>,
+    /// 当前连接建立至今的时长，重连后重新计时
+    pub uptime: Duration,
+    /// 第一个失败检查的错误
+    pub error: Option<String>,
+}
+
+impl HealthReport {
+    /// 连接存活且服务器返回了有效的代码数量
+    pub fn is_healthy(&self) -> bool {
+        self.alive && self.count.is_some_and(|c| c > 0)
+    }
+}
+
+/// 自定义时钟，返回当前 Unix 时间戳（秒）
+#[derive(Clone)]
+pub struct Clock(pub Arc<dyn Fn() -> i64 + Send + Sync>);
+
+impl fmt::Debug for Clock {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Clock")
+    }
+}
+
+/// 判断K线是否收盘、是否处于交易时段时使用的当前时间来源
+#[derive(Debug, Clone, Default)]
+pub enum TimeSource {
+    /// 本机时钟
+    #[default]
+    LocalClock,
+    /// 以行情中的服务器时间校正本机时钟
+    ///
+    /// 每次获取行情时用服务器时间估算本机时钟偏差；行情时间只在交易时段内更新，
+    /// 不在交易时段内的行情时间视为过时而忽略，尚无有效估算时按本机时钟
+    ServerTime,
+    /// 自定义时钟
+    Custom(Clock),
+}
+
 /// TDX 客户端（异步）
 pub struct Client {
-    stream: Arc<Mutex<TcpStream>>,
+    addr: String,
+    stream: Arc<Mutex<Option<Box<dyn Transport>>>>,
     msg_id: AtomicU32,
     timeout: Duration,
+    options: ClientOptions,
+    block_index: Mutex<Option<Arc<HashMap<String, Vec<BlockMembership>>>>>,
+    ipo_times: std::sync::Mutex<HashMap<String, Option<i64>>>,
+    code_lists: Mutex<HashMap<Exchange, Arc<Vec<StockCode>>>>,
+    capture: Option<std::sync::Mutex<RawCapture>>,
+    server_info: std::sync::Mutex<Option<ConnectResponse>>,
+    connected_at: std::sync::Mutex<Instant>,
+    metrics: Option<Metrics>,
+    clock_offset: std::sync::Mutex<Option<i64>>,
 }
 
 impl Client {
     /// 连接到指定地址
     pub async fn connect(addr: &str) -> Result<Self, ClientError> {
+        Self::connect_with(addr, ClientOptions::default()).await
+    }
+
+    /// 使用指定配置连接到地址
+    ///
+    /// 演练模式下不会建立连接
+    pub async fn connect_with(addr: &str, options: ClientOptions) -> Result<Self, ClientError> {
         let addr = if addr.contains(':') {
             addr.to_string()
         } else {
             format!("{}:7709", addr)
         };
 
-        let stream = TcpStream::connect(&addr).await?;
-        stream.set_nodelay(true)?;
+        let mut attempt = 0;
+        loop {
+            let client = Self::open(&addr, options.clone()).await?;
+            if options.dry_run {
+                return Ok(client);
+            }
+            match client.send_connect().await {
+                Ok(()) => return Ok(client),
+                Err(e) if e.is_connection() && attempt < options.handshake_retries => {
+                    attempt += 1;
+                    warn!("握手失败，第{}次重试: {} ({})", attempt, addr, e);
+                    time::sleep(Duration::from_millis(200 * attempt as u64)).await;
+                }
+                Err(e) => return Err(e),
+            }
+        }
+    }
+
+    /// 建立连接（不握手），演练模式下不会建立连接
+    async fn open(addr: &str, options: ClientOptions) -> Result<Self, ClientError> {
+        let stream = if options.dry_run {
+            None
+        } else {
+            Some(Self::connect_transport(addr, &options).await?)
+        };
+        let capture = options
+            .raw_capture
+            .map(|config| std::sync::Mutex::new(RawCapture::new(config)));
 
-        let client = Self {
+        let metrics = options.metrics_prefix.as_ref().map(|_| Metrics::default());
+
+        Ok(Self {
+            addr: addr.to_string(),
             stream: Arc::new(Mutex::new(stream)),
             msg_id: AtomicU32::new(0),
-            timeout: Duration::from_secs(10),
+            timeout: options.timeout,
+            options,
+            block_index: Mutex::new(None),
+            ipo_times: std::sync::Mutex::new(HashMap::new()),
+            code_lists: Mutex::new(HashMap::new()),
+            capture,
+            server_info: std::sync::Mutex::new(None),
+            connected_at: std::sync::Mutex::new(Instant::now()),
+            metrics,
+            clock_offset: std::sync::Mutex::new(None),
+        })
+    }
+
+    /// 使用相同的地址和配置建立一个新的独立连接
+    ///
+    /// 新连接会重新握手，请求回调、客户端标识等配置保持一致，
+    /// 适合为每个工作任务分配独立连接，避免在同一连接上排队
+    pub async fn clone_connection(&self) -> Result<Self, ClientError> {
+        Self::connect_with(&self.addr, self.options.clone()).await
+    }
+
+    /// 断开当前连接并重新连接、握手
+    ///
+    /// 失败时按 [`ReconnectBackoff`] 等待后重试，超过最大尝试次数返回最后一次的错误。
+    /// 适用于 [`ClientError::is_connection`] 为 true 的错误（含会话过期）
+    pub async fn reconnect(&self) -> Result<(), ClientError> {
+        if self.options.dry_run {
+            return Ok(());
+        }
+        let backoff = self.options.reconnect_backoff;
+        let mut attempt = 0;
+        loop {
+            match self.reconnect_once().await {
+                Ok(()) => {
+                    if let Some(metrics) = &self.metrics {
+                        metrics.record_reconnect();
+                    }
+                    return Ok(());
+                }
+                Err(e) => {
+                    if backoff.max_attempts > 0 && attempt + 1 >= backoff.max_attempts {
+                        return Err(e);
+                    }
+                    let delay = backoff.delay(attempt);
+                    warn!(
+                        "重连失败，{:?}后第{}次重试: {} ({})",
+                        delay,
+                        attempt + 1,
+                        self.addr,
+                        e
+                    );
+                    time::sleep(delay).await;
+                    attempt += 1;
+                }
+            }
+        }
+    }
+
+    /// 按配置的连接函数建立连接，未配置时使用 TCP
+    async fn connect_transport(
+        addr: &str,
+        options: &ClientOptions,
+    ) -> Result<Box<dyn Transport>, ClientError> {
+        let stream = match &options.connector {
+            Some(connector) => (connector.0)(addr).await?,
+            None => connect_tcp(addr, options.tcp_keepalive).await?,
         };
+        Ok(stream)
+    }
+
+    /// 建立新的连接并握手，成功后再替换当前连接
+    ///
+    /// 新连接握手完成前，其他请求仍使用原连接；失败时原连接保持不变
+    async fn reconnect_once(&self) -> Result<(), ClientError> {
+        let mut stream = Self::connect_transport(&self.addr, &self.options).await?;
+        self.handshake(&mut stream).await?;
+        *self.stream.lock().await = Some(stream);
+        if let Ok(mut connected_at) = self.connected_at.lock() {
+            *connected_at = Instant::now();
+        }
+        Ok(())
+    }
 
-        client.send_connect().await?;
-        Ok(client)
+    /// 服务器地址（含端口）
+    pub fn addr(&self) -> &str {
+        &self.addr
     }
 
-    /// 发送连接请求并读取响应
+    /// 在当前连接上握手
     async fn send_connect(&self) -> Result<(), ClientError> {
-        let frame = Connect::request(1);
+        let mut guard = self.stream.lock().await;
+        let stream = guard.as_mut().ok_or(ClientError::Disconnected)?;
+        self.handshake(stream).await
+    }
+
+    /// 发送连接请求并读取响应
+    async fn handshake(&self, stream: &mut Box<dyn Transport>) -> Result<(), ClientError> {
+        let frame = match &self.options.identity {
+            Some(identity) => Connect::request_with_identity(1, identity),
+            None => Connect::request(1),
+        };
         let data = frame.encode();
-        let mut stream = self.stream.lock().await;
-        self.write_all_locked(&mut stream, &data).await?;
-        let _response = self.read_response_locked(&mut stream).await?;
+        self.write_all_locked(stream, &data).await?;
+        let response = self.read_response_locked(stream).await?;
+        let info = match Connect::decode_connect_response(response.data()) {
+            Ok(info) => {
+                debug!("握手成功: {}", info.info);
+                info
+            }
+            Err(e @ MessageError::VersionMismatch { .. }) => return Err(e.into()),
+            Err(e) => {
+                // 部分服务器的握手响应不足68字节，不影响后续请求，仅保留原始内容
+                warn!("握手响应无法解析，忽略服务器信息: {}", e);
+                ConnectResponse {
+                    header: response.data().to_vec(),
+                    info: String::new(),
+                }
+            }
+        };
+        if let Ok(mut server_info) = self.server_info.lock() {
+            *server_info = Some(info);
+        }
         Ok(())
     }
 
+    /// 握手时服务器返回的信息，演练模式下为 None
+    pub fn server_info(&self) -> Option<ConnectResponse> {
+        self.server_info.lock().ok().and_then(|info| info.clone())
+    }
+
     async fn write_all_locked(
         &self,
-        stream: &mut TcpStream,
+        stream: &mut Box<dyn Transport>,
         data: &[u8],
     ) -> Result<(), ClientError> {
         debug!("发送请求帧 ({} 字节): {:02X?}", data.len(), data);
+        self.capture_frame(true, data);
+        if let Some(metrics) = &self.metrics {
+            metrics.record_sent(data.len());
+        }
 
         stream.write_all(data).await?;
         stream.flush().await?;
         Ok(())
     }
 
-    async fn read_response_locked(
+    /// 写入多个请求帧，按配置合并为一次写入或逐帧写入
+    async fn write_frames_locked(
         &self,
-        stream: &mut TcpStream,
-    ) -> Result<ResponseFrame, ClientError> {
-        let timeout = self.timeout;
-        let fut = async {
-            let mut header = [0u8; 16];
-            stream.read_exact(&mut header).await?;
-
-            // 前缀是大端序：B1CB7400
-            let prefix = u32::from_be_bytes([header[0], header[1], header[2], header[3]]);
-            if prefix != PREFIX_RESP {
-                return Err(ClientError::Protocol(FrameError::InvalidPrefix));
+        stream: &mut Box<dyn Transport>,
+        frames: &[Vec<u8>],
+    ) -> Result<(), ClientError> {
+        if !self.options.coalesce_writes {
+            for data in frames {
+                self.write_all_locked(stream, data).await?;
             }
+            return Ok(());
+        }
 
-            let msg_type_val = bytes_to_u16_le(&header[10..12]);
-            let zip_length = bytes_to_u16_le(&header[12..14]);
-            let length = bytes_to_u16_le(&header[14..16]);
+        for data in frames {
+            debug!("发送请求帧 ({} 字节): {:02X?}", data.len(), data);
+            self.capture_frame(true, data);
+        }
+        let data = frames.concat();
+        if let Some(metrics) = &self.metrics {
+            metrics.record_sent(data.len());
+        }
+        stream.write_all(&data).await?;
+        stream.flush().await?;
+        Ok(())
+    }
 
-            let msg_type = MessageType::from_u16(msg_type_val).ok_or_else(|| {
-                ClientError::Protocol(FrameError::UnknownMessageType(msg_type_val))
-            })?;
+    /// 读取一帧的帧头和数据域（未解压），记录流量和原始帧
+    async fn read_frame_parts(
+        &self,
+        stream: &mut Box<dyn Transport>,
+    ) -> Result<([u8; 16], Vec<u8>), ClientError> {
+        let mut header = [0u8; 16];
+        stream.read_exact(&mut header).await?;
+
+        // 前缀是大端序：B1CB7400
+        let prefix = u32::from_be_bytes([header[0], header[1], header[2], header[3]]);
+        if prefix != PREFIX_RESP {
+            return Err(ClientError::Protocol(FrameError::InvalidPrefix));
+        }
 
-            let mut compressed_data = vec![0u8; zip_length as usize];
-            stream.read_exact(&mut compressed_data).await?;
+        let zip_length = bytes_to_u16_le(&header[12..14]);
+        let length = bytes_to_u16_le(&header[14..16]);
+        if let Err(e) = check_frame_size(zip_length, length, self.options.max_frame_size) {
+            // 长度字段为 u16，丢弃的数据域最多 64KB；读完后连接仍与帧边界对齐，可继续使用
+            let mut discarded = vec![0u8; zip_length as usize];
+            stream.read_exact(&mut discarded).await?;
+            return Err(e.into());
+        }
 
-            debug!(
-                "接收响应: 类型={:?}, 压缩长度={}, 长度={}",
-                msg_type, zip_length, length
-            );
+        let mut compressed_data = vec![0u8; zip_length as usize];
+        stream.read_exact(&mut compressed_data).await?;
+        if let Some(metrics) = &self.metrics {
+            metrics.record_received(16 + compressed_data.len());
+        }
 
-            let mut response = ResponseFrame::new(
-                prefix,
-                header[4],
-                bytes_to_u32_le(&header[5..9]),
-                header[9],
-                msg_type,
-                zip_length,
-                length,
-                compressed_data,
-            );
+        if self.capture.is_some() {
+            let mut raw = header.to_vec();
+            raw.extend_from_slice(&compressed_data);
+            self.capture_frame(false, &raw);
+        }
+        Ok((header, compressed_data))
+    }
+
+    /// 消息ID是否由本客户端发出过：握手固定为1，其余请求从1开始递增
+    fn is_issued_msg_id(&self, msg_id: u32) -> bool {
+        msg_id != 0 && msg_id <= self.msg_id.load(Ordering::SeqCst).max(1)
+    }
 
-            response.decompress()?;
-            Ok(response)
+    async fn read_response_locked(
+        &self,
+        stream: &mut Box<dyn Transport>,
+    ) -> Result<ResponseFrame, ClientError> {
+        let timeout = self.timeout;
+        let fut = async {
+            loop {
+                let (header, compressed_data) = self.read_frame_parts(stream).await?;
+                let prefix = u32::from_be_bytes([header[0], header[1], header[2], header[3]]);
+                let msg_id = bytes_to_u32_le(&header[5..9]);
+                let msg_type_val = bytes_to_u16_le(&header[10..12]);
+                let zip_length = bytes_to_u16_le(&header[12..14]);
+                let length = bytes_to_u16_le(&header[14..16]);
+
+                // 服务器主动推送的通知使用客户端从未发出的消息ID（如0），读完后继续等待响应；
+                // 消息ID是已发出的请求但类型未知时按协议错误返回，避免掩盖错位的响应
+                let msg_type = match MessageType::from_u16(msg_type_val) {
+                    Some(msg_type) => msg_type,
+                    None if !self.is_issued_msg_id(msg_id) => {
+                        self.handle_notice(
+                            header[9],
+                            msg_id,
+                            msg_type_val,
+                            zip_length,
+                            length,
+                            compressed_data,
+                        )?;
+                        continue;
+                    }
+                    None => {
+                        return Err(ClientError::Protocol(FrameError::UnknownMessageType(
+                            msg_type_val,
+                        )))
+                    }
+                };
+
+                debug!(
+                    "接收响应: 类型={:?}, 压缩长度={}, 长度={}",
+                    msg_type, zip_length, length
+                );
+
+                let mut response = ResponseFrame::new(
+                    prefix,
+                    header[4],
+                    msg_id,
+                    header[9],
+                    msg_type,
+                    zip_length,
+                    length,
+                    compressed_data,
+                );
+
+                response.decompress_with(|data, length| {
+                    self.inflate_payload(header[9], data, length)
+                })?;
+                return Ok(response);
+            }
         };
 
         match time::timeout(timeout, fut).await {
@@ -134,6 +854,62 @@ impl Client {
         }
     }
 
+    /// 解压数据，优先使用按帧头标志注册的自定义解压函数
+    fn inflate_payload(&self, flag: u8, data: &[u8], length: u16) -> Result<Vec<u8>, FrameError> {
+        match self.options.decompressors.get(&flag) {
+            Some(decompressor) => (decompressor.0)(data, length),
+            None => inflate(data, length),
+        }
+    }
+
+    /// 解码服务器通知并交给回调
+    fn handle_notice(
+        &self,
+        flag: u8,
+        msg_id: u32,
+        msg_type: u16,
+        zip_length: u16,
+        length: u16,
+        data: Vec<u8>,
+    ) -> Result<(), ClientError> {
+        let data = if zip_length != length {
+            self.inflate_payload(flag, &data, length)?
+        } else {
+            data
+        };
+        let notice = ServerNotice {
+            msg_id,
+            msg_type,
+            time: Utc::now().timestamp(),
+            text: gbk_to_utf8(&data).trim().to_string(),
+        };
+        debug!(
+            "收到服务器通知: 类型=0x{:04X}, 内容={}",
+            msg_type, notice.text
+        );
+        if let Some(handler) = &self.options.notice_handler {
+            (handler.0)(&notice);
+        }
+        Ok(())
+    }
+
+    /// 记录原始帧到捕获缓冲区
+    fn capture_frame(&self, sent: bool, data: &[u8]) {
+        if let Some(capture) = &self.capture {
+            if let Ok(mut capture) = capture.lock() {
+                capture.push(sent, data);
+            }
+        }
+    }
+
+    /// 获取捕获的原始帧（从旧到新），未开启捕获时返回空列表
+    pub fn raw_frames(&self) -> Vec<CapturedFrame> {
+        match &self.capture {
+            Some(capture) => capture.lock().map(|c| c.frames()).unwrap_or_default(),
+            None => Vec::new(),
+        }
+    }
+
     /// 发送帧并等待响应
     pub async fn send_frame(&self, frame: RequestFrame) -> Result<ResponseFrame, ClientError> {
         let msg_id = self.next_msg_id();
@@ -141,22 +917,229 @@ impl Client {
         let mut frame = frame;
         frame.msg_id = msg_id;
 
+        if let Some(hook) = &self.options.request_hook {
+            (hook.0)(&frame);
+        }
+
+        if self.options.dry_run {
+            debug!("演练模式，跳过发送: 类型={:?}", frame.msg_type);
+            return Ok(dry_run_response(msg_id, frame.msg_type));
+        }
+
         let data = frame.encode();
-        let mut stream = self.stream.lock().await;
+        let start = Instant::now();
+        let result = self
+            .with_rehandshake(|| self.exchange_frame(msg_id, &data))
+            .await;
+        self.record_result(frame.msg_type, start, &result);
+        result
+    }
+
+    /// 执行请求，失败时按 [`RehandshakePolicy`] 重新握手后重试
+    async fn with_rehandshake<T, F, Fut>(&self, mut request: F) -> Result<T, ClientError>
+    where
+        F: FnMut() -> Fut,
+        Fut: std::future::Future<Output = Result<T, ClientError>>,
+    {
+        let mut retries = 0;
+        loop {
+            let err = match request().await {
+                Ok(value) => return Ok(value),
+                Err(e) => e,
+            };
+            let policy = match &self.options.rehandshake {
+                Some(policy) if retries < policy.max_retries && (policy.predicate.0)(&err) => {
+                    policy
+                }
+                _ => return Err(err),
+            };
+            retries += 1;
+            warn!(
+                "请求失败，重新握手后第{}/{}次重试: {}",
+                retries, policy.max_retries, err
+            );
+            self.reconnect().await?;
+        }
+    }
+
+    /// 响应是否表示会话已失效，需要重新握手
+    fn is_session_expired(&self, response: &ResponseFrame) -> bool {
+        response.is_session_expired()
+            || self
+                .options
+                .rehandshake
+                .as_ref()
+                .map_or(false, |policy| policy.controls.contains(&response.control))
+    }
 
-        self.write_all_locked(&mut stream, &data).await?;
-        let response = self.read_response_locked(&mut stream).await?;
+    /// 检查响应的 control：会话过期返回 `SessionExpired`，其他错误响应返回 `ServerError`
+    fn check_response(&self, response: &ResponseFrame) -> Result<(), ClientError> {
+        if self.is_session_expired(response) {
+            return Err(ClientError::SessionExpired);
+        }
+        if !response.is_success() {
+            return Err(ClientError::ServerError(response.control));
+        }
+        Ok(())
+    }
+
+    /// 发送已编码的请求帧并读取对应的响应
+    async fn exchange_frame(&self, msg_id: u32, data: &[u8]) -> Result<ResponseFrame, ClientError> {
+        let mut guard = self.stream.lock().await;
+        let stream = guard.as_mut().ok_or(ClientError::Disconnected)?;
+
+        self.write_all_locked(stream, data).await?;
+        let response = self.read_response_locked(stream).await?;
 
         if response.msg_id != msg_id {
-            return Err(ClientError::Other(format!(
-                "消息ID不匹配: 期望 {}, 得到 {}",
-                msg_id, response.msg_id
-            )));
+            return Err(ClientError::MsgIdMismatch {
+                expected: msg_id,
+                actual: response.msg_id,
+            });
         }
 
+        self.check_response(&response)?;
         Ok(response)
     }
 
+    /// 记录请求结果到运行指标
+    fn record_result<T>(
+        &self,
+        msg_type: MessageType,
+        start: Instant,
+        result: &Result<T, ClientError>,
+    ) {
+        if let Some(metrics) = &self.metrics {
+            match result {
+                Ok(_) => metrics.record_request(msg_type.as_u16(), start.elapsed()),
+                Err(_) => metrics.record_error(),
+            }
+        }
+    }
+
+    /// 获取运行指标快照，未开启指标时返回 None
+    pub fn metrics(&self) -> Option<MetricsSnapshot> {
+        self.metrics.as_ref().map(|m| m.snapshot())
+    }
+
+    /// 以配置的前缀输出运行指标的 JSON 对象，未开启指标时返回 None
+    pub fn metrics_json(&self) -> Option<serde_json::Value> {
+        let prefix = self.options.metrics_prefix.as_deref()?;
+        self.metrics().map(|m| m.to_json(prefix))
+    }
+
+    /// 连续发送多个帧后再依次读取响应，响应按请求顺序返回
+    ///
+    /// 服务器按收到的顺序应答，整批只需一次网络往返；请求帧默认合并为一次写入
+    /// （见 [`ClientOptions::with_coalesce_writes`]）。任一响应出错时返回错误，
+    /// 此时连接上可能残留未读的响应，应重新连接
+    pub async fn send_frames(
+        &self,
+        frames: Vec<RequestFrame>,
+    ) -> Result<Vec<ResponseFrame>, ClientError> {
+        let mut msg_ids = Vec::with_capacity(frames.len());
+        let mut data = Vec::with_capacity(frames.len());
+        for mut frame in frames {
+            frame.msg_id = self.next_msg_id();
+            if let Some(hook) = &self.options.request_hook {
+                (hook.0)(&frame);
+            }
+            msg_ids.push((frame.msg_id, frame.msg_type));
+            data.push(frame.encode());
+        }
+
+        if self.options.dry_run {
+            debug!("演练模式，跳过发送: {} 个请求", msg_ids.len());
+            return Ok(msg_ids
+                .into_iter()
+                .map(|(msg_id, msg_type)| dry_run_response(msg_id, msg_type))
+                .collect());
+        }
+
+        let start = Instant::now();
+        let result = self
+            .with_rehandshake(|| self.exchange_frames(&msg_ids, &data))
+            .await;
+        if let Some(metrics) = &self.metrics {
+            match &result {
+                Ok(_) => {
+                    for (_, msg_type) in &msg_ids {
+                        metrics.record_request(msg_type.as_u16(), start.elapsed());
+                    }
+                }
+                Err(_) => metrics.record_error(),
+            }
+        }
+        result
+    }
+
+    /// 发送多个已编码的请求帧并依次读取响应
+    async fn exchange_frames(
+        &self,
+        msg_ids: &[(u32, MessageType)],
+        frames: &[Vec<u8>],
+    ) -> Result<Vec<ResponseFrame>, ClientError> {
+        let mut guard = self.stream.lock().await;
+        let stream = guard.as_mut().ok_or(ClientError::Disconnected)?;
+        self.write_frames_locked(stream, frames).await?;
+
+        let mut responses = Vec::with_capacity(msg_ids.len());
+        for &(msg_id, _) in msg_ids {
+            let response = self.read_response_locked(stream).await?;
+            if response.msg_id != msg_id {
+                return Err(ClientError::MsgIdMismatch {
+                    expected: msg_id,
+                    actual: response.msg_id,
+                });
+            }
+            self.check_response(&response)?;
+            responses.push(response);
+        }
+        Ok(responses)
+    }
+
+    /// 发送一段已编码的原始字节，不等待响应（高级用法）
+    ///
+    /// 与 [`Client::read_frame`] 配合，可在连接的锁、超时和解压之上实现库中尚未支持的请求。
+    /// 调用方需自行保证帧格式和消息ID正确，并读取每个请求的响应，否则后续请求会读到错位的响应；
+    /// 出错后应调用 [`Client::reconnect`]。演练模式下没有连接，返回 `Disconnected`
+    pub async fn send_raw_frame(&self, data: &[u8]) -> Result<(), ClientError> {
+        let mut guard = self.stream.lock().await;
+        let stream = guard.as_mut().ok_or(ClientError::Disconnected)?;
+        self.write_all_locked(stream, data).await
+    }
+
+    /// 读取下一个响应帧（已解压），不校验消息ID和消息类型（高级用法）
+    ///
+    /// 使用客户端配置的超时和解压函数。返回的是原始帧，库中未定义的消息类型和
+    /// 服务器通知都原样返回，由调用方按 [`RawFrame::msg_type`] 区分。
+    /// 连接上没有待读的响应时会一直等到超时
+    pub async fn read_frame(&self) -> Result<RawFrame, ClientError> {
+        let mut guard = self.stream.lock().await;
+        let stream = guard.as_mut().ok_or(ClientError::Disconnected)?;
+        let fut = async {
+            let (header, data) = self.read_frame_parts(stream).await?;
+            let zip_length = bytes_to_u16_le(&header[12..14]);
+            let length = bytes_to_u16_le(&header[14..16]);
+            let data = if zip_length != length {
+                self.inflate_payload(header[9], &data, length)?
+            } else {
+                data
+            };
+            Ok(RawFrame {
+                control: header[4],
+                msg_id: bytes_to_u32_le(&header[5..9]),
+                unknown: header[9],
+                msg_type: bytes_to_u16_le(&header[10..12]),
+                data,
+            })
+        };
+        match time::timeout(self.timeout, fut).await {
+            Ok(res) => res,
+            Err(_) => Err(ClientError::Timeout),
+        }
+    }
+
     /// 获取股票数量
     pub async fn get_count(&self, exchange: Exchange) -> Result<u16, ClientError> {
         let frame = Count::request(self.next_msg_id(), exchange);
@@ -188,9 +1171,40 @@ impl Client {
         exchange: Exchange,
         from_start: u16,
     ) -> Result<CodeResponse, ClientError> {
+        self.get_code_pages(exchange, from_start, None, |_| {})
+            .await
+    }
+
+    /// 获取所有股票代码，并在每页完成后报告进度
+    ///
+    /// 代码列表的总数来自 [`Client::get_count`]，会多发送一次请求
+    pub async fn get_code_all_with_progress<F>(
+        &self,
+        exchange: Exchange,
+        on_progress: F,
+    ) -> Result<CodeResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
+        let total = self.get_count(exchange).await? as usize;
+        self.get_code_pages(exchange, 0, Some(total), on_progress)
+            .await
+    }
+
+    /// 从 `from_start` 起逐页获取代码列表，每页完成后报告进度
+    async fn get_code_pages<F>(
+        &self,
+        exchange: Exchange,
+        from_start: u16,
+        total: Option<usize>,
+        mut on_progress: F,
+    ) -> Result<CodeResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
         let mut all_codes = CodeResponse {
             count: 0,
-            codes: Vec::new(),
+            codes: Vec::with_capacity(total.unwrap_or(0)),
         };
         let batch_size = 1000u16;
         let mut start = from_start;
@@ -199,6 +1213,10 @@ impl Client {
             let resp = self.get_code(exchange, start).await?;
             all_codes.count += resp.count;
             all_codes.codes.extend(resp.codes);
+            on_progress(Progress {
+                fetched: all_codes.codes.len(),
+                total,
+            });
 
             if resp.count < batch_size {
                 break;
@@ -210,6 +1228,8 @@ impl Client {
     }
 
     /// 根据交易所与类型筛选代码
+    ///
+    /// 代码需带上交易所前缀再判断类型，否则上海指数（000xxx）会被当作深圳股票
     async fn filter_market_codes(
         &self,
         exchange: Exchange,
@@ -219,7 +1239,7 @@ impl Client {
         Ok(resp
             .codes
             .into_iter()
-            .filter(|c| predicate(&c.code))
+            .filter(|c| predicate(&format!("{}{}", exchange.as_str(), c.code)))
             .collect())
     }
 
@@ -237,6 +1257,9 @@ impl Client {
     }
 
     /// 获取指定市场的指数代码
+    ///
+    /// 按代码段筛选：上海 000xxx/999999，深圳 399xxx，北京 899xxx。
+    /// 返回的代码可直接用于 `get_index_day_all` 等指数K线接口
     pub async fn get_market_indexes(
         &self,
         exchange: Exchange,
@@ -244,6 +1267,64 @@ impl Client {
         self.filter_market_codes(exchange, is_index).await
     }
 
+    /// 获取指定市场仍在正常上市的股票
+    ///
+    /// 代码列表中没有上市状态字段，按以下规则排除：
+    /// - 名称表明已退市或处于退市整理期（见 [`is_delisted_name`]）
+    /// - 行情请求中服务器不返回的代码，或昨收为0的代码
+    ///
+    /// 需要额外按每80只一次请求行情
+    pub async fn list_active(&self, exchange: Exchange) -> Result<Vec<StockCode>, ClientError> {
+        let stocks: Vec<StockCode> = self
+            .get_market_stocks(exchange)
+            .await?
+            .into_iter()
+            .filter(|c| !is_delisted_name(&c.name))
+            .collect();
+
+        let codes: Vec<String> = stocks
+            .iter()
+            .map(|c| format!("{}{}", exchange.as_str(), c.code))
+            .collect();
+        let mut quoted = HashSet::new();
+        for chunk in codes.chunks(80) {
+            for q in self.get_quote(chunk).await? {
+                if q.exchange == exchange && q.k.last.0 > 0 {
+                    quoted.insert(q.code);
+                }
+            }
+        }
+
+        Ok(stocks
+            .into_iter()
+            .filter(|c| quoted.contains(&c.code))
+            .collect())
+    }
+
+    /// 获取指定市场全部股票的行情并统计涨跌家数、总成交量和成交额
+    ///
+    /// 每80只一次请求行情，停牌股票单独计数（见 [`market_breadth`]）。
+    /// 行情中没有指数的涨跌家数字段，服务器统计的家数可从指数K线的
+    /// `up_count`/`down_count` 获取（如 `get_index_day("sh000001", 0, 1)`）
+    pub async fn market_breadth(&self, exchange: Exchange) -> Result<Breadth, ClientError> {
+        let codes: Vec<String> = self
+            .get_market_stocks(exchange)
+            .await?
+            .iter()
+            .map(|c| format!("{}{}", exchange.as_str(), c.code))
+            .collect();
+        let mut quotes = Vec::with_capacity(codes.len());
+        for chunk in codes.chunks(80) {
+            quotes.extend(
+                self.get_quote(chunk)
+                    .await?
+                    .into_iter()
+                    .filter(|q| q.exchange == exchange),
+            );
+        }
+        Ok(market_breadth(&quotes))
+    }
+
     /// 获取深圳股票
     pub async fn get_sz_stocks(&self) -> Result<Vec<StockCode>, ClientError> {
         self.get_market_stocks(Exchange::SZ).await
@@ -371,13 +1452,89 @@ impl Client {
     }
 
     /// 获取行情信息（五档报价）
+    ///
+    /// 返回结果按响应中的市场和代码标识，可能少于请求数量，请按 `exchange` + `code` 匹配
     pub async fn get_quote(&self, codes: &[String]) -> Result<Vec<QuoteInfo>, ClientError> {
         let frame = Quote::request(self.next_msg_id(), codes)?;
         let response = self.send_frame(frame).await?;
         let quotes = Quote::decode_response(response.data())?;
+        if let TimeSource::ServerTime = self.options.time_source {
+            // 行情时间只在交易时段内随快照更新，收盘后停留在最后一次更新的时间，
+            // 因此按行情时间是否处于交易时段判断是否过时，而不限制偏差的大小；
+            // 停牌等证券的时间停留在更早的时刻，取各行情中最新的时间
+            if let Some(seconds) = quotes
+                .iter()
+                .filter_map(|q| server_time_of_day(&q.server_time))
+                .filter(|seconds| is_session_minute(seconds / 60))
+                .max()
+            {
+                self.update_clock_offset(seconds);
+            }
+        }
         Ok(quotes)
     }
 
+    /// 按配置的时间来源获取当前 Unix 时间戳（秒）
+    pub fn now(&self) -> i64 {
+        let local = Utc::now().timestamp();
+        match &self.options.time_source {
+            TimeSource::LocalClock => local,
+            TimeSource::ServerTime => {
+                local + self.clock_offset.lock().ok().and_then(|o| *o).unwrap_or(0)
+            }
+            TimeSource::Custom(clock) => (clock.0)(),
+        }
+    }
+
+    /// 用服务器当天的秒数估算本机时钟偏差
+    fn update_clock_offset(&self, server_seconds: u32) {
+        let local = Utc::now().timestamp();
+        let local_seconds = (local + 8 * 3600).rem_euclid(86400);
+        let offset = (server_seconds as i64 - local_seconds + 43200).rem_euclid(86400) - 43200;
+        if let Ok(mut clock_offset) = self.clock_offset.lock() {
+            *clock_offset = Some(offset);
+        }
+    }
+
+    /// 获取单只股票的5档盘口
+    ///
+    /// 只请求一只股票，响应最小，适合高频轮询单个标的。
+    /// 交易所行情快照约每3秒更新一次，轮询间隔低于3秒通常拿不到新数据
+    pub async fn get_depth(&self, code: &str) -> Result<Depth, ClientError> {
+        let code = qualify_code(code)?;
+        let quotes = self.get_quote(&[code.clone()]).await?;
+        quotes
+            .iter()
+            .find(|q| format!("{}{}", q.exchange.as_str(), q.code) == code)
+            .map(Depth::from)
+            .ok_or_else(|| ClientError::Other(format!("未返回行情: {}", code)))
+    }
+
+    /// 批量获取当日开高低收
+    ///
+    /// 基于实时行情，每80只股票一次请求，比逐只请求日K线开销小得多。
+    /// 盘中 `close` 为现价，收盘后才是当日收盘价；结果以带交易所前缀的代码（如 sz000001）为键，
+    /// 服务器未返回的代码不会出现在结果中
+    pub async fn get_daily_ohlc(
+        &self,
+        codes: &[String],
+    ) -> Result<HashMap<String, DailyOhlc>, ClientError> {
+        let codes = codes
+            .iter()
+            .map(|c| qualify_code(c))
+            .collect::<Result<Vec<_>, _>>()?;
+        let mut result = HashMap::with_capacity(codes.len());
+        for chunk in codes.chunks(80) {
+            for q in self.get_quote(chunk).await? {
+                result.insert(
+                    format!("{}{}", q.exchange.as_str(), q.code),
+                    DailyOhlc::from(&q),
+                );
+            }
+        }
+        Ok(result)
+    }
+
     /// 发送心跳
     pub async fn send_heartbeat(&self) -> Result<(), ClientError> {
         let frame = Heartbeat::request(self.next_msg_id());
@@ -385,9 +1542,65 @@ impl Client {
         Ok(())
     }
 
+    /// 健康检查
+    ///
+    /// 依次发送心跳（测量往返耗时）并获取深圳市场的代码数量，
+    /// 可区分连接已断开与连接正常但服务器返回异常数据的情况
+    pub async fn health_check(&self) -> HealthReport {
+        let mut report = HealthReport {
+            alive: false,
+            rtt: None,
+            count: None,
+            server_info: self.server_info().map(|info| info.info),
+            uptime: self
+                .connected_at
+                .lock()
+                .map(|t| t.elapsed())
+                .unwrap_or_default(),
+            error: None,
+        };
+
+        let start = Instant::now();
+        match self.send_heartbeat().await {
+            Ok(()) => {
+                report.alive = true;
+                report.rtt = Some(start.elapsed());
+            }
+            Err(e) => {
+                report.error = Some(e.to_string());
+                return report;
+            }
+        }
+
+        match self.get_count(Exchange::SZ).await {
+            Ok(0) => report.error = Some("服务器返回的代码数量为0".to_string()),
+            Ok(count) => report.count = Some(count),
+            Err(e) => report.error = Some(e.to_string()),
+        }
+        report
+    }
+
     // ==================== K线数据 ====================
 
+    /// 按当前时间（见 [`Client::now`]）和配置的休市日判断K线是否未收盘
+    ///
+    /// 所有K线方法都用它设置 [`KlineResponse::partial`]，保证各方法的判断一致
+    pub fn is_partial(&self, kline_type: KlineType, k: &Kline) -> bool {
+        is_partial_bar_in(kline_type, k, self.now(), &self.options.holidays)
+    }
+
+    /// 标记响应的最后一根K线是否未收盘
+    fn mark_partial(&self, kline_type: KlineType, resp: &mut KlineResponse) {
+        resp.partial = resp
+            .list
+            .last()
+            .map_or(false, |k| self.is_partial(kline_type, k));
+    }
+
     /// 获取K线数据（单次最多800条）
+    ///
+    /// 返回结果用 [`KlineResponse::partial`] 标记未收盘K线，
+    /// 只需要已收盘K线时调用 `.with_partial(false)`
     pub async fn get_kline(
         &self,
         kline_type: KlineType,
@@ -395,15 +1608,29 @@ impl Client {
         start: u16,
         count: u16,
     ) -> Result<KlineResponse, ClientError> {
-        let code = add_prefix(code);
+        let (klines, _) = self
+            .get_kline_with_frame(kline_type, code, start, count)
+            .await?;
+        Ok(klines)
+    }
+
+    /// 获取K线数据，同时返回产生这些数据的响应帧
+    ///
+    /// 可通过 [`ResponseFrame::raw_bytes`] 保存服务器原始字节，用于数据溯源
+    pub async fn get_kline_with_frame(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        start: u16,
+        count: u16,
+    ) -> Result<(KlineResponse, ResponseFrame), ClientError> {
+        let code = qualify_code(code)?;
         let frame = KlineMsg::request(self.next_msg_id(), kline_type, &code, start, count)?;
         let response = self.send_frame(frame).await?;
-        let cache = KlineCache {
-            kline_type: kline_type as u8,
-            is_index: is_index(&code),
-        };
-        let klines = KlineMsg::decode_response(response.data(), cache)?;
-        Ok(klines)
+        let cache = KlineCache::new(kline_type, &code);
+        let mut klines = KlineMsg::decode_response(response.data(), cache)?;
+        self.mark_partial(kline_type, &mut klines);
+        Ok((klines, response))
     }
 
     /// 获取所有K线数据（从0开始，通过多次请求拼接）
@@ -422,20 +1649,52 @@ impl Client {
         code: &str,
         from_start: u16,
     ) -> Result<KlineResponse, ClientError> {
+        self.get_kline_pages(kline_type, code, from_start, |_| {})
+            .await
+    }
+
+    /// 获取所有K线数据，并在每页完成后报告进度
+    ///
+    /// K线响应只包含本页数量，协议不提供总数，进度中的 `total` 始终为 None
+    pub async fn get_kline_all_with_progress<F>(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        on_progress: F,
+    ) -> Result<KlineResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
+        self.get_kline_pages(kline_type, code, 0, on_progress).await
+    }
+
+    /// 从 `from_start` 起逐页获取K线并拼接，每页完成后报告进度
+    async fn get_kline_pages<F>(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        from_start: u16,
+        mut on_progress: F,
+    ) -> Result<KlineResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
         let mut all_klines = KlineResponse {
             count: 0,
             list: Vec::new(),
+            partial: false,
         };
         let batch_size = 800u16;
         let mut start = from_start;
 
         loop {
             let resp = self.get_kline(kline_type, code, start, batch_size).await?;
-            all_klines.count += resp.count;
-            // 新数据在前，旧数据在后
-            let mut new_list = resp.list;
-            new_list.append(&mut all_klines.list);
-            all_klines.list = new_list;
+            // 新数据在前，旧数据在后，按时间去掉页边界的重叠K线
+            all_klines.count += merge_kline_page(&mut all_klines.list, resp.list) as u16;
+            on_progress(Progress {
+                fetched: all_klines.list.len(),
+                total: None,
+            });
 
             if resp.count < batch_size {
                 break;
@@ -443,12 +1702,14 @@ impl Client {
             start += batch_size;
         }
 
+        self.mark_partial(kline_type, &mut all_klines);
         Ok(all_klines)
     }
 
     /// 获取所有K线数据（支持自定义过滤）
     ///
-    /// util_fn: 过滤函数，返回 true 表示保留，返回 false 表示停止后续查询（break）
+    /// util_fn: 过滤函数，返回 true 表示保留，返回 false 表示停止后续查询（break）。
+    /// 股票上市日期之前的K线视为不满足条件（见 [`Client::get_kline_all_during`]）
     pub async fn get_kline_all_util<F>(
         &self,
         kline_type: KlineType,
@@ -458,16 +1719,18 @@ impl Client {
     where
         F: Fn(&Kline) -> bool,
     {
+        let ipo_time = self.ipo_floor(code).await;
+        let util_fn = |k: &Kline| ipo_time.map_or(true, |t| k.time >= t) && util_fn(k);
         let mut all_klines = KlineResponse {
             count: 0,
             list: Vec::new(),
+            partial: false,
         };
         let batch_size = 800u16;
         let mut start = 0;
 
         'outer: loop {
             let mut resp = self.get_kline(kline_type, code, start, batch_size).await?;
-            let len = resp.list.len();
 
             // 扫描当前批次数据（从新到旧，即倒序）
             // 如果遇到不满足条件的，则该点之前（更旧）的数据也认为不满足（根据时间连续性假设）
@@ -484,17 +1747,12 @@ impl Client {
 
             if fully_match {
                 // 全部满足，将整个列表加到结果的前面
-                let mut new_list = resp.list;
-                new_list.append(&mut all_klines.list);
-                all_klines.list = new_list;
-                all_klines.count += len as u16;
+                all_klines.count += merge_kline_page(&mut all_klines.list, resp.list) as u16;
             } else {
                 // 部分满足，截取满足的部分
                 // split_offAt cut_index, valid parts are [cut_index..len]
-                let mut valid_part = resp.list.split_off(cut_index);
-                all_klines.count += valid_part.len() as u16;
-                valid_part.append(&mut all_klines.list);
-                all_klines.list = valid_part;
+                let valid_part = resp.list.split_off(cut_index);
+                all_klines.count += merge_kline_page(&mut all_klines.list, valid_part) as u16;
 
                 // 既然已经遇到不满足的了，更旧的数据肯定也不满足，退出循环
                 break 'outer;
@@ -506,12 +1764,16 @@ impl Client {
             start += batch_size;
         }
 
+        self.mark_partial(kline_type, &mut all_klines);
         Ok(all_klines)
     }
 
     /// 获取所有K线数据（支持时间范围）
     ///
-    /// start_time 和 end_time 均为 Unix 时间戳（秒）
+    /// start_time 和 end_time 均为 Unix 时间戳（秒）。
+    /// 股票的起始时间会截断到上市日期，避免返回上市前的异常K线；上市日期按代码缓存，
+    /// ETF、债券、基金和指数不查询，获取失败（如不支持财务信息的服务器）时不截断。
+    /// 已退市股票的数据自然止于最后交易日
     pub async fn get_kline_all_during(
         &self,
         kline_type: KlineType,
@@ -519,6 +1781,7 @@ impl Client {
         start_time: u64,
         end_time: u64,
     ) -> Result<KlineResponse, ClientError> {
+        // 上市日期之前的K线由 get_kline_all_util 截断
         let mut resp = self
             .get_kline_all_util(kline_type, code, |k| k.time as u64 >= start_time)
             .await?;
@@ -526,10 +1789,130 @@ impl Client {
         // 进一步过滤掉大于 end_time 的数据（如果有的话）
         resp.list.retain(|k| k.time as u64 <= end_time);
         resp.count = resp.list.len() as u16;
+        self.mark_partial(kline_type, &mut resp);
+
+        Ok(resp)
+    }
+
+    /// 获取截至指定时间的最近 `count` 根K线（按时间升序）
+    ///
+    /// 返回结果的最后一根K线时间不晚于 `end_time`（Unix 时间戳，秒），与当前日期无关，
+    /// 便于回测时重复获取相同的数据。日K线的时间为当天收盘时间，需包含当天时请传入当天结束时间。
+    /// 历史数据不足 `count` 根时返回全部，股票上市日期之前的K线不返回
+    pub async fn get_kline_ending_at(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        end_time: i64,
+        count: usize,
+    ) -> Result<KlineResponse, ClientError> {
+        let ipo_time = self.ipo_floor(code).await.unwrap_or(i64::MIN);
+        let batch_size = 800u16;
+        let mut start = 0u16;
+        let mut list: Vec<Kline> = Vec::new();
+
+        loop {
+            let resp = self.get_kline(kline_type, code, start, batch_size).await?;
+            // 本页已到上市日期之前，更早的页没有有效数据
+            let before_ipo = resp.list.first().map_or(false, |k| k.time < ipo_time);
+            let page: Vec<Kline> = resp
+                .list
+                .into_iter()
+                .filter(|k| k.time <= end_time && k.time >= ipo_time)
+                .collect();
+            merge_kline_page(&mut list, page);
+
+            if list.len() >= count || resp.count < batch_size || before_ipo {
+                break;
+            }
+            start = match start.checked_add(batch_size) {
+                Some(start) => start,
+                None => break,
+            };
+        }
 
+        if list.len() > count {
+            list.drain(..list.len() - count);
+        }
+        let mut resp = KlineResponse {
+            count: list.len() as u16,
+            list,
+            partial: false,
+        };
+        self.mark_partial(kline_type, &mut resp);
         Ok(resp)
     }
 
+    /// 校验某个交易日的日K线与1分钟K线合并结果是否一致
+    ///
+    /// `date` 为 YYYYMMDD，返回相对差异超过 `tolerance` 的字段（见 [`compare_klines`]），
+    /// 以日K线为基准。服务器只保留近期的分钟K线，当天没有日K线或分钟K线时返回错误
+    pub async fn verify_daily_consistency(
+        &self,
+        code: &str,
+        date: u32,
+        tolerance: f64,
+    ) -> Result<Vec<KlineDiscrepancy>, ClientError> {
+        let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+        let day_start =
+            chrono::NaiveDate::from_ymd_opt((date / 10000) as i32, date / 100 % 100, date % 100)
+                .and_then(|d| d.and_hms_opt(0, 0, 0))
+                .and_then(|dt| beijing_offset.from_local_datetime(&dt).single())
+                .ok_or_else(|| ClientError::Other(format!("无效的日期: {}", date)))?
+                .timestamp();
+        let day_end = day_start + 86400 - 1;
+
+        let daily = self
+            .get_kline_ending_at(KlineType::Day, code, day_end, 1)
+            .await?
+            .list
+            .pop()
+            .filter(|k| k.time >= day_start)
+            .ok_or_else(|| ClientError::Other(format!("没有日K线: {} {}", code, date)))?;
+
+        // 每个交易日240根1分钟K线
+        let minutes: Vec<Kline> = self
+            .get_kline_ending_at(KlineType::Minute, code, day_end, 240)
+            .await?
+            .list
+            .into_iter()
+            .filter(|k| k.time >= day_start)
+            .collect();
+        let aggregated = aggregate_intraday(&minutes)
+            .ok_or_else(|| ClientError::Other(format!("没有分钟K线: {} {}", code, date)))?;
+
+        Ok(compare_klines(&daily, &aggregated, tolerance))
+    }
+
+    /// 获取指定年份的交易日列表（YYYYMMDD，升序）
+    ///
+    /// 由上证指数（sh000001）的日K线日期推导：指数每个交易日都有一根日K线。
+    /// 只包含已经发生的交易日，当年剩余的日期需要等行情产生后才能得到
+    pub async fn fetch_trading_days(&self, year: i32) -> Result<Vec<u32>, ClientError> {
+        let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+        let year_of = |k: &Kline| {
+            Utc.timestamp_opt(k.time, 0)
+                .single()
+                .map(|t| t.with_timezone(&beijing_offset).year())
+                .unwrap_or(0)
+        };
+        let resp = self
+            .get_kline_all_util(KlineType::Day, "sh000001", |k| year_of(k) >= year)
+            .await?;
+        Ok(resp
+            .list
+            .iter()
+            .filter(|k| year_of(k) == year)
+            .filter_map(|k| {
+                let t = Utc
+                    .timestamp_opt(k.time, 0)
+                    .single()?
+                    .with_timezone(&beijing_offset);
+                Some(t.year() as u32 * 10000 + t.month() * 100 + t.day())
+            })
+            .collect())
+    }
+
     /// 获取1分钟K线数据
     pub async fn get_kline_minute(
         &self,
@@ -688,14 +2071,15 @@ impl Client {
         start: u16,
         count: u16,
     ) -> Result<KlineResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = KlineMsg::request(self.next_msg_id(), kline_type, &code, start, count)?;
         let response = self.send_frame(frame).await?;
         let cache = KlineCache {
-            kline_type: kline_type as u8,
             is_index: true,
+            ..KlineCache::new(kline_type, &code)
         };
-        let klines = KlineMsg::decode_response(response.data(), cache)?;
+        let mut klines = KlineMsg::decode_response(response.data(), cache)?;
+        self.mark_partial(kline_type, &mut klines);
         Ok(klines)
     }
 
@@ -718,16 +2102,14 @@ impl Client {
         let mut all_klines = KlineResponse {
             count: 0,
             list: Vec::new(),
+            partial: false,
         };
         let batch_size = 800u16;
         let mut start = from_start;
 
         loop {
             let resp = self.get_index(kline_type, code, start, batch_size).await?;
-            all_klines.count += resp.count;
-            let mut new_list = resp.list;
-            new_list.append(&mut all_klines.list);
-            all_klines.list = new_list;
+            all_klines.count += merge_kline_page(&mut all_klines.list, resp.list) as u16;
 
             if resp.count < batch_size {
                 break;
@@ -735,6 +2117,7 @@ impl Client {
             start += batch_size;
         }
 
+        self.mark_partial(kline_type, &mut all_klines);
         Ok(all_klines)
     }
 
@@ -767,17 +2150,18 @@ impl Client {
 
     /// 获取分时数据（使用历史分时接口，与 Go 版本一致）
     pub async fn get_minute(&self, code: &str) -> Result<MinuteResponse, ClientError> {
-        let today = Self::today_str();
+        let today = self.today_str();
         self.get_history_minute(&today, code).await
     }
 
-    /// 获取当前日期字符串（YYYYMMDD格式，北京时间）
-    fn today_str() -> String {
+    /// 按 [`Client::now`] 获取当前日期字符串（YYYYMMDD格式，北京时间），用于构造分时时间
+    pub(crate) fn today_str(&self) -> String {
         let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
-        Utc::now()
-            .with_timezone(&beijing_offset)
-            .format("%Y%m%d")
-            .to_string()
+        beijing_offset
+            .timestamp_opt(self.now(), 0)
+            .single()
+            .map(|t| t.format("%Y%m%d").to_string())
+            .unwrap_or_default()
     }
 
     /// 获取历史分时数据
@@ -787,13 +2171,55 @@ impl Client {
         date: &str,
         code: &str,
     ) -> Result<MinuteResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = HistoryMinuteMsg::request(self.next_msg_id(), date, &code)?;
         let response = self.send_frame(frame).await?;
-        let minute = HistoryMinuteMsg::decode_response(response.data(), date)?;
+        let minute = HistoryMinuteMsg::decode_response(response.data(), date, &code)?;
         Ok(minute)
     }
 
+    /// 逐日获取日期范围内的历史分时数据
+    ///
+    /// `from`、`to` 为 YYYYMMDD（含两端），跳过周末和 `holidays` 中的休市日，
+    /// 每个交易日的数据获取后调用一次 `on_day(日期, 分时数据)`；回调返回错误时停止并返回该错误。
+    /// 股票上市日期之前的日期跳过。返回处理的交易日数
+    pub async fn each_history_minute<F, E>(
+        &self,
+        code: &str,
+        from: u32,
+        to: u32,
+        holidays: &HashSet<u32>,
+        mut on_day: F,
+    ) -> Result<usize, E>
+    where
+        F: FnMut(u32, MinuteResponse) -> Result<(), E>,
+        E: From<ClientError>,
+    {
+        let to_date = |d: u32| {
+            chrono::NaiveDate::from_ymd_opt((d / 10000) as i32, d / 100 % 100, d % 100)
+                .ok_or_else(|| ClientError::Other(format!("无效的日期: {}", d)))
+        };
+        let (mut date, end) = (to_date(from)?, to_date(to)?);
+        if let Some(ipo_date) = self.ipo_floor(code).await.and_then(|t| {
+            let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+            beijing_offset.timestamp_opt(t, 0).single()
+        }) {
+            date = date.max(ipo_date.date_naive());
+        }
+
+        let mut days = 0;
+        while date <= end {
+            if is_trading_day(date, holidays) {
+                let ymd = date.year() as u32 * 10000 + date.month() * 100 + date.day();
+                let minute = self.get_history_minute(&ymd.to_string(), code).await?;
+                on_day(ymd, minute)?;
+                days += 1;
+            }
+            date += chrono::Duration::days(1);
+        }
+        Ok(days)
+    }
+
     // ==================== 交易数据 ====================
 
     /// 获取分时交易详情（单次最多1800条）
@@ -803,7 +2229,7 @@ impl Client {
         start: u16,
         count: u16,
     ) -> Result<TradeResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = TradeMsg::request(self.next_msg_id(), &code, start, count)?;
         let response = self.send_frame(frame).await?;
 
@@ -831,6 +2257,33 @@ impl Client {
         code: &str,
         from_start: u16,
     ) -> Result<TradeResponse, ClientError> {
+        self.get_trade_pages(code, from_start, |_| {}).await
+    }
+
+    /// 获取所有分时交易详情，并在每页完成后报告进度
+    ///
+    /// 分时成交响应只包含本页条数，协议不提供当日总笔数，进度中的 `total` 始终为 None
+    pub async fn get_trade_all_with_progress<F>(
+        &self,
+        code: &str,
+        on_progress: F,
+    ) -> Result<TradeResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
+        self.get_trade_pages(code, 0, on_progress).await
+    }
+
+    /// 从 `from_start` 起逐页获取分时成交并拼接，每页完成后报告进度
+    async fn get_trade_pages<F>(
+        &self,
+        code: &str,
+        from_start: u16,
+        mut on_progress: F,
+    ) -> Result<TradeResponse, ClientError>
+    where
+        F: FnMut(Progress),
+    {
         let mut all_trades = TradeResponse {
             count: 0,
             list: Vec::new(),
@@ -845,6 +2298,10 @@ impl Client {
             let mut new_list = resp.list;
             new_list.append(&mut all_trades.list);
             all_trades.list = new_list;
+            on_progress(Progress {
+                fetched: all_trades.list.len(),
+                total: None,
+            });
 
             if resp.count < batch_size {
                 break;
@@ -864,7 +2321,7 @@ impl Client {
         start: u16,
         count: u16,
     ) -> Result<TradeResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = HistoryTradeMsg::request(self.next_msg_id(), date, &code, start, count)?;
         let response = self.send_frame(frame).await?;
         let cache = TradeCache {
@@ -919,8 +2376,11 @@ impl Client {
     // ==================== 集合竞价 ====================
 
     /// 获取集合竞价数据
+    ///
+    /// 返回当天开盘集合竞价期间按时间排列的快照，每条包含虚拟开盘价和可匹配量，
+    /// 可用于在 09:25 前预估开盘跳空
     pub async fn get_call_auction(&self, code: &str) -> Result<CallAuctionResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = CallAuctionMsg::request(self.next_msg_id(), &code)?;
         let response = self.send_frame(frame).await?;
         let auction = CallAuctionMsg::decode_response(response.data())?;
@@ -931,13 +2391,223 @@ impl Client {
 
     /// 获取股本变迁/除权除息数据
     pub async fn get_gbbq(&self, code: &str) -> Result<GbbqResponse, ClientError> {
-        let code = add_prefix(code);
+        let code = qualify_code(code)?;
         let frame = GbbqMsg::request(self.next_msg_id(), &code)?;
         let response = self.send_frame(frame).await?;
         let gbbq = GbbqMsg::decode_response(response.data())?;
         Ok(gbbq)
     }
 
+    // ==================== 财务数据 ====================
+
+    /// 获取财务信息
+    pub async fn get_finance_info(&self, code: &str) -> Result<FinanceInfo, ClientError> {
+        let code = qualify_code(code)?;
+        let frame = FinanceInfoMsg::request(self.next_msg_id(), &code)?;
+        let response = self.send_frame(frame).await?;
+        let info = FinanceInfoMsg::decode_response(response.data())?;
+        Ok(info)
+    }
+
+    /// 获取上市日期（Unix 时间戳，秒），指数或上市日期未知时返回 None
+    pub async fn get_ipo_time(&self, code: &str) -> Result<Option<i64>, ClientError> {
+        if is_index(code) {
+            return Ok(None);
+        }
+        let info = self.get_finance_info(code).await?;
+        Ok(info.ipo_time())
+    }
+
+    /// 用于截断历史数据的上市时间
+    ///
+    /// 只查询股票，ETF、债券、基金和指数返回 None；结果按代码缓存，获取失败时返回 None 且不缓存
+    pub(crate) async fn ipo_floor(&self, code: &str) -> Option<i64> {
+        let code = qualify_code(code).ok()?;
+        if !is_stock(&code) {
+            return None;
+        }
+        if let Some(time) = self
+            .ipo_times
+            .lock()
+            .ok()
+            .and_then(|times| times.get(&code).copied())
+        {
+            return time;
+        }
+        match self.get_ipo_time(&code).await {
+            Ok(time) => {
+                if let Ok(mut times) = self.ipo_times.lock() {
+                    times.insert(code, time);
+                }
+                time
+            }
+            Err(e) => {
+                debug!("获取上市日期失败，不截断: {} ({})", code, e);
+                None
+            }
+        }
+    }
+
+    // ==================== 板块 ====================
+
+    /// 获取板块文件信息
+    pub async fn get_block_meta(&self, file: BlockFile) -> Result<BlockMeta, ClientError> {
+        let frame = BlockMsg::meta_request(self.next_msg_id(), file.file_name());
+        let response = self.send_frame(frame).await?;
+        let meta = BlockMsg::decode_meta_response(response.data())?;
+        Ok(meta)
+    }
+
+    /// 下载并解析板块文件
+    pub async fn get_block(&self, file: BlockFile) -> Result<Vec<Block>, ClientError> {
+        let meta = self.get_block_meta(file).await?;
+        let mut content = Vec::with_capacity(meta.size as usize);
+
+        while (content.len() as u32) < meta.size {
+            let start = content.len() as u32;
+            let size = BlockMsg::CHUNK_SIZE.min(meta.size - start);
+            let frame = BlockMsg::request(self.next_msg_id(), file.file_name(), start, size);
+            let response = self.send_frame(frame).await?;
+            let chunk = BlockMsg::decode_response(response.data())?;
+            if chunk.is_empty() {
+                break;
+            }
+            content.extend_from_slice(&chunk);
+        }
+
+        if content.is_empty() {
+            return Ok(Vec::new());
+        }
+        let blocks = BlockMsg::parse_file(&content)?;
+        Ok(blocks)
+    }
+
+    /// 查询股票所属的板块（概念、风格、指数板块）
+    ///
+    /// 首次调用时下载板块文件并构建 代码 -> 板块 的反向索引，之后直接查询缓存；
+    /// 并发的首次调用只下载一次。板块文件中的成分股是不带前缀的A股代码，索引按
+    /// [`add_prefix`] 补全交易所，因此 sh000001（上证指数）不会查到平安银行的板块。
+    /// 行业板块（tdxhy.cfg）和地域板块不在这些板块文件中，暂不支持
+    pub async fn blocks_for_code(&self, code: &str) -> Result<Vec<BlockMembership>, ClientError> {
+        let code = qualify_code(code)?;
+        let index = self.block_index().await?;
+        Ok(index.get(&code).cloned().unwrap_or_default())
+    }
+
+    /// 重新下载板块文件并重建反向索引
+    pub async fn rebuild_block_index(&self) -> Result<(), ClientError> {
+        let mut guard = self.block_index.lock().await;
+        *guard = Some(Arc::new(self.build_block_index().await?));
+        Ok(())
+    }
+
+    async fn block_index(&self) -> Result<Arc<HashMap<String, Vec<BlockMembership>>>, ClientError> {
+        // 构建期间持有锁，并发的首次调用等待同一次下载
+        let mut guard = self.block_index.lock().await;
+        if let Some(index) = guard.as_ref() {
+            return Ok(index.clone());
+        }
+        let index = Arc::new(self.build_block_index().await?);
+        *guard = Some(index.clone());
+        Ok(index)
+    }
+
+    async fn build_block_index(
+        &self,
+    ) -> Result<HashMap<String, Vec<BlockMembership>>, ClientError> {
+        let mut index: HashMap<String, Vec<BlockMembership>> = HashMap::new();
+        for file in [BlockFile::Concept, BlockFile::Style, BlockFile::Index] {
+            for block in self.get_block(file).await? {
+                for code in &block.codes {
+                    index
+                        .entry(add_prefix(code))
+                        .or_default()
+                        .push(BlockMembership {
+                            file,
+                            name: block.name.clone(),
+                            block_type: block.block_type,
+                        });
+                }
+            }
+        }
+        Ok(index)
+    }
+
+    /// 代码数量变化时重新下载代码列表，返回是否有市场的列表被更新
+    ///
+    /// 先查询各市场的代码数量并与缓存的列表长度比较，只有数量不同（或尚未缓存）
+    /// 的市场才重新下载，适合定时轮询新上市的证券。数量不变但内容变化
+    /// （如同时有上市和退市）时无法察觉。服务器不支持北京交易所时跳过该市场
+    pub async fn refresh_universe_if_changed(&self) -> Result<bool, ClientError> {
+        let mut changed = false;
+        for exchange in [Exchange::SZ, Exchange::SH, Exchange::BJ] {
+            let count = match self.get_count(exchange).await {
+                Ok(count) => count as usize,
+                Err(ClientError::Io(e)) if exchange == Exchange::BJ => {
+                    debug!("跳过北京交易所: {}", e);
+                    continue;
+                }
+                Err(e) => return Err(e),
+            };
+            let cached = self.code_lists.lock().await.get(&exchange).map(|c| c.len());
+            if cached == Some(count) {
+                continue;
+            }
+
+            debug!(
+                "{} 代码数量变化: {:?} -> {}",
+                exchange.as_str(),
+                cached,
+                count
+            );
+            let codes = self.get_code_all(exchange).await?.codes;
+            self.code_lists
+                .lock()
+                .await
+                .insert(exchange, Arc::new(codes));
+            changed = true;
+        }
+        Ok(changed)
+    }
+
+    /// 获取 `exchanges` 中不在 `known` 里的代码，用于检测新上市的证券
+    ///
+    /// `known` 中的代码须带交易所前缀（如 sh600000，大小写均可），按 [`qualify_code`]
+    /// 规范化后比较。服务器不支持北京交易所时跳过该市场
+    pub async fn new_listings(
+        &self,
+        exchanges: &[Exchange],
+        known: &HashSet<String>,
+    ) -> Result<Vec<(Exchange, StockCode)>, ClientError> {
+        let known = known
+            .iter()
+            .map(|c| qualify_code(c))
+            .collect::<Result<HashSet<_>, _>>()?;
+        let mut listings = Vec::new();
+        for &exchange in exchanges {
+            let codes = match self.get_code_all(exchange).await {
+                Ok(resp) => resp.codes,
+                Err(ClientError::Io(e)) if exchange == Exchange::BJ => {
+                    debug!("跳过北京交易所: {}", e);
+                    continue;
+                }
+                Err(e) => return Err(e),
+            };
+            listings.extend(
+                codes
+                    .into_iter()
+                    .filter(|c| !known.contains(&format!("{}{}", exchange.as_str(), c.code)))
+                    .map(|c| (exchange, c)),
+            );
+        }
+        Ok(listings)
+    }
+
+    /// 获取 [`Client::refresh_universe_if_changed`] 缓存的代码列表，尚未下载时返回 None
+    pub async fn cached_code_list(&self, exchange: Exchange) -> Option<Arc<Vec<StockCode>>> {
+        self.code_lists.lock().await.get(&exchange).cloned()
+    }
+
     /// 获取下一个消息ID
     fn next_msg_id(&self) -> u32 {
         self.msg_id.fetch_add(1, Ordering::SeqCst) + 1
@@ -949,6 +2619,29 @@ impl Client {
     }
 }
 
+/// 演练模式下的空响应（数量为0的合法响应数据）
+fn dry_run_response(msg_id: u32, msg_type: MessageType) -> ResponseFrame {
+    let data = match msg_type {
+        MessageType::Connect => vec![0u8; 68],
+        MessageType::Heart => vec![],
+        MessageType::Quote => vec![0u8; 4],
+        MessageType::Minute | MessageType::HistoryMinute | MessageType::HistoryMinuteTrade => {
+            vec![0u8; 6]
+        }
+        MessageType::Gbbq => vec![0u8; 11],
+        MessageType::FinanceInfo => vec![0u8; 145],
+        MessageType::BlockMeta => vec![0u8; 38],
+        MessageType::BlockInfo => vec![0u8; 4],
+        MessageType::Count
+        | MessageType::Code
+        | MessageType::Kline
+        | MessageType::MinuteTrade
+        | MessageType::CallAuction => vec![0u8; 2],
+    };
+    let length = data.len() as u16;
+    ResponseFrame::new(PREFIX_RESP, 0x1C, msg_id, 0, msg_type, length, length, data)
+}
+
 impl Drop for Client {
     fn drop(&mut self) {}
 }
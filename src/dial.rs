@@ -2,6 +2,7 @@
 
 use crate::client::Client;
 use crate::client::ClientError;
+use crate::client::ClientOptions;
 use rand::rngs::StdRng;
 use rand::seq::SliceRandom;
 use rand::SeedableRng;
@@ -30,6 +31,11 @@ pub async fn dial(addr: &str) -> Result<Client, ClientError> {
     Client::connect(addr).await
 }
 
+/// 使用指定配置连接到地址
+pub async fn dial_with(addr: &str, options: ClientOptions) -> Result<Client, ClientError> {
+    Client::connect_with(addr, options).await
+}
+
 /// 遍历多个地址进行连接，成功则返回
 pub async fn dial_hosts_range(hosts: &[&str]) -> Result<Client, ClientError> {
     let hosts = if hosts.is_empty() {
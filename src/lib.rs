@@ -1,10 +1,35 @@
+pub mod cache;
+pub mod capture;
 pub mod client;
 pub mod dial;
+pub mod metrics;
+pub mod pipeline;
 pub mod protocol;
+pub mod sink;
+pub mod subscribe;
+pub mod transport;
+pub mod universe;
 
-pub use client::{Client, ClientError};
-pub use dial::{dial, dial_default, dial_hosts_random, dial_hosts_range, fast_hosts, DialResult};
+pub use cache::KlineFileCache;
+pub use capture::{CapturedFrame, RawCapture, RawCaptureConfig};
+pub use client::{
+    Client, ClientError, ClientOptions, Clock, Decompressor, ErrorKind, HealthReport,
+    NoticeHandler, Progress, ReconnectBackoff, RehandshakePolicy, RehandshakePredicate,
+    RequestHook, TimeSource,
+};
+pub use dial::{
+    dial, dial_default, dial_hosts_random, dial_hosts_range, dial_with, fast_hosts, DialResult,
+};
+pub use metrics::{Metrics, MetricsSnapshot};
+pub use pipeline::{Pipeline, PipelineResults, Slot, StockDetail};
 pub use protocol::*;
+pub use sink::{Sink, SinkError, SinkFuture};
+pub use subscribe::{
+    KlineEvent, KlineSubscription, KlineUpdate, ReconnectSchedule, ScheduledReconnect,
+    SubscribeOptions,
+};
+pub use transport::{ConnectFuture, Connector, Transport};
+pub use universe::{SecurityKind, SecurityRecord};
 
 // 重新导出 log 宏供用户使用
 pub use log;
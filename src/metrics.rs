@@ -0,0 +1,121 @@
+//! 客户端运行指标
+
+use serde_json::{Map, Value};
+use std::collections::BTreeMap;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Mutex;
+use std::time::Duration;
+
+/// 往返耗时直方图的桶上限（毫秒），最后一个桶记录超过最大上限的请求
+pub const RTT_BUCKETS_MS: [u64; 6] = [10, 50, 100, 500, 1000, 5000];
+
+/// 客户端运行指标（线程安全，只增不减）
+#[derive(Debug, Default)]
+pub struct Metrics {
+    requests: Mutex<BTreeMap<u16, u64>>,
+    errors: AtomicU64,
+    reconnects: AtomicU64,
+    bytes_sent: AtomicU64,
+    bytes_received: AtomicU64,
+    rtt_buckets: [AtomicU64; RTT_BUCKETS_MS.len() + 1],
+}
+
+/// 指标快照
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct MetricsSnapshot {
+    pub requests: BTreeMap<u16, u64>, // 按消息类型统计的请求数
+    pub errors: u64,                  // 请求失败次数
+    pub reconnects: u64,              // 重连成功次数
+    pub bytes_sent: u64,              // 发送字节数
+    pub bytes_received: u64,          // 接收字节数（压缩后）
+    pub rtt_buckets: Vec<u64>,        // 往返耗时分布，与 RTT_BUCKETS_MS 对应，多出的一个为超出部分
+}
+
+impl Metrics {
+    /// 记录一次请求的消息类型和往返耗时
+    pub fn record_request(&self, msg_type: u16, rtt: Duration) {
+        if let Ok(mut requests) = self.requests.lock() {
+            *requests.entry(msg_type).or_insert(0) += 1;
+        }
+        let ms = rtt.as_millis() as u64;
+        let bucket = RTT_BUCKETS_MS
+            .iter()
+            .position(|&limit| ms <= limit)
+            .unwrap_or(RTT_BUCKETS_MS.len());
+        self.rtt_buckets[bucket].fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// 记录一次失败的请求
+    pub fn record_error(&self) {
+        self.errors.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// 记录一次重连
+    pub fn record_reconnect(&self) {
+        self.reconnects.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// 记录发送的字节数
+    pub fn record_sent(&self, bytes: usize) {
+        self.bytes_sent.fetch_add(bytes as u64, Ordering::Relaxed);
+    }
+
+    /// 记录接收的字节数
+    pub fn record_received(&self, bytes: usize) {
+        self.bytes_received
+            .fetch_add(bytes as u64, Ordering::Relaxed);
+    }
+
+    /// 获取当前指标的快照
+    pub fn snapshot(&self) -> MetricsSnapshot {
+        MetricsSnapshot {
+            requests: self.requests.lock().map(|r| r.clone()).unwrap_or_default(),
+            errors: self.errors.load(Ordering::Relaxed),
+            reconnects: self.reconnects.load(Ordering::Relaxed),
+            bytes_sent: self.bytes_sent.load(Ordering::Relaxed),
+            bytes_received: self.bytes_received.load(Ordering::Relaxed),
+            rtt_buckets: self
+                .rtt_buckets
+                .iter()
+                .map(|b| b.load(Ordering::Relaxed))
+                .collect(),
+        }
+    }
+}
+
+impl MetricsSnapshot {
+    /// 转换为以 `prefix` 为键前缀的 JSON 对象，便于直接输出到调试接口
+    ///
+    /// 请求数的键为 `{prefix}.requests.0x{类型}`，耗时分布的键为 `{prefix}.rtt_ms.le_{上限}`
+    /// 和 `{prefix}.rtt_ms.inf`
+    pub fn to_json(&self, prefix: &str) -> Value {
+        let mut map = Map::new();
+        for (msg_type, count) in &self.requests {
+            map.insert(
+                format!("{}.requests.0x{:04X}", prefix, msg_type),
+                Value::from(*count),
+            );
+        }
+        map.insert(format!("{}.errors", prefix), Value::from(self.errors));
+        map.insert(
+            format!("{}.reconnects", prefix),
+            Value::from(self.reconnects),
+        );
+        map.insert(
+            format!("{}.bytes_sent", prefix),
+            Value::from(self.bytes_sent),
+        );
+        map.insert(
+            format!("{}.bytes_received", prefix),
+            Value::from(self.bytes_received),
+        );
+        for (i, count) in self.rtt_buckets.iter().enumerate() {
+            let key = match RTT_BUCKETS_MS.get(i) {
+                Some(limit) => format!("{}.rtt_ms.le_{}", prefix, limit),
+                None => format!("{}.rtt_ms.inf", prefix),
+            };
+            map.insert(key, Value::from(*count));
+        }
+        Value::Object(map)
+    }
+}
@@ -0,0 +1,223 @@
+//! 批量请求（一次发送多个请求，按顺序读取响应）
+
+use crate::client::{Client, ClientError};
+use crate::protocol::*;
+use std::any::Any;
+use std::marker::PhantomData;
+
+type Decoder = Box<dyn Fn(&[u8]) -> Result<Box<dyn Any + Send>, MessageError> + Send>;
+
+/// 批量请求中某个请求的结果句柄，用于从 [`PipelineResults`] 中取出对应类型的结果
+pub struct Slot<T> {
+    index: usize,
+    _marker: PhantomData<T>,
+}
+
+/// 批量请求构建器
+///
+/// ```ignore
+/// let mut p = client.pipeline();
+/// let count = p.count(Exchange::SZ);
+/// let quotes = p.quote(&["sz000001".to_string()])?;
+/// let mut results = p.execute().await?;
+/// let count = results.take(count)?;
+/// let quotes = results.take(quotes)?;
+/// ```
+pub struct Pipeline<'a> {
+    client: &'a Client,
+    frames: Vec<RequestFrame>,
+    decoders: Vec<Decoder>,
+}
+
+/// 批量请求的结果
+pub struct PipelineResults {
+    values: Vec<Option<Result<Box<dyn Any + Send>, MessageError>>>,
+}
+
+impl<'a> Pipeline<'a> {
+    /// 添加请求帧及其解码函数
+    pub fn push<T, F>(&mut self, frame: RequestFrame, decode: F) -> Slot<T>
+    where
+        T: Send + 'static,
+        F: Fn(&[u8]) -> Result<T, MessageError> + Send + 'static,
+    {
+        self.frames.push(frame);
+        self.decoders.push(Box::new(move |data| {
+            decode(data).map(|v| Box::new(v) as Box<dyn Any + Send>)
+        }));
+        Slot {
+            index: self.frames.len() - 1,
+            _marker: PhantomData,
+        }
+    }
+
+    /// 已添加的请求数量
+    pub fn len(&self) -> usize {
+        self.frames.len()
+    }
+
+    /// 是否没有请求
+    pub fn is_empty(&self) -> bool {
+        self.frames.is_empty()
+    }
+
+    /// 获取股票数量
+    pub fn count(&mut self, exchange: Exchange) -> Slot<u16> {
+        self.push(Count::request(0, exchange), Count::decode_response)
+    }
+
+    /// 获取股票代码列表（单次最多1000条）
+    pub fn code(&mut self, exchange: Exchange, start: u16) -> Slot<CodeResponse> {
+        self.push(Code::request(0, exchange, start), Code::decode_response)
+    }
+
+    /// 获取行情信息
+    pub fn quote(&mut self, codes: &[String]) -> Result<Slot<Vec<QuoteInfo>>, MessageError> {
+        Ok(self.push(Quote::request(0, codes)?, Quote::decode_response))
+    }
+
+    /// 获取K线数据（单次最多800条）
+    pub fn kline(
+        &mut self,
+        kline_type: KlineType,
+        code: &str,
+        start: u16,
+        count: u16,
+    ) -> Result<Slot<KlineResponse>, MessageError> {
+        let code = qualify_code(code)?;
+        let frame = KlineMsg::request(0, kline_type, &code, start, count)?;
+        let cache = KlineCache::new(kline_type, &code);
+        Ok(self.push(frame, move |data| KlineMsg::decode_response(data, cache)))
+    }
+
+    /// 获取当日分时数据，时间按 [`Client::now`] 所在日期构造
+    pub fn minute(&mut self, code: &str) -> Result<Slot<MinuteResponse>, MessageError> {
+        let code = qualify_code(code)?;
+        let frame = MinuteMsg::request(0, &code)?;
+        let date = self.client.today_str();
+        Ok(self.push(frame, move |data| {
+            MinuteMsg::decode_response(data, &date, &code)
+        }))
+    }
+
+    /// 获取历史分时数据，date格式：YYYYMMDD
+    pub fn history_minute(
+        &mut self,
+        date: &str,
+        code: &str,
+    ) -> Result<Slot<MinuteResponse>, MessageError> {
+        let code = qualify_code(code)?;
+        let frame = HistoryMinuteMsg::request(0, date, &code)?;
+        let date = date.to_string();
+        Ok(self.push(frame, move |data| {
+            HistoryMinuteMsg::decode_response(data, &date, &code)
+        }))
+    }
+
+    /// 获取除权除息数据
+    pub fn gbbq(&mut self, code: &str) -> Result<Slot<GbbqResponse>, MessageError> {
+        let frame = GbbqMsg::request(0, &qualify_code(code)?)?;
+        Ok(self.push(frame, GbbqMsg::decode_response))
+    }
+
+    /// 获取财务信息
+    pub fn finance_info(&mut self, code: &str) -> Result<Slot<FinanceInfo>, MessageError> {
+        let frame = FinanceInfoMsg::request(0, &qualify_code(code)?)?;
+        Ok(self.push(frame, FinanceInfoMsg::decode_response))
+    }
+
+    /// 发送全部请求并解码响应
+    ///
+    /// 网络错误会使整批失败；单个响应的解码错误只影响该请求的结果
+    pub async fn execute(self) -> Result<PipelineResults, ClientError> {
+        let responses = self.client.send_frames(self.frames).await?;
+        let values = responses
+            .iter()
+            .zip(self.decoders.iter())
+            .map(|(response, decode)| Some(decode(response.data())))
+            .collect();
+        Ok(PipelineResults { values })
+    }
+}
+
+impl PipelineResults {
+    /// 取出某个请求的结果，每个句柄只能取一次
+    pub fn take<T: 'static>(&mut self, slot: Slot<T>) -> Result<T, ClientError> {
+        let value = self
+            .values
+            .get_mut(slot.index)
+            .and_then(Option::take)
+            .ok_or_else(|| ClientError::Other(format!("批量请求结果不存在: {}", slot.index)))?;
+        let value = value?;
+        value
+            .downcast::<T>()
+            .map(|v| *v)
+            .map_err(|_| ClientError::Other(format!("批量请求结果类型不符: {}", slot.index)))
+    }
+}
+
+/// 个股详情：实时行情与当日分时
+///
+/// 两部分独立解码，失败的部分为 None，对应的错误保存在 `errors` 中
+#[derive(Debug)]
+pub struct StockDetail {
+    pub code: String,                   // 带交易所前缀的代码
+    pub quote: Option<QuoteInfo>,       // 实时行情
+    pub minute: Option<MinuteResponse>, // 当日分时
+    pub errors: Vec<ClientError>,       // 失败部分的错误
+}
+
+impl StockDetail {
+    /// 行情和分时是否都获取成功
+    pub fn is_complete(&self) -> bool {
+        self.quote.is_some() && self.minute.is_some()
+    }
+}
+
+impl Client {
+    /// 创建批量请求
+    pub fn pipeline(&self) -> Pipeline<'_> {
+        Pipeline {
+            client: self,
+            frames: Vec::new(),
+            decoders: Vec::new(),
+        }
+    }
+    /// 获取个股详情（实时行情与当日分时）
+    ///
+    /// 两个请求在同一连接上连续发送，只需一次网络往返。网络错误时整体返回错误；
+    /// 单个部分解码失败或服务器未返回行情时，返回其余成功的部分和对应的错误
+    pub async fn get_detail(&self, code: &str) -> Result<StockDetail, ClientError> {
+        let code = qualify_code(code)?;
+
+        let mut p = self.pipeline();
+        let quote = p.quote(&[code.clone()])?;
+        let minute = p.minute(&code)?;
+        let mut results = p.execute().await?;
+
+        let mut errors = Vec::new();
+        let quote = match results.take(quote) {
+            Ok(quotes) => {
+                let quote = quotes
+                    .into_iter()
+                    .find(|q| format!("{}{}", q.exchange.as_str(), q.code) == code);
+                if quote.is_none() {
+                    errors.push(ClientError::Other(format!("未返回行情: {}", code)));
+                }
+                quote
+            }
+            Err(e) => {
+                errors.push(e);
+                None
+            }
+        };
+        let minute = results.take(minute).map_err(|e| errors.push(e)).ok();
+
+        Ok(StockDetail {
+            code,
+            quote,
+            minute,
+            errors,
+        })
+    }
+}
@@ -0,0 +1,62 @@
+//! 股票代码格式转换
+
+use crate::protocol::{
+    constants::Exchange,
+    messages::{decode_code, MessageError},
+};
+
+/// 股票代码格式
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum CodeStyle {
+    Prefix,      // sh600000（通达信/新浪）
+    UpperPrefix, // SH600000
+    Suffix,      // 600000.SH
+    Yahoo,       // 600000.SS（上海为 SS，深圳 SZ，北京 BJ）
+}
+
+/// 按指定格式输出股票代码
+///
+/// `code` 可以是任意支持的格式，但必须带交易所
+pub fn format_code(code: &str, style: CodeStyle) -> Result<String, MessageError> {
+    let (exchange, number) = parse_code_flexible(code)?;
+    let prefix = exchange.as_str();
+    Ok(match style {
+        CodeStyle::Prefix => format!("{}{}", prefix, number),
+        CodeStyle::UpperPrefix => format!("{}{}", prefix.to_uppercase(), number),
+        CodeStyle::Suffix => format!("{}.{}", number, prefix.to_uppercase()),
+        CodeStyle::Yahoo => {
+            let suffix = match exchange {
+                Exchange::SH => "SS",
+                Exchange::SZ => "SZ",
+                Exchange::BJ => "BJ",
+            };
+            format!("{}.{}", number, suffix)
+        }
+    })
+}
+
+/// 解析任意常见格式的股票代码，返回交易所和6位代码
+///
+/// 支持 sh600000、SH600000、600000.SH、600000.SS；不带交易所的 600000 返回
+/// [`MessageError::AmbiguousCode`]
+pub fn parse_code_flexible(code: &str) -> Result<(Exchange, String), MessageError> {
+    let code = code.trim().to_lowercase();
+    let normalized = match code.split_once('.') {
+        Some((number, suffix)) => {
+            let prefix = match suffix {
+                "sh" | "ss" => "sh",
+                "sz" => "sz",
+                "bj" => "bj",
+                _ => return Err(MessageError::InvalidCode(code.clone())),
+            };
+            format!("{}{}", prefix, number)
+        }
+        None => code.clone(),
+    };
+
+    let (exchange, number) = decode_code(&normalized)?;
+    if number.len() != 6 || !number.bytes().all(|b| b.is_ascii_digit()) {
+        return Err(MessageError::InvalidCode(code));
+    }
+    Ok((exchange, number))
+}
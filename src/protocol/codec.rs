@@ -1,6 +1,6 @@
 //! 数据编码/解码工具函数
 
-use crate::protocol::types::Price;
+use crate::protocol::{messages::MessageError, types::Price};
 use encoding_rs::GBK;
 use std::io::{self, Read};
 
@@ -62,16 +62,20 @@ pub fn decode_varint(bytes: &[u8]) -> (i32, usize) {
         return (0, 0);
     }
 
-    let mut data: i32 = 0;
+    // 用 i64 累加，超过32位的高位直接丢弃，避免移位溢出
+    let mut data: i64 = 0;
     let mut consumed = 0;
 
     for (i, &byte) in bytes.iter().enumerate() {
         if i == 0 {
             // 第一字节：取低6位
-            data += (byte & 0x3F) as i32;
+            data += (byte & 0x3F) as i64;
         } else {
             // 后续字节：取低7位，左移相应位数
-            data += ((byte & 0x7F) as i32) << (6 + (i - 1) * 7);
+            let shift = 6 + (i - 1) * 7;
+            if shift < 32 {
+                data |= ((byte & 0x7F) as i64) << shift;
+            }
         }
 
         consumed += 1;
@@ -83,17 +87,18 @@ pub fn decode_varint(bytes: &[u8]) -> (i32, usize) {
     }
 
     // 第一字节的第6位为1表示负数
-    if !bytes.is_empty() && bytes[0] & 0x40 > 0 {
+    if bytes[0] & 0x40 > 0 {
         data = -data;
     }
 
-    (data, consumed)
+    (data as i32, consumed)
 }
 
 /// 编码变长整数
 pub fn encode_varint(value: i32) -> Vec<u8> {
     let mut result = Vec::new();
-    let mut val = value.abs();
+    // i32::MIN 的绝对值超出 i32 范围，使用 u32
+    let mut val = value.unsigned_abs();
 
     // 第一字节
     let mut first_byte = (val & 0x3F) as u8;
@@ -180,7 +185,9 @@ pub fn decode_volume(bytes: &[u8]) -> f64 {
     }
 }
 
-/// 解析成交量（变体2）
+/// 解析成交量（变体2），成交额也使用该编码
+///
+/// 结果可超过 2^32（如指数、全市场的成交额），应保存为 f64 或 i64，不能转换为32位整数
 pub fn decode_volume2(bytes: &[u8]) -> f64 {
     if bytes.len() < 4 {
         return 0.0;
@@ -236,3 +243,89 @@ pub fn read_full_frame<R: Read>(reader: &mut R) -> io::Result<Vec<u8>> {
         }
     }
 }
+
+/// 字节读取器
+///
+/// 按顺序读取响应数据中的各种字段，数据不足时返回 [`MessageError::InsufficientData`]，
+/// 不会越界或 panic
+#[derive(Debug, Clone)]
+pub struct ByteReader<'a> {
+    data: &'a [u8],
+    pos: usize,
+}
+
+impl<'a> ByteReader<'a> {
+    /// 创建读取器
+    pub fn new(data: &'a [u8]) -> Self {
+        Self { data, pos: 0 }
+    }
+
+    /// 当前位置
+    pub fn position(&self) -> usize {
+        self.pos
+    }
+
+    /// 剩余未读取的字节数
+    pub fn remaining(&self) -> usize {
+        self.data.len() - self.pos
+    }
+
+    /// 跳过 n 个字节
+    pub fn skip(&mut self, n: usize) -> Result<(), MessageError> {
+        self.read_bytes(n).map(|_| ())
+    }
+
+    /// 读取 n 个字节
+    pub fn read_bytes(&mut self, n: usize) -> Result<&'a [u8], MessageError> {
+        if self.remaining() < n {
+            return Err(MessageError::InsufficientData);
+        }
+        let bytes = &self.data[self.pos..self.pos + n];
+        self.pos += n;
+        Ok(bytes)
+    }
+
+    /// 读取 u8
+    pub fn read_u8(&mut self) -> Result<u8, MessageError> {
+        Ok(self.read_bytes(1)?[0])
+    }
+
+    /// 读取小端序 u16
+    pub fn read_u16(&mut self) -> Result<u16, MessageError> {
+        Ok(bytes_to_u16_le(self.read_bytes(2)?))
+    }
+
+    /// 读取小端序 u32
+    pub fn read_u32(&mut self) -> Result<u32, MessageError> {
+        Ok(bytes_to_u32_le(self.read_bytes(4)?))
+    }
+
+    /// 读取变长整数
+    pub fn read_varint(&mut self) -> Result<i32, MessageError> {
+        let rest = &self.data[self.pos..];
+        // 最后一个字节必须没有继续位，否则数据被截断
+        match rest.iter().position(|b| b & 0x80 == 0) {
+            Some(end) => {
+                let (value, consumed) = decode_varint(&rest[..=end]);
+                self.pos += consumed;
+                Ok(value)
+            }
+            None => Err(MessageError::InsufficientData),
+        }
+    }
+
+    /// 读取变长编码的价格
+    pub fn read_price(&mut self) -> Result<Price, MessageError> {
+        Ok(Price(self.read_varint()? as i64))
+    }
+
+    /// 读取4字节浮点编码的成交量
+    pub fn read_volume(&mut self) -> Result<f64, MessageError> {
+        Ok(decode_volume(self.read_bytes(4)?))
+    }
+
+    /// 读取4字节浮点编码的成交量（变体2）
+    pub fn read_volume2(&mut self) -> Result<f64, MessageError> {
+        Ok(decode_volume2(self.read_bytes(4)?))
+    }
+}
@@ -7,12 +7,15 @@ pub const PREFIX: u8 = 0x0C;
 pub const PREFIX_RESP: u32 = 0xB1CB7400;
 
 /// 消息类型常量
+///
+/// 标准行情协议没有龙虎榜（席位买卖）等数据的消息类型
 #[repr(u16)]
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub enum MessageType {
     Connect = 0x000D,            // 建立连接
     Heart = 0x0004,              // 心跳
     Gbbq = 0x000F,               // 除权除息
+    FinanceInfo = 0x0010,        // 财务信息
     Count = 0x044E,               // 获取股票数量
     Code = 0x0450,                // 获取股票代码
     Quote = 0x053E,               // 行情信息
@@ -22,6 +25,8 @@ pub enum MessageType {
     HistoryMinute = 0x0FB4,       // 历史分时数据
     HistoryMinuteTrade = 0x0FB5,  // 历史分时交易
     Kline = 0x052D,               // K线图
+    BlockMeta = 0x02C5,           // 板块文件信息
+    BlockInfo = 0x06B9,           // 板块文件内容
 }
 
 impl MessageType {
@@ -34,6 +39,7 @@ impl MessageType {
             0x000D => Some(MessageType::Connect),
             0x0004 => Some(MessageType::Heart),
             0x000F => Some(MessageType::Gbbq),
+            0x0010 => Some(MessageType::FinanceInfo),
             0x044E => Some(MessageType::Count),
             0x0450 => Some(MessageType::Code),
             0x053E => Some(MessageType::Quote),
@@ -43,9 +49,23 @@ impl MessageType {
             0x0FB4 => Some(MessageType::HistoryMinute),
             0x0FB5 => Some(MessageType::HistoryMinuteTrade),
             0x052D => Some(MessageType::Kline),
+            0x02C5 => Some(MessageType::BlockMeta),
+            0x06B9 => Some(MessageType::BlockInfo),
             _ => None,
         }
     }
+
+    /// 解析十六进制的类型值（如测试数据中的 `type_value` 字段 "0x000D"）
+    ///
+    /// `0x` 前缀可省略，不区分大小写；不是已知的消息类型时返回 None
+    pub fn from_type_value(s: &str) -> Option<Self> {
+        let s = s.trim();
+        let hex = s
+            .strip_prefix("0x")
+            .or_else(|| s.strip_prefix("0X"))
+            .unwrap_or(s);
+        u16::from_str_radix(hex, 16).ok().and_then(Self::from_u16)
+    }
 }
 
 /// K线类型
@@ -67,8 +87,11 @@ pub enum KlineType {
 }
 
 /// 交易所类型
+///
+/// 标准行情服务器（端口7709）只提供沪深北三个市场。港股、港股通、美股等
+/// 属于扩展行情服务器（端口7727），使用不同的市场编号和报文格式，本库暂不支持
 #[repr(u8)]
-#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
 pub enum Exchange {
     SZ = 0,  // 深圳交易所
     SH = 1,  // 上海交易所
@@ -106,6 +129,35 @@ impl Exchange {
     }
 }
 
+/// 板块文件
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum BlockFile {
+    Default, // 综合板块
+    Index,   // 指数板块
+    Style,   // 风格板块
+    Concept, // 概念板块
+}
+
+impl BlockFile {
+    pub fn file_name(self) -> &'static str {
+        match self {
+            BlockFile::Default => "block.dat",
+            BlockFile::Index => "block_zs.dat",
+            BlockFile::Style => "block_fg.dat",
+            BlockFile::Concept => "block_gn.dat",
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            BlockFile::Default => "综合",
+            BlockFile::Index => "指数",
+            BlockFile::Style => "风格",
+            BlockFile::Concept => "概念",
+        }
+    }
+}
+
 /// 控制码
 #[repr(u8)]
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
@@ -1,13 +1,22 @@
 //! 协议帧格式定义和编解码
 
 use crate::protocol::{
-    constants::{Control, MessageType, PREFIX},
     codec::{bytes_to_u16_le, bytes_to_u32_le, u16_to_bytes_le, u32_to_bytes_le},
+    constants::{Control, MessageType, PREFIX, PREFIX_RESP},
 };
 use flate2::read::ZlibDecoder;
-use std::io::Read;
+use std::io::{self, Read};
 use thiserror::Error;
 
+/// 默认的最大帧长度
+///
+/// 帧头中的压缩长度和解压长度都是 u16，协议本身限制单帧数据域不超过 65535 字节，
+/// 默认值即为该上限（不额外限制）；需要拒绝异常大的响应时设置更小的值
+pub const DEFAULT_MAX_FRAME_SIZE: usize = u16::MAX as usize;
+
+/// 错误响应的控制码（成功为 0x1C）
+pub const CONTROL_ERROR: u8 = 0x0C;
+
 /// 请求帧
 #[derive(Debug, Clone)]
 pub struct RequestFrame {
@@ -96,6 +105,16 @@ impl RequestFrame {
     }
 }
 
+/// 原始响应帧（数据已解压），消息类型不限于 [`MessageType`]
+#[derive(Debug, Clone)]
+pub struct RawFrame {
+    pub control: u8,
+    pub msg_id: u32,
+    pub unknown: u8,
+    pub msg_type: u16,
+    pub data: Vec<u8>,
+}
+
 /// 响应帧
 #[derive(Debug, Clone)]
 pub struct ResponseFrame {
@@ -108,6 +127,7 @@ pub struct ResponseFrame {
     pub length: u16,
     pub data: Vec<u8>,
     decompressed: bool,
+    compressed: Option<Vec<u8>>,
 }
 
 impl ResponseFrame {
@@ -132,23 +152,29 @@ impl ResponseFrame {
             length,
             data,
             decompressed: false,
+            compressed: None,
         }
     }
 
     /// 解压数据
     pub fn decompress(&mut self) -> Result<(), FrameError> {
+        self.decompress_with(inflate)
+    }
+
+    /// 使用指定的解压函数解压数据（参数为压缩数据和声明的解压长度）
+    pub fn decompress_with<F>(&mut self, decompress: F) -> Result<(), FrameError>
+    where
+        F: Fn(&[u8], u16) -> Result<Vec<u8>, FrameError>,
+    {
         if self.decompressed {
             return Ok(());
         }
 
         // 如果压缩长度 != 未压缩长度，需要解压
         if self.zip_length != self.length {
-            let mut decoder = ZlibDecoder::new(self.data.as_slice());
-            let mut decompressed = Vec::with_capacity(self.length as usize);
-            decoder
-                .read_to_end(&mut decompressed)
-                .map_err(|e| FrameError::DecompressionError(e.to_string()))?;
-            self.data = decompressed;
+            let decompressed = decompress(&self.data, self.length)?;
+            // 保留压缩数据，用于还原原始字节
+            self.compressed = Some(std::mem::replace(&mut self.data, decompressed));
         }
 
         // 验证解压后的数据长度
@@ -164,11 +190,34 @@ impl ResponseFrame {
     pub fn data(&self) -> &[u8] {
         &self.data
     }
+
+    /// 还原服务器发送的原始字节（帧头 + 压缩数据）
+    pub fn raw_bytes(&self) -> Vec<u8> {
+        let payload = self.compressed.as_deref().unwrap_or(&self.data);
+        let mut bytes = Vec::with_capacity(16 + payload.len());
+        bytes.extend_from_slice(&self.prefix.to_be_bytes());
+        bytes.push(self.control);
+        bytes.extend_from_slice(&u32_to_bytes_le(self.msg_id));
+        bytes.push(self.unknown);
+        bytes.extend_from_slice(&u16_to_bytes_le(self.msg_type.as_u16()));
+        bytes.extend_from_slice(&u16_to_bytes_le(self.zip_length));
+        bytes.extend_from_slice(&u16_to_bytes_le(self.length));
+        bytes.extend_from_slice(payload);
+        bytes
+    }
 }
 
 impl ResponseFrame {
     /// 从字节数组解码
     pub fn decode(bytes: &[u8]) -> Result<Self, FrameError> {
+        Self::decode_with_max(bytes, DEFAULT_MAX_FRAME_SIZE)
+    }
+
+    /// 从字节数组解码，声明的数据长度超过 `max_frame_size` 时返回 [`FrameError::FrameTooLarge`]
+    ///
+    /// 以帧头声明的压缩长度为准：其后多余的字节（部分服务器会填充到块边界）被忽略，
+    /// 数据不足声明长度时返回 [`FrameError::InsufficientData`]
+    pub fn decode_with_max(bytes: &[u8], max_frame_size: usize) -> Result<Self, FrameError> {
         if bytes.len() < 16 {
             return Err(FrameError::InsufficientData);
         }
@@ -183,11 +232,12 @@ impl ResponseFrame {
         let length = bytes_to_u16_le(&bytes[14..16]);
 
         // 检查帧头
-        use crate::protocol::constants::PREFIX_RESP;
         if prefix != PREFIX_RESP {
             return Err(FrameError::InvalidPrefix);
         }
 
+        check_frame_size(zip_length, length, max_frame_size)?;
+
         if bytes.len() < 16 + zip_length as usize {
             return Err(FrameError::InsufficientData);
         }
@@ -207,6 +257,7 @@ impl ResponseFrame {
             length,
             data,
             decompressed: false,
+            compressed: None,
         };
 
         // 解压数据
@@ -219,6 +270,162 @@ impl ResponseFrame {
     pub fn is_success(&self) -> bool {
         self.control & 0x10 == 0x10
     }
+
+    /// 是否为会话过期响应
+    ///
+    /// 长时间空闲后，服务器对下一个请求返回 control 为 0x0C、数据域为空的错误帧
+    /// （帧头 `B1CB7400 0C <MsgID> 00 <Type> 0000 0000`），此时连接未断开但会话已失效，
+    /// 需要重新握手。带数据的错误帧或其他不含成功标志的 control 不属于会话过期
+    pub fn is_session_expired(&self) -> bool {
+        self.control == CONTROL_ERROR && self.zip_length == 0 && self.length == 0
+    }
+}
+
+/// zlib 解压，输出不超过声明长度（多读1字节用于检测长度不符）
+pub fn inflate(data: &[u8], length: u16) -> Result<Vec<u8>, FrameError> {
+    let mut decoder = ZlibDecoder::new(data).take(length as u64 + 1);
+    let mut decompressed = Vec::with_capacity(length as usize);
+    decoder
+        .read_to_end(&mut decompressed)
+        .map_err(|e| FrameError::DecompressionError(e.to_string()))?;
+    Ok(decompressed)
+}
+
+/// 检查帧头声明的压缩/解压长度是否超过上限
+///
+/// 长度字段为 u16，单帧不会超过 65535 字节，上限不小于该值时不会触发
+pub fn check_frame_size(
+    zip_length: u16,
+    length: u16,
+    max_frame_size: usize,
+) -> Result<(), FrameError> {
+    let size = zip_length.max(length) as usize;
+    if size > max_frame_size {
+        return Err(FrameError::FrameTooLarge {
+            size,
+            max: max_frame_size,
+        });
+    }
+    Ok(())
+}
+
+/// 并行解码多个响应帧（如回放抓包数据），结果与输入顺序一致
+///
+/// 各帧独立解码，单帧出错不影响其余帧；`workers` 为 0 时使用可用的 CPU 核数
+pub fn decode_batch<T: AsRef<[u8]> + Sync>(
+    frames: &[T],
+    workers: usize,
+) -> Vec<Result<ResponseFrame, FrameError>> {
+    let workers = match workers {
+        0 => std::thread::available_parallelism().map_or(1, |n| n.get()),
+        n => n,
+    };
+    let decode = |chunk: &[T]| -> Vec<Result<ResponseFrame, FrameError>> {
+        chunk
+            .iter()
+            .map(|f| ResponseFrame::decode(f.as_ref()))
+            .collect()
+    };
+    if workers <= 1 || frames.len() <= 1 {
+        return decode(frames);
+    }
+
+    // 按连续区间分给各线程，依次拼接即保持输入顺序
+    let chunk_size = (frames.len() + workers - 1) / workers;
+    std::thread::scope(|scope| {
+        let handles: Vec<_> = frames
+            .chunks(chunk_size)
+            .map(|chunk| scope.spawn(move || decode(chunk)))
+            .collect();
+        handles
+            .into_iter()
+            .flat_map(|h| h.join().unwrap_or_else(|e| std::panic::resume_unwind(e)))
+            .collect()
+    })
+}
+
+/// 响应帧扫描器
+///
+/// 从字节流（如抓包文件）中逐个解析响应帧。帧之间无法识别的字节会被跳过，
+/// 扫描结束后可通过 [`FrameScanner::buffered`] 查看剩余未解析的字节，
+/// 用于区分末尾的填充字节与被截断的最后一帧
+pub struct FrameScanner<R: Read> {
+    reader: R,
+    buf: Vec<u8>,
+    eof: bool,
+    max_frame_size: usize,
+}
+
+impl<R: Read> FrameScanner<R> {
+    /// 帧头长度
+    const HEADER_SIZE: usize = 16;
+
+    /// 创建扫描器
+    pub fn new(reader: R) -> Self {
+        Self {
+            reader,
+            buf: Vec::new(),
+            eof: false,
+            max_frame_size: DEFAULT_MAX_FRAME_SIZE,
+        }
+    }
+
+    /// 设置最大帧长度
+    pub fn with_max_frame_size(mut self, max_frame_size: usize) -> Self {
+        self.max_frame_size = max_frame_size;
+        self
+    }
+
+    /// 扫描下一帧，数据读完时返回 None
+    pub fn scan(&mut self) -> Option<Result<ResponseFrame, FrameError>> {
+        let prefix = PREFIX_RESP.to_be_bytes();
+
+        loop {
+            // 跳过帧头之前无法识别的字节
+            if let Some(pos) = self.buf.windows(4).position(|w| w == prefix) {
+                self.buf.drain(..pos);
+
+                if self.buf.len() >= Self::HEADER_SIZE {
+                    let zip_length = bytes_to_u16_le(&self.buf[12..14]);
+                    let length = bytes_to_u16_le(&self.buf[14..16]);
+                    if let Err(e) = check_frame_size(zip_length, length, self.max_frame_size) {
+                        // 丢弃该帧头，继续扫描后续数据
+                        self.buf.drain(..4);
+                        return Some(Err(e));
+                    }
+                    let total = Self::HEADER_SIZE + zip_length as usize;
+                    if self.buf.len() >= total {
+                        let frame =
+                            ResponseFrame::decode_with_max(&self.buf[..total], self.max_frame_size);
+                        self.buf.drain(..total);
+                        return Some(frame);
+                    }
+                }
+            }
+
+            if self.eof {
+                return None;
+            }
+
+            let mut chunk = [0u8; 4096];
+            match self.reader.read(&mut chunk) {
+                Ok(0) => self.eof = true,
+                Ok(n) => self.buf.extend_from_slice(&chunk[..n]),
+                Err(e) if e.kind() == io::ErrorKind::Interrupted => {}
+                Err(e) => {
+                    self.eof = true;
+                    return Some(Err(FrameError::Io(e)));
+                }
+            }
+        }
+    }
+
+    /// 缓冲区中尚未解析的字节
+    ///
+    /// 在 [`FrameScanner::scan`] 返回 None 后调用，即为数据流末尾的残留字节
+    pub fn buffered(&self) -> &[u8] {
+        &self.buf
+    }
 }
 
 /// 帧错误类型
@@ -234,4 +441,8 @@ pub enum FrameError {
     UnknownMessageType(u16),
     #[error("解压错误: {0}")]
     DecompressionError(String),
+    #[error("IO错误: {0}")]
+    Io(#[from] io::Error),
+    #[error("帧长度 {size} 超过上限 {max}")]
+    FrameTooLarge { size: usize, max: usize },
 }
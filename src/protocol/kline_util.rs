@@ -0,0 +1,322 @@
+//! K线工具函数
+
+use crate::protocol::{
+    codec::bytes_to_u32_le,
+    constants::KlineType,
+    market::is_trading_day,
+    messages::MessageError,
+    types::{Kline, Price},
+};
+use chrono::{Datelike, Duration, FixedOffset, NaiveDate, TimeZone};
+use std::collections::HashSet;
+
+/// 合并周期
+///
+/// 与服务器的周/月/季/年K线一致，按北京时间的自然周期归并交易日
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ResamplePeriod {
+    Week,    // 周（周一至周日，跨年的一周不拆分）
+    Month,   // 月
+    Quarter, // 季
+    Year,    // 年
+}
+
+/// 获取K线所在的北京时间日期
+fn beijing_date(k: &Kline) -> Option<NaiveDate> {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    beijing_offset
+        .timestamp_opt(k.time, 0)
+        .single()
+        .map(|dt| dt.date_naive())
+}
+
+/// 计算K线所属周期的分组键
+///
+/// 周按交易日所在自然周的周一分组，不使用 ISO 周号：春节等长假中只有部分交易日的周
+/// 仍归到各自的周一，整周休市时前后两周不会合并
+fn period_key(k: &Kline, period: ResamplePeriod) -> (i32, u32) {
+    let date = match beijing_date(k) {
+        Some(date) => date,
+        None => return (0, 0),
+    };
+    match period {
+        ResamplePeriod::Week => {
+            let monday = date - Duration::days(date.weekday().num_days_from_monday() as i64);
+            (monday.year(), monday.ordinal())
+        }
+        ResamplePeriod::Month => (date.year(), date.month()),
+        ResamplePeriod::Quarter => (date.year(), (date.month() - 1) / 3),
+        ResamplePeriod::Year => (date.year(), 0),
+    }
+}
+
+/// 将日K线合并为周/月/季/年K线
+///
+/// 输入需按时间升序排列。成交量、成交额在整数空间累加（成交额单位为厘），
+/// 保证合并后的成交额严格等于各日成交额之和。合并后的时间为周期内最后一个交易日的时间，
+/// 与服务器K线相同；长假使某周只有部分交易日时只合并这些交易日，整周休市则没有该周K线
+pub fn resample_klines(daily: &[Kline], period: ResamplePeriod) -> Vec<Kline> {
+    let mut result: Vec<Kline> = Vec::new();
+    let mut current_key = None;
+
+    for k in daily {
+        let key = period_key(k, period);
+        match result.last_mut() {
+            Some(bar) if current_key == Some(key) => {
+                bar.high = bar.high.max(k.high);
+                bar.low = bar.low.min(k.low);
+                bar.close = k.close;
+                bar.order += k.order;
+                bar.volume += k.volume;
+                bar.amount = Price(bar.amount.as_i64() + k.amount.as_i64());
+                bar.time = k.time;
+                bar.up_count = k.up_count;
+                bar.down_count = k.down_count;
+            }
+            _ => {
+                current_key = Some(key);
+                result.push(k.clone());
+            }
+        }
+    }
+
+    result
+}
+
+/// 将更早的一页K线拼接到已获取的K线之前，返回实际加入的条数
+///
+/// 两页都按时间升序。分页请求期间服务器产生新K线时，相邻两页会在边界重叠，
+/// 这里按时间去掉 `older` 末尾不早于 `list` 第一根K线的部分
+pub fn merge_kline_page(list: &mut Vec<Kline>, mut older: Vec<Kline>) -> usize {
+    if let Some(first_time) = list.first().map(|k| k.time) {
+        let keep = older.partition_point(|k| k.time < first_time);
+        older.truncate(keep);
+    }
+    let added = older.len();
+    older.append(list);
+    *list = older;
+    added
+}
+
+/// 将同一交易日的分钟K线合并为日K线，用于与服务器的日K线相互校验
+///
+/// 输入需按时间升序排列且属于同一交易日，空输入返回 None。开盘价取第一根的开盘价，
+/// 时间为当天15:00（与日K线一致）；`last` 取第一根的 `last`，不一定是前一交易日的收盘价
+pub fn aggregate_intraday(bars: &[Kline]) -> Option<Kline> {
+    let first = bars.first()?;
+    let mut day = first.clone();
+    for k in &bars[1..] {
+        day.high = day.high.max(k.high);
+        day.low = day.low.min(k.low);
+        day.close = k.close;
+        day.order += k.order;
+        day.volume += k.volume;
+        day.amount = Price(day.amount.as_i64() + k.amount.as_i64());
+        day.up_count = k.up_count;
+        day.down_count = k.down_count;
+    }
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    day.time = beijing_date(first)
+        .and_then(|d| d.and_hms_opt(15, 0, 0))
+        .and_then(|dt| beijing_offset.from_local_datetime(&dt).single())
+        .map_or(first.time, |dt| dt.timestamp());
+    Some(day)
+}
+
+/// 两根K线某个字段的差异
+#[derive(Debug, Clone, PartialEq)]
+pub struct KlineDiscrepancy {
+    pub field: &'static str, // 字段名：open/high/low/close/volume/amount
+    pub expected: i64,       // 基准值（价格、成交额单位为厘，成交量单位为股）
+    pub actual: i64,         // 比较值
+    pub relative: f64,       // 相对差异 |actual - expected| / |expected|
+}
+
+/// 比较两根K线的开高低收、成交量和成交额，返回相对差异超过 `tolerance` 的字段
+///
+/// 分钟K线合并后与日K线通常有细微的舍入差异，`tolerance` 可取 0.001 左右；
+/// 基准值为0时，比较值非0即视为差异
+pub fn compare_klines(expected: &Kline, actual: &Kline, tolerance: f64) -> Vec<KlineDiscrepancy> {
+    let fields = [
+        ("open", expected.open.0, actual.open.0),
+        ("high", expected.high.0, actual.high.0),
+        ("low", expected.low.0, actual.low.0),
+        ("close", expected.close.0, actual.close.0),
+        ("volume", expected.volume, actual.volume),
+        ("amount", expected.amount.as_i64(), actual.amount.as_i64()),
+    ];
+    fields
+        .into_iter()
+        .filter_map(|(field, expected, actual)| {
+            let relative = if expected == 0 {
+                if actual == 0 {
+                    0.0
+                } else {
+                    f64::INFINITY
+                }
+            } else {
+                (actual - expected).abs() as f64 / expected.abs() as f64
+            };
+            (relative > tolerance).then_some(KlineDiscrepancy {
+                field,
+                expected,
+                actual,
+                relative,
+            })
+        })
+        .collect()
+}
+
+/// 判断K线在 `now`（Unix时间戳，秒）时是否为尚未收盘的当前周期K线
+///
+/// - 分钟/日K线：K线时间为该周期的结束时间，结束时间晚于 `now` 即未收盘
+/// - 周/月/季/年K线：K线时间为周期内最后一个交易日，`now` 仍在该周期内即未收盘
+pub fn is_partial_bar(kline_type: KlineType, k: &Kline, now: i64) -> bool {
+    if k.time > now {
+        return true;
+    }
+    let period = match kline_type {
+        KlineType::Week => ResamplePeriod::Week,
+        KlineType::Month => ResamplePeriod::Month,
+        KlineType::Quarter => ResamplePeriod::Quarter,
+        KlineType::Year => ResamplePeriod::Year,
+        _ => return false,
+    };
+    let now_bar = Kline {
+        time: now,
+        ..k.clone()
+    };
+    period_key(k, period) == period_key(&now_bar, period)
+}
+
+/// 结合交易日历判断K线在 `now` 时是否未收盘
+///
+/// 在 [`is_partial_bar`] 的基础上，周/月/季/年K线所在周期内已没有剩余交易时段
+/// （如周五收盘后、周末、月末长假）时视为已收盘。`holidays` 为休市日（YYYYMMDD），
+/// 周末无需包含
+pub fn is_partial_bar_in(
+    kline_type: KlineType,
+    k: &Kline,
+    now: i64,
+    holidays: &HashSet<u32>,
+) -> bool {
+    if !is_partial_bar(kline_type, k, now) {
+        return false;
+    }
+    let period = match kline_type {
+        KlineType::Week => ResamplePeriod::Week,
+        KlineType::Month => ResamplePeriod::Month,
+        KlineType::Quarter => ResamplePeriod::Quarter,
+        KlineType::Year => ResamplePeriod::Year,
+        _ => return true,
+    };
+    if k.time > now {
+        return true;
+    }
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let now_bar = Kline {
+        time: now,
+        ..k.clone()
+    };
+    let today = match beijing_date(&now_bar) {
+        Some(today) => today,
+        None => return true,
+    };
+    let key = period_key(&now_bar, period);
+    // 今天收盘前或本周期内之后还有交易日，则未收盘
+    let mut date = today;
+    loop {
+        let close = date
+            .and_hms_opt(15, 0, 0)
+            .and_then(|dt| beijing_offset.from_local_datetime(&dt).single());
+        let bar = match close {
+            Some(close) => Kline {
+                time: close.timestamp(),
+                ..k.clone()
+            },
+            None => return true,
+        };
+        if period_key(&bar, period) != key {
+            return false;
+        }
+        if is_trading_day(date, holidays) && bar.time > now {
+            return true;
+        }
+        date += Duration::days(1);
+    }
+}
+
+/// K线二进制文件头
+const KLINE_FILE_MAGIC: &[u8; 4] = b"TDXK";
+/// K线二进制格式版本
+const KLINE_FILE_VERSION: u8 = 1;
+/// 单条K线记录长度
+const KLINE_RECORD_SIZE: usize = 76;
+
+/// 将K线编码为二进制格式
+///
+/// 格式：文件头"TDXK"(4字节) + 版本(1字节) + 数量(4字节) + 记录(每条76字节，小端序)
+pub fn encode_klines(list: &[Kline]) -> Vec<u8> {
+    let mut data = Vec::with_capacity(9 + list.len() * KLINE_RECORD_SIZE);
+    data.extend_from_slice(KLINE_FILE_MAGIC);
+    data.push(KLINE_FILE_VERSION);
+    data.extend_from_slice(&(list.len() as u32).to_le_bytes());
+
+    for k in list {
+        for price in [k.last, k.open, k.high, k.low, k.close] {
+            data.extend_from_slice(&price.as_i64().to_le_bytes());
+        }
+        data.extend_from_slice(&k.order.to_le_bytes());
+        data.extend_from_slice(&k.volume.to_le_bytes());
+        data.extend_from_slice(&k.amount.as_i64().to_le_bytes());
+        data.extend_from_slice(&k.time.to_le_bytes());
+        data.extend_from_slice(&k.up_count.to_le_bytes());
+        data.extend_from_slice(&k.down_count.to_le_bytes());
+    }
+
+    data
+}
+
+/// 从二进制格式解码K线
+pub fn decode_klines(data: &[u8]) -> Result<Vec<Kline>, MessageError> {
+    if data.len() < 9 {
+        return Err(MessageError::InsufficientData);
+    }
+    if &data[0..4] != KLINE_FILE_MAGIC {
+        return Err(MessageError::ParseError("无效的K线文件头".to_string()));
+    }
+    if data[4] != KLINE_FILE_VERSION {
+        return Err(MessageError::ParseError(format!(
+            "不支持的K线文件版本: {}",
+            data[4]
+        )));
+    }
+
+    let count = bytes_to_u32_le(&data[5..9]) as usize;
+    if data.len() < 9 + count * KLINE_RECORD_SIZE {
+        return Err(MessageError::InsufficientData);
+    }
+
+    let i64_at = |pos: usize| i64::from_le_bytes(data[pos..pos + 8].try_into().unwrap());
+    let i32_at = |pos: usize| i32::from_le_bytes(data[pos..pos + 4].try_into().unwrap());
+
+    let mut list = Vec::with_capacity(count);
+    for i in 0..count {
+        let pos = 9 + i * KLINE_RECORD_SIZE;
+        list.push(Kline {
+            last: Price(i64_at(pos)),
+            open: Price(i64_at(pos + 8)),
+            high: Price(i64_at(pos + 16)),
+            low: Price(i64_at(pos + 24)),
+            close: Price(i64_at(pos + 32)),
+            order: i32_at(pos + 40),
+            volume: i64_at(pos + 44),
+            amount: Price(i64_at(pos + 52)),
+            time: i64_at(pos + 60),
+            up_count: i32_at(pos + 68),
+            down_count: i32_at(pos + 72),
+        });
+    }
+
+    Ok(list)
+}
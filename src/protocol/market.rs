@@ -0,0 +1,277 @@
+//! 各板块的交易规则（最小申报数量、价格最小变动单位）与交易时段
+
+use crate::protocol::{
+    constants::Exchange,
+    messages::{decode_code, is_bond, is_etf, is_stock, MessageError},
+    types::Price,
+};
+use chrono::{Datelike, Duration, FixedOffset, NaiveDate, TimeZone, Timelike, Utc, Weekday};
+use std::collections::HashSet;
+
+/// 板块
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Board {
+    Main,    // 沪深主板
+    ChiNext, // 创业板（30xxxx）
+    Star,    // 科创板（688xxx/689xxx）
+    Bj,      // 北交所
+    Fund,    // 场内基金（ETF/LOF）
+}
+
+/// 交易规则
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct MarketRules {
+    pub board: Board,
+    pub lot_size: u32,     // 最小买入数量（股/份）
+    pub lot_step: u32,     // 超过最小数量后的递增单位
+    pub price_tick: Price, // 价格最小变动单位
+}
+
+impl MarketRules {
+    /// 按价格最小变动单位四舍五入
+    pub fn round_price(&self, price: Price) -> Price {
+        let tick = self.price_tick.0;
+        let half = tick / 2;
+        let rounded = if price.0 >= 0 {
+            (price.0 + half) / tick * tick
+        } else {
+            (price.0 - half) / tick * tick
+        };
+        Price(rounded)
+    }
+
+    /// 买入数量是否符合申报规则
+    pub fn is_valid_quantity(&self, quantity: u32) -> bool {
+        quantity >= self.lot_size && (quantity - self.lot_size) % self.lot_step == 0
+    }
+}
+
+/// 获取证券所在板块，指数等不可交易的代码返回错误
+pub fn board(code: &str) -> Result<Board, MessageError> {
+    let (exchange, number) = decode_code(code)?;
+    let code = format!("{}{}", exchange.as_str(), number);
+    if is_etf(&code) {
+        return Ok(Board::Fund);
+    }
+    if !is_stock(&code) {
+        return Err(MessageError::InvalidCode(code));
+    }
+    Ok(match exchange {
+        Exchange::BJ => Board::Bj,
+        _ if number.starts_with("688") || number.starts_with("689") => Board::Star,
+        _ if number.starts_with("30") => Board::ChiNext,
+        _ => Board::Main,
+    })
+}
+
+/// 获取证券的交易规则
+///
+/// - 主板、创业板：100股起，100股递增，价格单位0.01元
+/// - 科创板：200股起，1股递增，价格单位0.01元
+/// - 北交所：100股起，1股递增，价格单位0.01元
+/// - 场内基金：100份起，100份递增，价格单位0.001元
+pub fn market_rules(code: &str) -> Result<MarketRules, MessageError> {
+    let board = board(code)?;
+    let (lot_size, lot_step, price_tick) = match board {
+        Board::Main | Board::ChiNext => (100, 100, Price(10)),
+        Board::Star => (200, 1, Price(10)),
+        Board::Bj => (100, 1, Price(10)),
+        Board::Fund => (100, 100, Price(1)),
+    };
+    Ok(MarketRules {
+        board,
+        lot_size,
+        lot_step,
+        price_tick,
+    })
+}
+
+/// 每手数量：可转债1手=10张，其余1手=100股/份
+///
+/// 行情中的成交量以手为单位，换算为股/张时使用
+pub fn shares_per_lot(code: &str) -> u32 {
+    if is_bond(code) {
+        10
+    } else {
+        100
+    }
+}
+
+/// 是否为风险警示股票（名称以 ST、*ST、SST、S*ST 开头）
+///
+/// 风险警示状态不体现在代码中，只能从名称判断
+pub fn is_st_name(name: &str) -> bool {
+    let name = name.trim().to_uppercase();
+    ["ST", "*ST", "SST", "S*ST"]
+        .iter()
+        .any(|prefix| name.starts_with(prefix))
+}
+
+/// 名称是否表明已退市或处于退市整理期（以“退”结尾或以“退市”开头，如 “*ST某某退”）
+///
+/// 代码列表中没有上市状态字段，只能从名称判断
+pub fn is_delisted_name(name: &str) -> bool {
+    let name = name.trim();
+    name.ends_with('退') || name.starts_with("退市")
+}
+
+/// 涨跌幅限制（百分比）
+///
+/// - 主板：10%，风险警示股票 5%
+/// - 创业板、科创板：20%（含风险警示股票）
+/// - 北交所：30%
+/// - 场内基金：10%
+pub fn limit_percent(code: &str, name: &str) -> Result<i64, MessageError> {
+    Ok(match board(code)? {
+        Board::Main if is_st_name(name) => 5,
+        Board::Main | Board::Fund => 10,
+        Board::ChiNext | Board::Star => 20,
+        Board::Bj => 30,
+    })
+}
+
+/// 根据昨收计算涨停价和跌停价，按价格最小变动单位四舍五入
+///
+/// `name` 用于识别风险警示股票，返回 (涨停价, 跌停价)
+pub fn price_limits(code: &str, name: &str, last: Price) -> Result<(Price, Price), MessageError> {
+    let tick = market_rules(code)?.price_tick.0;
+    let percent = limit_percent(code, name)?;
+    // 整数运算：昨收 × (100 ± 百分比) / 100，再四舍五入到价格单位
+    let round = |n: i64| (n + tick * 50) / (tick * 100) * tick;
+    Ok((
+        Price(round(last.0 * (100 + percent))),
+        Price(round(last.0 * (100 - percent))),
+    ))
+}
+
+/// 交易时段（北京时间，分钟）：开盘集合竞价 09:15 起，午间休市 11:30-13:00，15:00 收盘
+const MORNING_OPEN: u32 = 9 * 60 + 15;
+const MORNING_CLOSE: u32 = 11 * 60 + 30;
+const AFTERNOON_OPEN: u32 = 13 * 60;
+const AFTERNOON_CLOSE: u32 = 15 * 60;
+
+/// 默认的交易时段边界（北京时间，分钟）：开盘 09:15 和收盘 15:00
+pub const SESSION_BOUNDARIES: [u32; 2] = [MORNING_OPEN, AFTERNOON_CLOSE];
+
+/// 是否为交易日：周末和 `holidays`（YYYYMMDD）以外的日期
+///
+/// 库中没有内置节假日表，法定节假日需由调用方提供
+pub fn is_trading_day(date: NaiveDate, holidays: &HashSet<u32>) -> bool {
+    let ymd = date.year() as u32 * 10000 + date.month() * 100 + date.day();
+    !matches!(date.weekday(), Weekday::Sat | Weekday::Sun) && !holidays.contains(&ymd)
+}
+
+/// 根据交易日列表（YYYYMMDD，如 `Client::fetch_trading_days` 的结果）推导休市日
+///
+/// 返回第一个到最后一个交易日之间不在列表中的工作日，可直接用作 `holidays` 参数；
+/// 最后一个交易日之后的日期无法推导
+pub fn holidays_from_trading_days(trading_days: &[u32]) -> HashSet<u32> {
+    let to_date = |d: u32| NaiveDate::from_ymd_opt((d / 10000) as i32, d / 100 % 100, d % 100);
+    let known: HashSet<u32> = trading_days.iter().copied().collect();
+    let (first, last) = match (
+        trading_days.iter().min().and_then(|&d| to_date(d)),
+        trading_days.iter().max().and_then(|&d| to_date(d)),
+    ) {
+        (Some(first), Some(last)) => (first, last),
+        _ => return HashSet::new(),
+    };
+
+    let mut holidays = HashSet::new();
+    let mut date = first;
+    while date <= last {
+        let ymd = date.year() as u32 * 10000 + date.month() * 100 + date.day();
+        if !matches!(date.weekday(), Weekday::Sat | Weekday::Sun) && !known.contains(&ymd) {
+            holidays.insert(ymd);
+        }
+        date += Duration::days(1);
+    }
+    holidays
+}
+
+/// `now`（Unix时间戳，秒）是否处于交易时段，`include_lunch` 为 true 时午间休市也算在内
+pub fn is_trading_time(now: i64, include_lunch: bool, holidays: &HashSet<u32>) -> bool {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let t = match Utc.timestamp_opt(now, 0).single() {
+        Some(t) => t.with_timezone(&beijing_offset),
+        None => return false,
+    };
+    if !is_trading_day(t.date_naive(), holidays) {
+        return false;
+    }
+    let minutes = t.hour() * 60 + t.minute();
+    if include_lunch {
+        (MORNING_OPEN..AFTERNOON_CLOSE).contains(&minutes)
+    } else {
+        is_session_minute(minutes)
+    }
+}
+
+/// 当天第 `minutes` 分钟（北京时间）是否处于上午或下午交易时段，不考虑日期
+pub(crate) fn is_session_minute(minutes: u32) -> bool {
+    (MORNING_OPEN..MORNING_CLOSE).contains(&minutes)
+        || (AFTERNOON_OPEN..AFTERNOON_CLOSE).contains(&minutes)
+}
+
+/// `now` 之后下一个交易时段的开始时间（Unix时间戳，秒），已处于交易时段时返回 `now`
+///
+/// 只向后查找60天，找不到时返回 None
+pub fn next_trading_time(now: i64, include_lunch: bool, holidays: &HashSet<u32>) -> Option<i64> {
+    if is_trading_time(now, include_lunch, holidays) {
+        return Some(now);
+    }
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let today = Utc
+        .timestamp_opt(now, 0)
+        .single()?
+        .with_timezone(&beijing_offset);
+    let mut opens = vec![MORNING_OPEN];
+    if !include_lunch {
+        opens.push(AFTERNOON_OPEN);
+    }
+    for offset in 0..60 {
+        let date = today.date_naive() + Duration::days(offset);
+        if !is_trading_day(date, holidays) {
+            continue;
+        }
+        for &open in &opens {
+            let start = beijing_offset
+                .from_local_datetime(&date.and_hms_opt(open / 60, open % 60, 0)?)
+                .single()?
+                .timestamp();
+            if start > now {
+                return Some(start);
+            }
+        }
+    }
+    None
+}
+
+/// `now` 之后（不含）下一个交易日的时段边界时间（Unix时间戳，秒）
+///
+/// `boundaries` 为北京时间当天的分钟数（如 [`SESSION_BOUNDARIES`]），只向后查找60天，
+/// 找不到或 `boundaries` 为空时返回 None
+pub fn next_session_boundary(now: i64, boundaries: &[u32], holidays: &HashSet<u32>) -> Option<i64> {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let today = Utc
+        .timestamp_opt(now, 0)
+        .single()?
+        .with_timezone(&beijing_offset);
+    let mut boundaries = boundaries.to_vec();
+    boundaries.sort_unstable();
+    for offset in 0..60 {
+        let date = today.date_naive() + Duration::days(offset);
+        if !is_trading_day(date, holidays) {
+            continue;
+        }
+        for &minute in &boundaries {
+            let at = beijing_offset
+                .from_local_datetime(&date.and_hms_opt(minute / 60, minute % 60, 0)?)
+                .single()?
+                .timestamp();
+            if at > now {
+                return Some(at);
+            }
+        }
+    }
+    None
+}
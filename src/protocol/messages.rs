@@ -1,52 +1,140 @@
 //! 各种消息类型的编解码实现
+//!
+//! 所有响应解码遵循同一约定：数量为0的完整响应返回空列表而不是错误；
+//! 数据为空、截断或与声明的数量不符时返回 [`MessageError`]，任何输入都不会 panic
 
 use crate::protocol::{
     codec::{
-        bytes_to_u16_le, bytes_to_u32_le, decode_price, decode_varint, decode_volume2, gbk_to_utf8,
-        u16_to_bytes_le, u32_to_bytes_le,
+        bytes_to_u16_le, bytes_to_u32_le, decode_volume2, gbk_to_utf8, u16_to_bytes_le,
+        u32_to_bytes_le, utf8_to_gbk, ByteReader,
     },
     constants::{Exchange, KlineType, MessageType},
     frame::RequestFrame,
+    quote_util::normalize_levels,
     types::{
-        CallAuction, CallAuctionResponse, Gbbq, GbbqResponse, Kline, KlineCache, KlineResponse,
-        MinuteResponse, Price, PriceLevel, PriceNumber, QuoteInfo, StockCode, Trade, TradeResponse,
-        TradeStatus, K,
+        Block, BlockMeta, CallAuction, CallAuctionResponse, FinanceInfo, Gbbq, GbbqResponse, Kline,
+        KlineCache, KlineResponse, MinuteResponse, Price, PriceConvention, PriceLevel, PriceNumber,
+        QuoteInfo, StockCode, Trade, TradeResponse, TradeStatus, UnknownGbbq, K,
     },
 };
 use chrono::{Datelike, FixedOffset, TimeZone, Utc};
 use thiserror::Error;
 
 /// 消息编解码错误
+///
+/// 响应为空或在记录中途截断时返回 `InsufficientData`；K线响应恰好截断在两根K线之间、
+/// 实际条数少于声明的数量时返回 `CountMismatch`
 #[derive(Debug, Error)]
 pub enum MessageError {
     #[error("数据长度不足")]
     InsufficientData,
     #[error("无效的股票代码: {0}")]
     InvalidCode(String),
+    #[error("代码有歧义，需带交易所前缀（如 sh{0} 或 sz{0}）")]
+    AmbiguousCode(String),
     #[error("解析错误: {0}")]
     ParseError(String),
+    #[error("数量不一致: 声明 {declared}, 实际解析 {decoded}")]
+    CountMismatch { declared: usize, decoded: usize },
+    #[error("客户端版本不匹配: {message}")]
+    VersionMismatch {
+        required: Option<String>, // 服务器要求的版本号（能从提示中识别时）
+        message: String,          // 服务器返回的提示
+    },
+}
+
+/// 握手时上报的客户端标识
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ClientIdentity {
+    pub version: String, // 客户端版本号
+    pub id: Vec<u8>,     // 客户端标识（如 MAC 地址）
+}
+
+/// 连接响应
+///
+/// 握手响应中没有需要在后续请求中回传的会话令牌或序号：请求帧只包含
+/// msg_id、control、消息类型和数据域，服务器不校验与握手相关的内容
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ConnectResponse {
+    pub header: Vec<u8>, // 前68字节（含义未知）
+    pub info: String,    // 服务器信息（如"上海双线主站14 ... #通达信"）
 }
 
 /// 连接消息
 pub struct Connect;
 
 impl Connect {
-    /// 创建连接请求帧
+    /// 版本号字段长度
+    pub const VERSION_SIZE: usize = 16;
+
+    /// 创建连接请求帧（标准通达信客户端只发送 0x01）
     pub fn request(msg_id: u32) -> RequestFrame {
         RequestFrame::new(msg_id, MessageType::Connect, vec![0x01])
     }
 
+    /// 创建携带客户端标识的连接请求帧
+    ///
+    /// 数据域：0x01 + 版本号(16字节GBK，不足补0) + 标识(原样)
+    pub fn request_with_identity(msg_id: u32, identity: &ClientIdentity) -> RequestFrame {
+        let mut version = utf8_to_gbk(&identity.version);
+        version.resize(Self::VERSION_SIZE, 0);
+
+        let mut data = vec![0x01];
+        data.extend_from_slice(&version);
+        data.extend_from_slice(&identity.id);
+        RequestFrame::new(msg_id, MessageType::Connect, data)
+    }
+
+    /// 服务器拒绝握手时提示中的关键词
+    const VERSION_REJECTIONS: [&'static str; 4] = ["版本不匹配", "版本过低", "版本太低", "请升级"];
+
     /// 解码连接响应
+    ///
+    /// 正常响应为68字节头部 + GBK编码的服务器信息，满足该结构时直接返回信息，
+    /// 不检查其中的文本。不足68字节时按提示文本识别拒绝：服务器以版本不匹配
+    /// 拒绝握手时返回 [`MessageError::VersionMismatch`]，可按其中要求的版本号
+    /// 通过客户端标识重新握手，其余情况返回 [`MessageError::InsufficientData`]
     pub fn decode_response(data: &[u8]) -> Result<String, MessageError> {
-        if data.len() < 68 {
-            return Err(MessageError::InsufficientData);
+        if data.len() >= 68 {
+            // 前68字节未知，后续为GBK编码的字符串信息
+            return Ok(gbk_to_utf8(&data[68..]));
         }
-        // 前68字节未知，后续为GBK编码的字符串信息
-        let info = gbk_to_utf8(&data[68..]);
-        Ok(info)
+
+        let text = gbk_to_utf8(data);
+        if let Some(pos) = Self::VERSION_REJECTIONS
+            .iter()
+            .filter_map(|k| text.find(k))
+            .min()
+        {
+            let message = text.trim_matches(|c: char| c == '\0' || c.is_whitespace());
+            return Err(MessageError::VersionMismatch {
+                required: required_version(&text[pos..]),
+                message: message.to_string(),
+            });
+        }
+        Err(MessageError::InsufficientData)
+    }
+
+    /// 解码连接响应，保留前68字节的原始内容
+    pub fn decode_connect_response(data: &[u8]) -> Result<ConnectResponse, MessageError> {
+        let info = Self::decode_response(data)?;
+        Ok(ConnectResponse {
+            header: data[..68].to_vec(),
+            info: info.trim().to_string(),
+        })
     }
 }
 
+/// 从提示文本中提取第一个版本号（如 “请升级到7.65版本” 中的 7.65）
+fn required_version(text: &str) -> Option<String> {
+    let start = text.find(|c: char| c.is_ascii_digit())?;
+    let version: String = text[start..]
+        .chars()
+        .take_while(|c| c.is_ascii_digit() || *c == '.')
+        .collect();
+    Some(version.trim_end_matches('.').to_string())
+}
+
 /// 心跳消息
 pub struct Heartbeat;
 
@@ -61,10 +149,34 @@ impl Heartbeat {
 pub struct Count;
 
 impl Count {
+    /// 请求数据域中交易所之后的固定字节（用途未知）
+    const SUFFIX: [u8; 5] = [0x00, 0x75, 0xC7, 0x33, 0x01];
+
     /// 创建获取股票数量请求帧
     pub fn request(msg_id: u32, exchange: Exchange) -> RequestFrame {
-        let data = vec![exchange.as_u8(), 0x00, 0x75, 0xC7, 0x33, 0x01];
-        RequestFrame::new(msg_id, MessageType::Count, data)
+        RequestFrame::new(msg_id, MessageType::Count, Self::encode(exchange))
+    }
+
+    /// 编码请求数据域：交易所(1字节) + 固定字节(5字节)
+    pub fn encode(exchange: Exchange) -> Vec<u8> {
+        let mut data = vec![exchange.as_u8()];
+        data.extend_from_slice(&Self::SUFFIX);
+        data
+    }
+
+    /// 解码请求数据域，返回要统计的交易所
+    pub fn decode_request(data: &[u8]) -> Result<Exchange, MessageError> {
+        if data.len() < 1 + Self::SUFFIX.len() {
+            return Err(MessageError::InsufficientData);
+        }
+        if data[1..] != Self::SUFFIX {
+            return Err(MessageError::ParseError(format!(
+                "未知的数量请求数据: {:02X?}",
+                data
+            )));
+        }
+        Exchange::from_u8(data[0])
+            .ok_or_else(|| MessageError::ParseError(format!("无效的交易所: {}", data[0])))
     }
 
     /// 解码股票数量响应
@@ -89,25 +201,19 @@ impl Code {
 
     /// 解码股票代码列表响应
     pub fn decode_response(data: &[u8]) -> Result<CodeResponse, MessageError> {
-        if data.len() < 2 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut codes = Vec::new();
-        let mut offset = 2;
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
+        let mut codes = Vec::with_capacity(count as usize);
 
         for _ in 0..count {
-            if offset + 29 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
+            // 每条记录29字节
+            let record = reader.read_bytes(29)?;
 
-            let code_str = String::from_utf8_lossy(&data[offset..offset + 6]).to_string();
-            let multiple = bytes_to_u16_le(&data[offset + 6..offset + 8]);
-            let name_bytes = &data[offset + 8..offset + 16];
-            let name = gbk_to_utf8(name_bytes);
-            let decimal = data[offset + 20] as i8;
-            let last_price = decode_volume2(&data[offset + 21..offset + 25]);
+            let code_str = String::from_utf8_lossy(&record[0..6]).to_string();
+            let multiple = bytes_to_u16_le(&record[6..8]);
+            let name = gbk_to_utf8(&record[8..16]);
+            let decimal = record[20] as i8;
+            let last_price = decode_volume2(&record[21..25]);
 
             codes.push(StockCode {
                 name: name.clone(),
@@ -116,8 +222,6 @@ impl Code {
                 decimal,
                 last_price,
             });
-
-            offset += 29;
         }
 
         Ok(CodeResponse { count, codes })
@@ -125,6 +229,8 @@ impl Code {
 }
 
 /// 股票代码列表响应
+///
+/// 起始位置超出代码总数时服务器返回0条，`codes` 为空
 #[derive(Debug, Clone)]
 pub struct CodeResponse {
     pub count: u16,
@@ -150,78 +256,76 @@ impl Quote {
     }
 
     /// 解码行情信息响应
+    ///
+    /// 每条行情都带有自己的市场和代码，解码时以响应中的代码为准，不按请求顺序对应。
+    /// 服务器可能跳过已退市等无效代码，返回的数量可能少于请求数量
     pub fn decode_response(data: &[u8]) -> Result<Vec<QuoteInfo>, MessageError> {
-        if data.len() < 4 {
-            return Err(MessageError::InsufficientData);
-        }
+        let mut quotes = Vec::new();
+        Self::decode_response_into(data, &mut quotes)?;
+        Ok(quotes)
+    }
+
+    /// 解码行情信息响应到已有的列表中（先清空），便于轮询时复用内存
+    pub fn decode_response_into(
+        data: &[u8],
+        quotes: &mut Vec<QuoteInfo>,
+    ) -> Result<(), MessageError> {
+        quotes.clear();
+        let mut reader = ByteReader::new(data);
 
         // 前2字节未知（可能是版本或其他标识），第3-4字节是数量（小端序）
-        let mut offset = 2; // 跳过前2字节
-        let count = bytes_to_u16_le(&data[offset..offset + 2]);
-        offset += 2;
+        reader.skip(2)?;
+        let count = reader.read_u16()?;
 
-        let mut quotes = Vec::new();
+        quotes.reserve(count as usize);
 
         for _ in 0..count {
-            if offset + 9 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
-
             // 交易所：0=深圳，1=上海，2=北京
-            let exchange_val = data[offset];
+            let exchange_val = reader.read_u8()?;
             let exchange = Exchange::from_u8(exchange_val).ok_or_else(|| {
                 MessageError::ParseError(format!("无效的交易所: {}", exchange_val))
             })?;
-            offset += 1;
 
             // 股票代码（6字节）
-            let code_bytes = &data[offset..offset + 6];
-            let code = gbk_to_utf8(code_bytes);
-            offset += 6;
+            let code = gbk_to_utf8(reader.read_bytes(6)?);
 
-            let active1 = bytes_to_u16_le(&data[offset..offset + 2]);
-            offset += 2;
+            let active1 = reader.read_u16()?;
+
+            let qualified = format!("{}{}", exchange.as_str(), code);
+            let scale = price_scale(&qualified);
+            let price_convention = if is_bond(&qualified) {
+                PriceConvention::PerHundredFace
+            } else {
+                PriceConvention::PerShare
+            };
 
             // 解析K线数据
-            let (k, k_consumed) = decode_k(&data[offset..])?;
-            offset += k_consumed;
+            let k = read_k(&mut reader, scale)?;
 
             // ReversedBytes0 (变长整数) - 服务器时间
-            let (reversed0, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
-            let server_time = format!("{}", reversed0);
+            let server_time = format!("{}", reader.read_varint()?);
 
             // ReversedBytes1 (变长整数)
-            let (_reversed1, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let _reversed1 = reader.read_varint()?;
 
             // TotalHand (变长整数)
-            let (total_hand, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let total_hand = reader.read_varint()?;
 
             // Intuition (变长整数)
-            let (intuition, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let intuition = reader.read_varint()?;
 
-            // Amount (4字节，特殊浮点编码)
-            let amount = decode_volume2(&data[offset..offset + 4]);
-            offset += 4;
+            // Amount (4字节，特殊浮点编码，单位元)
+            let amount = Price((reader.read_volume2()? * 1000.0) as i64);
 
             // InsideDish (变长整数)
-            let (inside_dish, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let inside_dish = reader.read_varint()?;
 
             // OuterDisc (变长整数)
-            let (outer_disc, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let outer_disc = reader.read_varint()?;
 
-            // ReversedBytes2 (变长整数)
-            let (_reversed2, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
-
-            // ReversedBytes3 (变长整数)
-            let (_reversed3, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            // ReversedBytes2、ReversedBytes3 (变长整数)
+            let _reversed2 = reader.read_varint()?;
+            let _reversed3 = reader.read_varint()?;
 
             // 5档买卖盘
             let mut buy_level = [PriceLevel {
@@ -236,44 +340,30 @@ impl Quote {
             }; 5];
 
             for i in 0..5 {
-                // 买价差值
-                let (buy_price_diff, consumed) = decode_price(&data[offset..]);
-                offset += consumed;
-                buy_level[i].price = Price(buy_price_diff.0 * 10 + k.close.0);
-
-                // 卖价差值
-                let (sell_price_diff, consumed) = decode_price(&data[offset..]);
-                offset += consumed;
-                sell_level[i].price = Price(sell_price_diff.0 * 10 + k.close.0);
-
-                // 买量
-                let (buy_num, consumed) = decode_varint(&data[offset..]);
-                offset += consumed;
-                buy_level[i].number = buy_num;
-
-                // 卖量
-                let (sell_num, consumed) = decode_varint(&data[offset..]);
-                offset += consumed;
-                sell_level[i].number = sell_num;
+                // 买价差值、卖价差值
+                buy_level[i].price = Price(reader.read_price()?.0 * scale + k.close.0);
+                sell_level[i].price = Price(reader.read_price()?.0 * scale + k.close.0);
+
+                // 买量、卖量
+                buy_level[i].number = reader.read_varint()?;
+                sell_level[i].number = reader.read_varint()?;
             }
+            normalize_levels(&mut buy_level);
+            normalize_levels(&mut sell_level);
 
             // ReversedBytes4 (2字节)
-            offset += 2;
+            reader.skip(2)?;
 
             // ReversedBytes5 ~ 8 (变长整数)
             for _ in 0..4 {
-                let (_val, consumed) = decode_varint(&data[offset..]);
-                offset += consumed;
+                reader.read_varint()?;
             }
 
             // ReversedBytes9 (2字节) - Rate
-            let rate_raw = bytes_to_u16_le(&data[offset..offset + 2]);
-            let rate = rate_raw as f64 / 100.0;
-            offset += 2;
+            let rate = reader.read_u16()? as f64 / 100.0;
 
             // Active2 (2字节)
-            let active2 = bytes_to_u16_le(&data[offset..offset + 2]);
-            offset += 2;
+            let active2 = reader.read_u16()?;
 
             quotes.push(QuoteInfo {
                 exchange,
@@ -290,41 +380,23 @@ impl Quote {
                 sell_level,
                 rate,
                 active2,
+                price_convention,
             });
         }
 
-        Ok(quotes)
+        Ok(())
     }
 }
 
-/// 解码K线数据（简化版）
-/// 返回 (K线数据, 消耗的字节数)
-fn decode_k(data: &[u8]) -> Result<(K, usize), MessageError> {
-    if data.is_empty() {
-        return Err(MessageError::InsufficientData);
-    }
-
-    let mut offset = 0;
-
-    // 当日收盘价差值（一般2字节）
-    let (close_diff, consumed1) = decode_price(&data[offset..]);
-    offset += consumed1;
-
-    // 前日收盘价差值（一般1字节）
-    let (last_diff, consumed2) = decode_price(&data[offset..]);
-    offset += consumed2;
-
-    // 当日开盘价差值（一般1字节）
-    let (open_diff, consumed3) = decode_price(&data[offset..]);
-    offset += consumed3;
-
-    // 当日最高价差值（一般1字节）
-    let (high_diff, consumed4) = decode_price(&data[offset..]);
-    offset += consumed4;
-
-    // 当日最低价差值（一般1字节）
-    let (low_diff, consumed5) = decode_price(&data[offset..]);
-    offset += consumed5;
+/// 读取行情中的K线数据（简化版）
+/// `scale` 为价格差值到厘的倍数
+fn read_k(reader: &mut ByteReader, scale: i64) -> Result<K, MessageError> {
+    // 当日收盘价、前日收盘价、开盘价、最高价、最低价的差值
+    let close_diff = reader.read_price()?;
+    let last_diff = reader.read_price()?;
+    let open_diff = reader.read_price()?;
+    let high_diff = reader.read_price()?;
+    let low_diff = reader.read_price()?;
 
     // 根据 Go 代码逻辑：K线价格是累加的
     // Last = Last + Close
@@ -332,27 +404,24 @@ fn decode_k(data: &[u8]) -> Result<(K, usize), MessageError> {
     // Close = Close
     // High = Close + High
     // Low = Close + Low
-    let close = Price(close_diff.0 * 10);
-    let last = Price(close.0 + last_diff.0 * 10);
-    let open = Price(close.0 + open_diff.0 * 10);
-    let high = Price(close.0 + high_diff.0 * 10);
-    let low = Price(close.0 + low_diff.0 * 10);
-
-    Ok((
-        K {
-            last,
-            open,
-            high,
-            low,
-            close,
-        },
-        offset,
-    ))
+    let close = Price(close_diff.0 * scale);
+    let last = Price(close.0 + last_diff.0 * scale);
+    let open = Price(close.0 + open_diff.0 * scale);
+    let high = Price(close.0 + high_diff.0 * scale);
+    let low = Price(close.0 + low_diff.0 * scale);
+
+    Ok(K {
+        last,
+        open,
+        high,
+        low,
+        close,
+    })
 }
 
-/// 解码股票代码
+/// 解码股票代码，不带交易所前缀的代码返回 [`MessageError::AmbiguousCode`]
 pub fn decode_code(code: &str) -> Result<(Exchange, String), MessageError> {
-    let code = add_prefix(code);
+    let code = qualify_code(code)?;
     if code.len() != 8 {
         return Err(MessageError::InvalidCode(code));
     }
@@ -368,7 +437,27 @@ pub fn decode_code(code: &str) -> Result<(Exchange, String), MessageError> {
     Ok((exchange, number.to_string()))
 }
 
-/// 添加交易所前缀
+/// 是否为不带交易所前缀的6位代码
+///
+/// 同一个数字代码可能对应不同市场的证券，如 000001 既是深圳的平安银行，也是上海的上证指数，
+/// 因此请求时一律要求带交易所前缀
+pub fn is_ambiguous_code(code: &str) -> bool {
+    code.len() == 6 && code.bytes().all(|b| b.is_ascii_digit())
+}
+
+/// 规范化带交易所前缀的代码（转为小写），不带前缀的6位代码返回 [`MessageError::AmbiguousCode`]
+///
+/// 请求时应使用该函数而不是 [`add_prefix`]，避免把 000001 当作平安银行请求了上证指数（或相反）
+pub fn qualify_code(code: &str) -> Result<String, MessageError> {
+    if is_ambiguous_code(code) {
+        return Err(MessageError::AmbiguousCode(code.to_string()));
+    }
+    Ok(add_prefix(code))
+}
+
+/// 按代码规则推断并添加交易所前缀
+///
+/// 000xxx 按深圳股票处理，只适合已知是股票的代码（如板块成分股）；请求时使用 [`qualify_code`]
 pub fn add_prefix(code: &str) -> String {
     let code = code.to_lowercase();
     if code.len() == 6 {
@@ -413,7 +502,7 @@ pub fn is_stock(code: &str) -> bool {
     }
 }
 
-/// 判断是否为ETF
+/// 判断是否为场内基金（ETF/LOF）
 pub fn is_etf(code: &str) -> bool {
     let code = add_prefix(code);
     if code.len() != 8 {
@@ -443,6 +532,22 @@ pub fn is_index(code: &str) -> bool {
     }
 }
 
+/// 判断是否为可转债（上海 110/111/113/118，深圳 123/127/128）
+///
+/// 债券价格为每100元面值的净价，行情中保留3位小数
+pub fn is_bond(code: &str) -> bool {
+    let code = add_prefix(code);
+    if code.len() != 8 {
+        return false;
+    }
+    let (exchange_prefix, number) = code.split_at(2);
+    match exchange_prefix {
+        "sh" => is_sh_bond(number),
+        "sz" => is_sz_bond(number),
+        _ => false,
+    }
+}
+
 fn is_sh_stock(code: &str) -> bool {
     code.len() == 6 && code.starts_with('6')
 }
@@ -456,17 +561,32 @@ fn is_bj_stock(code: &str) -> bool {
 }
 
 fn is_sh_etf(code: &str) -> bool {
-    code.len() == 6 && (code.starts_with("51") || code.starts_with("56") || code.starts_with("58"))
+    code.len() == 6
+        && (code.starts_with("50")
+            || code.starts_with("51")
+            || code.starts_with("56")
+            || code.starts_with("58"))
 }
 
 fn is_sz_etf(code: &str) -> bool {
-    code.len() == 6 && code.starts_with("15")
+    code.len() == 6 && (code.starts_with("15") || code.starts_with("16"))
 }
 
 fn is_bj_etf(code: &str) -> bool {
     code.len() == 6 && false
 }
 
+fn is_sh_bond(code: &str) -> bool {
+    code.len() == 6
+        && ["110", "111", "113", "118"]
+            .iter()
+            .any(|p| code.starts_with(p))
+}
+
+fn is_sz_bond(code: &str) -> bool {
+    code.len() == 6 && ["123", "127", "128"].iter().any(|p| code.starts_with(p))
+}
+
 fn is_sh_index(code: &str) -> bool {
     code.len() == 6 && (code.starts_with("000") || code == "999999")
 }
@@ -512,34 +632,65 @@ impl KlineMsg {
     }
 
     /// 解码K线数据响应
+    ///
+    /// 按响应声明的数量解析，数据不足声明的数量时返回 [`MessageError::CountMismatch`]，
+    /// 声明数量之后的多余字节（如填充）忽略。
+    /// K线价格差值的单位统一为厘，债券同样是每100元面值的价格，无需另行换算
     pub fn decode_response(data: &[u8], cache: KlineCache) -> Result<KlineResponse, MessageError> {
-        if data.len() < 2 {
-            return Err(MessageError::InsufficientData);
-        }
+        let mut list = Vec::new();
+        let count = Self::decode_response_into(data, cache, &mut list)?;
+        Ok(KlineResponse {
+            count,
+            list,
+            partial: false,
+        })
+    }
 
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut offset = 2;
-        let mut list = Vec::with_capacity(count as usize);
+    /// 解码K线数据响应，出错时仍返回出错位置之前完整解析的K线
+    ///
+    /// 适合长序列的末尾被截断时保留有效部分，再重新请求剩余数据
+    pub fn decode_response_partial(
+        data: &[u8],
+        cache: KlineCache,
+    ) -> (Vec<Kline>, Option<MessageError>) {
+        let mut list = Vec::new();
+        let err = Self::decode_response_into(data, cache, &mut list).err();
+        (list, err)
+    }
+
+    /// 解码K线数据响应到已有的列表中（先清空），返回声明的数量，便于轮询时复用内存
+    ///
+    /// 出错时 `list` 中保留出错位置之前完整解析的K线
+    pub fn decode_response_into(
+        data: &[u8],
+        cache: KlineCache,
+        list: &mut Vec<Kline>,
+    ) -> Result<u16, MessageError> {
+        list.clear();
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
+        // 按声明的数量预分配，每根K线至少16字节，数量异常时不超过数据能容纳的条数
+        list.reserve((count as usize).min(data.len() / 16));
         let mut last_price = Price(0);
 
+        // 按声明的数量解析，其后的多余字节（如块边界填充）忽略
         for _ in 0..count {
-            if offset + 4 > data.len() {
-                return Err(MessageError::InsufficientData);
+            // 数据在K线边界处提前结束，说明实际条数少于声明的数量
+            if reader.remaining() == 0 {
+                return Err(MessageError::CountMismatch {
+                    declared: count as usize,
+                    decoded: list.len(),
+                });
             }
 
             // 解析时间（4字节）
-            let time = decode_kline_time(&data[offset..offset + 4], cache.kline_type);
-            offset += 4;
+            let time = decode_kline_time(reader.read_bytes(4)?, cache.kline_type);
 
             // 解析价格差值
-            let (open_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
-            let (close_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
-            let (high_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
-            let (low_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
+            let open_diff = reader.read_price()?;
+            let close_diff = reader.read_price()?;
+            let high_diff = reader.read_price()?;
+            let low_diff = reader.read_price()?;
 
             // 计算实际价格
             let open = Price(last_price.0 + open_diff.0);
@@ -548,34 +699,26 @@ impl KlineMsg {
             let low = Price(last_price.0 + open_diff.0 + low_diff.0);
 
             // 成交量（4字节）
-            if offset + 4 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
-            let mut volume = decode_volume2(&data[offset..offset + 4]) as i64;
-            offset += 4;
+            let raw_volume = reader.read_volume2()?;
 
-            // 分钟级K线成交量需要除以100
-            match cache.kline_type {
-                0 | 1 | 2 | 3 | 4 | 7 | 8 => volume /= 100,
-                _ => {}
+            // 统一为股/张：日线及以上原始值为手，分钟级K线（含类型4）为手的1/100，
+            // 指数再乘以100。响应中没有单位标志，只能按类型和代码换算
+            let mut scale = cache.lot as f64;
+            if matches!(cache.kline_type, 0 | 1 | 2 | 3 | 4 | 7 | 8) {
+                scale /= 100.0;
             }
+            if cache.is_index {
+                scale *= 100.0;
+            }
+            let volume = (raw_volume * scale).round() as i64;
 
             // 成交额（4字节）
-            if offset + 4 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
-            let amount = Price((decode_volume2(&data[offset..offset + 4]) * 1000.0) as i64);
-            offset += 4;
+            let amount = Price((reader.read_volume2()? * 1000.0) as i64);
 
             // 如果是指数，还有额外4字节（上涨/下跌数量）
             let (up_count, down_count) = if cache.is_index {
-                if offset + 4 > data.len() {
-                    return Err(MessageError::InsufficientData);
-                }
-                volume *= 100;
-                let up = bytes_to_u16_le(&data[offset..offset + 2]) as i32;
-                let down = bytes_to_u16_le(&data[offset + 2..offset + 4]) as i32;
-                offset += 4;
+                let up = reader.read_u16()? as i32;
+                let down = reader.read_u16()? as i32;
                 (up, down)
             } else {
                 (0, 0)
@@ -589,7 +732,7 @@ impl KlineMsg {
                 high,
                 low,
                 close,
-                order: 0,
+                order: 0, // 响应中没有成交笔数
                 volume,
                 amount,
                 time,
@@ -598,7 +741,7 @@ impl KlineMsg {
             });
         }
 
-        Ok(KlineResponse { count, list })
+        Ok(count)
     }
 }
 
@@ -665,16 +808,18 @@ impl MinuteMsg {
     /// - 前 2 字节是数量
     /// - 2-6 字节未知
     /// - 每条记录：价格差值(GetPrice) + 未知(GetPrice) + 成交量(CutInt)
-    /// - 价格是累加的，且要乘以 10
+    /// - 价格是累加的，按 [`price_scale`] 换算为厘（Go 版本统一乘以 10）
     /// - 时间从 09:30 开始，使用 i+1 分钟
     /// - 当 i==120 时额外加 90 分钟
-    pub fn decode_response(data: &[u8], date: &str) -> Result<MinuteResponse, MessageError> {
-        if data.len() < 6 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut offset = 6; // 前2字节是数量，2-6字节未知
+    pub fn decode_response(
+        data: &[u8],
+        date: &str,
+        code: &str,
+    ) -> Result<MinuteResponse, MessageError> {
+        let scale = price_scale(code);
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
+        reader.skip(4)?; // 2-6字节未知
         let mut list = Vec::with_capacity(count as usize);
         let mut last_price = Price(0);
 
@@ -693,19 +838,16 @@ impl MinuteMsg {
         // }
         for i in 0..count {
             // 价格差值
-            let (price_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
+            let price_diff = Price(reader.read_varint()? as i64);
 
             // 未知字段（也用 GetPrice 解码）
-            let (_unknown, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
+            let _unknown = reader.read_varint()?;
 
             // 累加价格
             last_price = Price(last_price.0 + price_diff.0);
 
             // 成交量
-            let (number, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let number = reader.read_varint()?;
 
             // 计算时间：从 09:30 开始，使用 i+1 分钟
             let hour = if i < 120 {
@@ -720,8 +862,7 @@ impl MinuteMsg {
             };
             let time = parse_datetime(date, hour, minute, 0);
 
-            // 价格乘以 10（multiple）
-            let price = Price(last_price.0 * 10);
+            let price = Price(last_price.0 * scale);
 
             list.push(PriceNumber {
                 time,
@@ -757,8 +898,12 @@ impl HistoryMinuteMsg {
 
     /// 解码历史分时数据响应
     /// 与 MinuteMsg::decode_response 格式相同
-    pub fn decode_response(data: &[u8], date: &str) -> Result<MinuteResponse, MessageError> {
-        MinuteMsg::decode_response(data, date)
+    pub fn decode_response(
+        data: &[u8],
+        date: &str,
+        code: &str,
+    ) -> Result<MinuteResponse, MessageError> {
+        MinuteMsg::decode_response(data, date, code)
     }
 }
 
@@ -794,42 +939,30 @@ impl TradeMsg {
 
     /// 解码分时交易响应
     pub fn decode_response(data: &[u8], cache: &TradeCache) -> Result<TradeResponse, MessageError> {
-        if data.len() < 2 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut offset = 2;
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
         let mut list = Vec::with_capacity(count as usize);
         let mut last_price = Price(0);
+        let scale = price_scale(&cache.code);
 
         for _ in 0..count {
-            if offset + 2 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
-
             // 时间（2字节）
-            let time_val = bytes_to_u16_le(&data[offset..offset + 2]);
+            let time_val = reader.read_u16()?;
             let hour = time_val / 60;
             let minute = time_val % 60;
-            offset += 2;
 
             // 价格差值
-            let (price_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
-            last_price = Price(last_price.0 + price_diff.0 * 10);
+            let price_diff = Price(reader.read_varint()? as i64);
+            last_price = Price(last_price.0 + price_diff.0 * scale);
 
             // 成交量
-            let (volume, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let volume = reader.read_varint()?;
 
             // 单数
-            let (number, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let number = reader.read_varint()?;
 
             // 状态
-            let (status_val, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let status_val = reader.read_varint()?;
             let status = match status_val {
                 0 => TradeStatus::Buy,
                 1 => TradeStatus::Sell,
@@ -837,8 +970,7 @@ impl TradeMsg {
             };
 
             // 未知字段
-            let (_unknown, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let _unknown = reader.read_varint()?;
 
             // 构造时间
             let time = parse_datetime(&cache.date, hour as u32, minute as u32, 0);
@@ -856,6 +988,18 @@ impl TradeMsg {
     }
 }
 
+/// 行情、分时和分笔成交中价格差值到厘的倍数
+///
+/// 股票和指数的价格差值单位为分，场内基金（ETF/LOF）和可转债报价精确到厘，差值单位为厘。
+/// K线的价格差值以厘为单位（见 kline.json 样本），不使用该倍数
+pub fn price_scale(code: &str) -> i64 {
+    if is_etf(code) || is_bond(code) {
+        1
+    } else {
+        10
+    }
+}
+
 // ==================== 历史分时交易消息 ====================
 
 /// 历史分时交易消息
@@ -891,38 +1035,28 @@ impl HistoryTradeMsg {
 
     /// 解码历史分时交易响应
     pub fn decode_response(data: &[u8], cache: &TradeCache) -> Result<TradeResponse, MessageError> {
-        if data.len() < 6 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut offset = 6; // 前2字节数量，2-6字节未知
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
+        reader.skip(4)?; // 2-6字节未知
         let mut list = Vec::with_capacity(count as usize);
         let mut last_price = Price(0);
+        let scale = price_scale(&cache.code);
 
         for _ in 0..count {
-            if offset + 2 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
-
             // 时间（2字节）
-            let time_val = bytes_to_u16_le(&data[offset..offset + 2]);
+            let time_val = reader.read_u16()?;
             let hour = time_val / 60;
             let minute = time_val % 60;
-            offset += 2;
 
             // 价格差值
-            let (price_diff, consumed) = decode_price(&data[offset..]);
-            offset += consumed;
-            last_price = Price(last_price.0 + price_diff.0 * 10);
+            let price_diff = Price(reader.read_varint()? as i64);
+            last_price = Price(last_price.0 + price_diff.0 * scale);
 
             // 成交量
-            let (volume, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let volume = reader.read_varint()?;
 
             // 状态
-            let (status_val, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let status_val = reader.read_varint()?;
             let status = match status_val {
                 0 => TradeStatus::Buy,
                 1 => TradeStatus::Sell,
@@ -930,8 +1064,7 @@ impl HistoryTradeMsg {
             };
 
             // 未知字段
-            let (_unknown, consumed) = decode_varint(&data[offset..]);
-            offset += consumed;
+            let _unknown = reader.read_varint()?;
 
             // 构造时间
             let time = parse_datetime(&cache.date, hour as u32, minute as u32, 0);
@@ -971,44 +1104,34 @@ impl CallAuctionMsg {
 
     /// 解码集合竞价响应
     pub fn decode_response(data: &[u8]) -> Result<CallAuctionResponse, MessageError> {
-        if data.len() < 2 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[0..2]);
-        let mut offset = 2;
+        let mut reader = ByteReader::new(data);
+        let count = reader.read_u16()?;
         let mut list = Vec::with_capacity(count as usize);
 
         for _ in 0..count {
-            if offset + 16 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
+            // 每条记录16字节
+            let record = reader.read_bytes(16)?;
 
-            let n = bytes_to_u16_le(&data[offset..offset + 2]);
+            let n = bytes_to_u16_le(&record[0..2]);
             let hour = n / 60;
             let minute = n % 60;
 
             // 价格（float32）
-            let price_f32 = f32::from_le_bytes([
-                data[offset + 2],
-                data[offset + 3],
-                data[offset + 4],
-                data[offset + 5],
-            ]);
+            let price_f32 = f32::from_le_bytes([record[2], record[3], record[4], record[5]]);
             let price = Price((price_f32 * 1000.0) as i64);
 
             // 匹配量
-            let matched = bytes_to_u32_le(&data[offset + 6..offset + 10]) as i64;
+            let matched = bytes_to_u32_le(&record[6..10]) as i64;
 
             // 未匹配量（有符号）
-            let unmatched_raw = bytes_to_u16_le(&data[offset + 10..offset + 12]) as i16;
+            let unmatched_raw = bytes_to_u16_le(&record[10..12]) as i16;
             let (unmatched, flag) = if unmatched_raw < 0 {
-                ((-unmatched_raw) as i64, -1i8)
+                (unmatched_raw.unsigned_abs() as i64, -1i8)
             } else {
                 (unmatched_raw as i64, 1i8)
             };
 
-            let second = data[offset + 15] as u32;
+            let second = record[15] as u32;
 
             // 构造时间（使用当天日期）
             let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
@@ -1033,8 +1156,6 @@ impl CallAuctionMsg {
                 unmatched,
                 flag,
             });
-
-            offset += 16;
         }
 
         Ok(CallAuctionResponse { count, list })
@@ -1059,27 +1180,27 @@ impl GbbqMsg {
     }
 
     /// 解码股本变迁响应
+    ///
+    /// 无法识别的类别不会中断解码，也不计入 `list`，原始字段保存在 `unknown` 中
     pub fn decode_response(data: &[u8]) -> Result<GbbqResponse, MessageError> {
-        if data.len() < 11 {
-            return Err(MessageError::InsufficientData);
-        }
-
-        let count = bytes_to_u16_le(&data[9..11]);
-        let mut offset = 11;
+        let mut reader = ByteReader::new(data);
+        reader.skip(9)?;
+        let count = reader.read_u16()?;
         let mut list = Vec::with_capacity(count as usize);
+        let mut unknown = Vec::new();
 
         for _ in 0..count {
-            if offset + 29 > data.len() {
-                return Err(MessageError::InsufficientData);
-            }
+            // 每条记录29字节：13字节头部 + 16字节数据
+            let head = reader.read_bytes(13)?;
+            let fields = reader.read_bytes(16)?;
 
             // 交易所 + 代码
-            let exchange = Exchange::from_u8(data[offset]).unwrap_or(Exchange::SZ);
-            let code_str = String::from_utf8_lossy(&data[offset + 1..offset + 7]).to_string();
+            let exchange = Exchange::from_u8(head[0]).unwrap_or(Exchange::SZ);
+            let code_str = String::from_utf8_lossy(&head[1..7]).to_string();
             let code = format!("{}{}", exchange.as_str(), code_str);
 
             // 时间（4字节，日期格式）
-            let time_val = bytes_to_u32_le(&data[offset + 8..offset + 12]);
+            let time_val = bytes_to_u32_le(&head[8..12]);
             let year = (time_val / 10000) as i32;
             let month = ((time_val % 10000) / 100) as u32;
             let day = (time_val % 100) as u32;
@@ -1090,77 +1211,41 @@ impl GbbqMsg {
                 .map(|dt| dt.timestamp())
                 .unwrap_or(0);
 
-            let category = data[offset + 12] as i32;
-            offset += 13;
+            let category = head[12] as i32;
+            let float = |i: usize| {
+                f32::from_le_bytes([fields[i], fields[i + 1], fields[i + 2], fields[i + 3]]) as f64
+            };
 
             // 根据类别解析4个浮点数
             let (c1, c2, c3, c4) = match category {
-                1 => {
-                    // 除权除息：分红、配股价、送转股、配股
-                    let c1 = f32::from_le_bytes([
-                        data[offset],
-                        data[offset + 1],
-                        data[offset + 2],
-                        data[offset + 3],
-                    ]) as f64;
-                    let c2 = f32::from_le_bytes([
-                        data[offset + 4],
-                        data[offset + 5],
-                        data[offset + 6],
-                        data[offset + 7],
-                    ]) as f64;
-                    let c3 = f32::from_le_bytes([
-                        data[offset + 8],
-                        data[offset + 9],
-                        data[offset + 10],
-                        data[offset + 11],
-                    ]) as f64;
-                    let c4 = f32::from_le_bytes([
-                        data[offset + 12],
-                        data[offset + 13],
-                        data[offset + 14],
-                        data[offset + 15],
-                    ]) as f64;
+                // 除权除息：分红、配股价、送转股、配股
+                1 => (float(0), float(4), float(8), float(12)),
+                // 扩缩股
+                11 | 12 => (0.0, 0.0, float(8), 0.0),
+                // 权证
+                13 | 14 => (float(0), 0.0, float(8), 0.0),
+                2..=10 => {
+                    // 股本变化：前流通、前总股本、后流通、后总股本
+                    let c1 = decode_volume2(&fields[0..4]) * 1e4;
+                    let c2 = decode_volume2(&fields[4..8]) * 1e4;
+                    let c3 = decode_volume2(&fields[8..12]) * 1e4;
+                    let c4 = decode_volume2(&fields[12..16]) * 1e4;
                     (c1, c2, c3, c4)
                 }
-                11 | 12 => {
-                    // 扩缩股
-                    let c3 = f32::from_le_bytes([
-                        data[offset + 8],
-                        data[offset + 9],
-                        data[offset + 10],
-                        data[offset + 11],
-                    ]) as f64;
-                    (0.0, 0.0, c3, 0.0)
-                }
-                13 | 14 => {
-                    // 权证
-                    let c1 = f32::from_le_bytes([
-                        data[offset],
-                        data[offset + 1],
-                        data[offset + 2],
-                        data[offset + 3],
-                    ]) as f64;
-                    let c3 = f32::from_le_bytes([
-                        data[offset + 8],
-                        data[offset + 9],
-                        data[offset + 10],
-                        data[offset + 11],
-                    ]) as f64;
-                    (c1, 0.0, c3, 0.0)
-                }
                 _ => {
-                    // 股本变化：前流通、前总股本、后流通、后总股本
-                    let c1 = decode_volume2(&data[offset..offset + 4]) * 1e4;
-                    let c2 = decode_volume2(&data[offset + 4..offset + 8]) * 1e4;
-                    let c3 = decode_volume2(&data[offset + 8..offset + 12]) * 1e4;
-                    let c4 = decode_volume2(&data[offset + 12..offset + 16]) * 1e4;
-                    (c1, c2, c3, c4)
+                    // 无法识别的类别，保留原始字段
+                    let mut raw = [0u8; 16];
+                    raw.copy_from_slice(fields);
+                    unknown.push(UnknownGbbq {
+                        code,
+                        time,
+                        category,
+                        raw,
+                    });
+                    continue;
                 }
             };
 
-            offset += 16;
-
             list.push(Gbbq {
                 code,
                 time,
@@ -1172,7 +1257,188 @@ impl GbbqMsg {
             });
         }
 
-        Ok(GbbqResponse { count, list })
+        Ok(GbbqResponse {
+            count,
+            list,
+            unknown,
+        })
+    }
+}
+
+// ==================== 财务信息消息 ====================
+
+/// 财务信息消息
+pub struct FinanceInfoMsg;
+
+impl FinanceInfoMsg {
+    /// 响应数据长度：数量(2) + 交易所(1) + 代码(6) + 财务数据(136)
+    const RESPONSE_SIZE: usize = 145;
+
+    /// 创建财务信息请求帧
+    pub fn request(msg_id: u32, code: &str) -> Result<RequestFrame, MessageError> {
+        let (exchange, number) = decode_code(code)?;
+
+        let mut data = vec![0x01, 0x00];
+        data.push(exchange.as_u8());
+        data.extend_from_slice(number.as_bytes());
+
+        Ok(RequestFrame::new(msg_id, MessageType::FinanceInfo, data))
+    }
+
+    /// 解码财务信息响应
+    pub fn decode_response(data: &[u8]) -> Result<FinanceInfo, MessageError> {
+        if data.len() < Self::RESPONSE_SIZE {
+            return Err(MessageError::InsufficientData);
+        }
+
+        let exchange = Exchange::from_u8(data[2]).unwrap_or(Exchange::SZ);
+        let code = String::from_utf8_lossy(&data[3..9]).to_string();
+        let f = |pos: usize| f32::from_le_bytes(data[pos..pos + 4].try_into().unwrap()) as f64;
+
+        // 前5项之后为连续的30个 f32
+        let v = |i: usize| f(25 + i * 4);
+
+        Ok(FinanceInfo {
+            exchange,
+            code,
+            float_shares: f(9),
+            province: bytes_to_u16_le(&data[13..15]),
+            industry: bytes_to_u16_le(&data[15..17]),
+            updated_date: bytes_to_u32_le(&data[17..21]),
+            ipo_date: bytes_to_u32_le(&data[21..25]),
+            total_shares: v(0),
+            state_shares: v(1),
+            promoter_shares: v(2),
+            legal_person_shares: v(3),
+            b_shares: v(4),
+            h_shares: v(5),
+            staff_shares: v(6),
+            total_assets: v(7),
+            current_assets: v(8),
+            fixed_assets: v(9),
+            intangible_assets: v(10),
+            shareholders: v(11),
+            current_liabilities: v(12),
+            long_term_liabilities: v(13),
+            capital_reserve: v(14),
+            net_assets: v(15),
+            main_revenue: v(16),
+            main_profit: v(17),
+            receivables: v(18),
+            operating_profit: v(19),
+            investment_income: v(20),
+            operating_cash_flow: v(21),
+            total_cash_flow: v(22),
+            inventory: v(23),
+            total_profit: v(24),
+            profit_after_tax: v(25),
+            net_profit: v(26),
+            undistributed_profit: v(27),
+        })
+    }
+}
+
+// ==================== 板块消息 ====================
+
+/// 板块消息
+///
+/// 板块数据以文件形式下发：先请求文件信息获取大小，再分块下载文件内容
+pub struct BlockMsg;
+
+impl BlockMsg {
+    /// 单次下载的最大字节数
+    pub const CHUNK_SIZE: u32 = 30000;
+
+    /// 创建板块文件信息请求帧
+    pub fn meta_request(msg_id: u32, file: &str) -> RequestFrame {
+        let mut data = file.as_bytes().to_vec();
+        data.resize(40, 0);
+        RequestFrame::new(msg_id, MessageType::BlockMeta, data)
+    }
+
+    /// 解码板块文件信息响应
+    pub fn decode_meta_response(data: &[u8]) -> Result<BlockMeta, MessageError> {
+        if data.len() < 38 {
+            return Err(MessageError::InsufficientData);
+        }
+        let size = bytes_to_u32_le(&data[0..4]);
+        let hash = gbk_to_utf8(&data[5..37]);
+        Ok(BlockMeta { size, hash })
+    }
+
+    /// 创建板块文件内容请求帧
+    pub fn request(msg_id: u32, file: &str, start: u32, size: u32) -> RequestFrame {
+        let mut data = u32_to_bytes_le(start).to_vec();
+        data.extend_from_slice(&u32_to_bytes_le(size));
+        let mut name = file.as_bytes().to_vec();
+        name.resize(100, 0);
+        data.extend_from_slice(&name);
+        RequestFrame::new(msg_id, MessageType::BlockInfo, data)
+    }
+
+    /// 解码板块文件内容响应，返回本次下载的文件片段
+    pub fn decode_response(data: &[u8]) -> Result<Vec<u8>, MessageError> {
+        if data.len() < 4 {
+            return Err(MessageError::InsufficientData);
+        }
+        // 前4字节为片段长度
+        let size = bytes_to_u32_le(&data[0..4]) as usize;
+        if data.len() - 4 < size {
+            return Err(MessageError::InsufficientData);
+        }
+        Ok(data[4..].to_vec())
+    }
+
+    /// 解析完整的板块文件
+    ///
+    /// 文件格式：
+    /// - 前384字节为文件头
+    /// - 2字节板块数量
+    /// - 每个板块固定2813字节：名称(9字节GBK) + 成分股数量(2字节) + 板块类型(2字节)
+    ///   + 成分股(400 x 7字节，6位代码 + 0x00)
+    pub fn parse_file(data: &[u8]) -> Result<Vec<Block>, MessageError> {
+        const HEADER_SIZE: usize = 384;
+        const BLOCK_SIZE: usize = 9 + 2 + 2 + 2800;
+
+        if data.len() < HEADER_SIZE + 2 {
+            return Err(MessageError::InsufficientData);
+        }
+
+        let count = bytes_to_u16_le(&data[HEADER_SIZE..HEADER_SIZE + 2]);
+        let mut offset = HEADER_SIZE + 2;
+        let mut blocks = Vec::with_capacity(count as usize);
+
+        for _ in 0..count {
+            if offset + 13 > data.len() {
+                return Err(MessageError::InsufficientData);
+            }
+
+            let name = gbk_to_utf8(&data[offset..offset + 9]);
+            let stock_count = bytes_to_u16_le(&data[offset + 9..offset + 11]) as usize;
+            let block_type = bytes_to_u16_le(&data[offset + 11..offset + 13]);
+
+            let codes_start = offset + 13;
+            if stock_count > 400 || codes_start + stock_count * 7 > data.len() {
+                return Err(MessageError::InsufficientData);
+            }
+
+            let codes = (0..stock_count)
+                .map(|i| {
+                    let start = codes_start + i * 7;
+                    String::from_utf8_lossy(&data[start..start + 6]).to_string()
+                })
+                .collect();
+
+            blocks.push(Block {
+                name,
+                block_type,
+                codes,
+            });
+
+            offset += BLOCK_SIZE;
+        }
+
+        Ok(blocks)
     }
 }
 
@@ -3,19 +3,33 @@ pub mod frame;
 pub mod types;
 pub mod codec;
 pub mod messages;
+pub mod kline_util;
+pub mod quote_util;
+pub mod trade_util;
+pub mod code_util;
+pub mod market;
 
 #[cfg(any(test, feature = "test-data"))]
 pub mod test_data;
 
-pub use constants::{Control, Exchange, KlineType, MessageType, PREFIX, PREFIX_RESP};
-pub use frame::{FrameError, RequestFrame, ResponseFrame};
+pub use constants::{BlockFile, Control, Exchange, KlineType, MessageType, PREFIX, PREFIX_RESP};
+pub use frame::{
+    check_frame_size, decode_batch, inflate, FrameError, FrameScanner, RawFrame, RequestFrame,
+    ResponseFrame, CONTROL_ERROR, DEFAULT_MAX_FRAME_SIZE,
+};
 pub use types::{
-    CallAuction, CallAuctionResponse, Gbbq, GbbqResponse, K, Kline, KlineCache, KlineResponse,
-    MinuteResponse, Price, PriceLevel, PriceLevels, PriceNumber, QuoteInfo, StockCode, Trade,
-    TradeResponse, TradeStatus,
+    Block, BlockMembership, BlockMeta, CallAuction, CallAuctionResponse, DailyOhlc, Depth,
+    FinanceInfo, Gbbq, GbbqResponse, K, Kline, KlineCache, KlineResponse, MinuteResponse, Price,
+    PriceConvention, PriceLevel, PriceLevels, PriceNumber, QuoteInfo, ServerNotice, StockCode,
+    Trade, TradeResponse, TradeStatus, UnknownGbbq,
 };
 pub use codec::*;
 pub use messages::*;
+pub use kline_util::*;
+pub use quote_util::*;
+pub use trade_util::*;
+pub use code_util::*;
+pub use market::*;
 
 #[cfg(any(test, feature = "test-data"))]
 pub use test_data::TestData;
@@ -0,0 +1,288 @@
+//! 行情工具函数
+
+use crate::protocol::{
+    constants::Exchange,
+    types::{Gbbq, Price, PriceLevel, PriceLevels, QuoteInfo},
+};
+use std::collections::HashMap;
+use std::fmt;
+
+/// 价格变动方向
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PriceDirection {
+    Up,        // 上涨
+    Down,      // 下跌
+    Unchanged, // 不变
+}
+
+/// 行情变化类型
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum QuoteChangeKind {
+    Added,   // 新出现的代码
+    Removed, // 消失的代码
+    Updated, // 行情有变化
+}
+
+/// 两次行情快照之间单只股票的变化
+#[derive(Debug, Clone)]
+pub struct QuoteChange {
+    pub exchange: Exchange,        // 市场
+    pub code: String,              // 股票代码
+    pub kind: QuoteChangeKind,     // 变化类型
+    pub direction: PriceDirection, // 现价变动方向
+    pub price_changed: bool,       // 现价是否变化
+    pub volume_changed: bool,      // 成交量是否变化
+    pub book_changed: bool,        // 5档盘口是否变化
+}
+
+/// 比较两档盘口是否一致
+fn levels_equal(a: &PriceLevels, b: &PriceLevels) -> bool {
+    a.iter()
+        .zip(b.iter())
+        .all(|(x, y)| x.price == y.price && x.number == y.number)
+}
+
+/// 比较两次行情快照，返回有变化的股票
+///
+/// 按 市场+代码 匹配，与快照中的顺序无关。先按 `cur` 的顺序返回新增和变化的股票，
+/// 再按 `prev` 的顺序返回消失的股票。没有任何变化的股票不会出现在结果中
+pub fn diff_quotes(prev: &[QuoteInfo], cur: &[QuoteInfo]) -> Vec<QuoteChange> {
+    let prev_map: HashMap<(Exchange, &str), &QuoteInfo> = prev
+        .iter()
+        .map(|q| ((q.exchange, q.code.as_str()), q))
+        .collect();
+    let cur_map: HashMap<(Exchange, &str), &QuoteInfo> = cur
+        .iter()
+        .map(|q| ((q.exchange, q.code.as_str()), q))
+        .collect();
+
+    let mut changes = Vec::new();
+
+    for q in cur {
+        let change = match prev_map.get(&(q.exchange, q.code.as_str())) {
+            Some(p) => {
+                let direction = match q.k.close.cmp(&p.k.close) {
+                    std::cmp::Ordering::Greater => PriceDirection::Up,
+                    std::cmp::Ordering::Less => PriceDirection::Down,
+                    std::cmp::Ordering::Equal => PriceDirection::Unchanged,
+                };
+                let price_changed = direction != PriceDirection::Unchanged;
+                let volume_changed = q.total_hand != p.total_hand;
+                let book_changed = !levels_equal(&q.buy_level, &p.buy_level)
+                    || !levels_equal(&q.sell_level, &p.sell_level);
+                if !price_changed && !volume_changed && !book_changed {
+                    continue;
+                }
+                QuoteChange {
+                    exchange: q.exchange,
+                    code: q.code.clone(),
+                    kind: QuoteChangeKind::Updated,
+                    direction,
+                    price_changed,
+                    volume_changed,
+                    book_changed,
+                }
+            }
+            None => QuoteChange {
+                exchange: q.exchange,
+                code: q.code.clone(),
+                kind: QuoteChangeKind::Added,
+                direction: PriceDirection::Unchanged,
+                price_changed: false,
+                volume_changed: false,
+                book_changed: false,
+            },
+        };
+        changes.push(change);
+    }
+
+    for p in prev {
+        if !cur_map.contains_key(&(p.exchange, p.code.as_str())) {
+            changes.push(QuoteChange {
+                exchange: p.exchange,
+                code: p.code.clone(),
+                kind: QuoteChangeKind::Removed,
+                direction: PriceDirection::Unchanged,
+                price_changed: false,
+                volume_changed: false,
+                book_changed: false,
+            });
+        }
+    }
+
+    changes
+}
+
+/// 两次行情快照之间的增量成交
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct FlowDelta {
+    pub volume_delta: i64,         // 增量成交量（手）
+    pub amount_delta: Price,       // 增量成交额（厘）
+    pub avg_price: Price,          // 增量成交均价，无成交时为0
+    pub direction: PriceDirection, // 现价变动方向
+    pub new_day: bool,             // 累计成交量回落，视为新交易日
+}
+
+/// 计算两次行情快照之间的增量成交，用于估算逐笔资金流向
+///
+/// 当 `cur` 的累计成交量小于 `prev` 时视为跨日重置，增量取 `cur` 的累计值
+pub fn quote_flow(prev: &QuoteInfo, cur: &QuoteInfo) -> FlowDelta {
+    let new_day = cur.total_hand < prev.total_hand;
+    let (volume_delta, amount_delta) = if new_day {
+        (cur.total_hand as i64, cur.amount)
+    } else {
+        (
+            (cur.total_hand - prev.total_hand) as i64,
+            Price(cur.amount.as_i64() - prev.amount.as_i64()),
+        )
+    };
+
+    let avg_price = if volume_delta > 0 {
+        Price::from_yuan(amount_delta.to_yuan() / (volume_delta as f64 * 100.0))
+    } else {
+        Price(0)
+    };
+
+    let direction = if new_day {
+        PriceDirection::Unchanged
+    } else {
+        match cur.k.close.cmp(&prev.k.close) {
+            std::cmp::Ordering::Greater => PriceDirection::Up,
+            std::cmp::Ordering::Less => PriceDirection::Down,
+            std::cmp::Ordering::Equal => PriceDirection::Unchanged,
+        }
+    };
+
+    FlowDelta {
+        volume_delta,
+        amount_delta,
+        avg_price,
+        direction,
+        new_day,
+    }
+}
+
+/// 交易状态
+///
+/// 标准行情（0x053E）中没有交易状态字段，只能区分正常交易与停牌，
+/// 无法识别临时停牌、退市整理等细分状态
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TradingStatus {
+    Normal, // 正常交易
+    Halted, // 停牌
+}
+
+impl fmt::Display for TradingStatus {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            TradingStatus::Normal => write!(f, "正常"),
+            TradingStatus::Halted => write!(f, "停牌"),
+        }
+    }
+}
+
+/// 根据行情推断交易状态
+///
+/// 开盘价为0且没有成交视为停牌。开盘集合竞价（09:25）结束前所有股票的开盘价都为0，
+/// 此时的结果不可靠
+pub fn trading_status(quote: &QuoteInfo) -> TradingStatus {
+    if quote.k.open.0 == 0 && quote.total_hand == 0 {
+        TradingStatus::Halted
+    } else {
+        TradingStatus::Normal
+    }
+}
+
+/// 市场涨跌统计
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Breadth {
+    pub advancing: usize, // 上涨家数
+    pub declining: usize, // 下跌家数
+    pub unchanged: usize, // 平盘家数
+    pub halted: usize,    // 停牌家数（不计入涨跌和成交）
+    pub volume: i64,      // 总成交量（手）
+    pub amount: Price,    // 总成交额（厘）
+}
+
+impl Breadth {
+    /// 参与统计的家数（不含停牌）
+    pub fn total(&self) -> usize {
+        self.advancing + self.declining + self.unchanged
+    }
+}
+
+/// 统计一组行情的涨跌家数和成交合计
+///
+/// 现价与昨收比较；停牌（见 [`trading_status`]）的股票只计入 `halted`，
+/// 昨收为0（无效或退市的代码）的行情不参与统计
+pub fn market_breadth(quotes: &[QuoteInfo]) -> Breadth {
+    let mut breadth = Breadth::default();
+    for q in quotes {
+        if q.k.last.0 <= 0 {
+            continue;
+        }
+        if trading_status(q) == TradingStatus::Halted {
+            breadth.halted += 1;
+            continue;
+        }
+        match q.k.close.cmp(&q.k.last) {
+            std::cmp::Ordering::Greater => breadth.advancing += 1,
+            std::cmp::Ordering::Less => breadth.declining += 1,
+            std::cmp::Ordering::Equal => breadth.unchanged += 1,
+        }
+        breadth.volume += q.total_hand as i64;
+        breadth.amount = Price(breadth.amount.as_i64() + q.amount.as_i64());
+    }
+    breadth
+}
+
+/// 计算涨跌幅（小数，如 0.0123 表示 1.23%），除权除息日按除权参考价计算
+///
+/// `today_xdxr` 为当天生效的除权除息记录（[`Gbbq::is_xrxd`]），没有时传 None，
+/// 此时与直接用昨收计算一致。昨收为0时返回0
+pub fn adjusted_change(quote: &QuoteInfo, today_xdxr: Option<&Gbbq>) -> f64 {
+    let last = match today_xdxr {
+        Some(x) => x.ex_right_price(quote.k.last),
+        None => quote.k.last,
+    };
+    if last.0 == 0 {
+        return 0.0;
+    }
+    (quote.k.close.0 - last.0) as f64 / last.0 as f64
+}
+
+/// 解析行情中的服务器时间（[`QuoteInfo::server_time`]），返回当天的秒数（北京时间）
+///
+/// 格式为 时 + 6位小时内偏移：偏移前两位小于60时为 分(2位) + 分钟的万分之一(4位)，
+/// 否则整体为小时的百万分之一（与 pytdx 的 `_format_time` 一致）。
+/// 如样本 quote.json 中的 `13253581` 为 13:25:21。无法识别时返回 None
+pub fn server_time_of_day(server_time: &str) -> Option<u32> {
+    let value: u64 = server_time.trim().parse().ok()?;
+    let hour = value / 1_000_000;
+    let rest = value % 1_000_000;
+    let (minute, second) = if rest / 10_000 < 60 {
+        (rest / 10_000, rest % 10_000 * 60 / 10_000)
+    } else {
+        (
+            rest * 60 / 1_000_000,
+            rest * 60 % 1_000_000 * 60 / 1_000_000,
+        )
+    };
+    if hour >= 24 || minute >= 60 || second >= 60 {
+        return None;
+    }
+    Some((hour * 3600 + minute * 60 + second) as u32)
+}
+
+/// 将5档盘口整理为第0档是最优价：买盘价格从高到低，卖盘价格从低到高
+///
+/// 不同服务器返回的档位顺序可能相反，这里按价格重新排序而不是依赖服务器顺序。
+/// 数量为0或价格不为正的空档位（如涨跌停时一侧无挂单）排在最后，保持原有顺序
+pub fn normalize_levels(levels: &mut PriceLevels) {
+    let is_empty = |level: &PriceLevel| level.number == 0 || level.price.0 <= 0;
+    levels.sort_by(|a, b| match (is_empty(a), is_empty(b)) {
+        (false, false) if a.buy => b.price.cmp(&a.price),
+        (false, false) => a.price.cmp(&b.price),
+        (a_empty, b_empty) => a_empty.cmp(&b_empty),
+    });
+}
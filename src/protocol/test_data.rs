@@ -1,5 +1,6 @@
 //! 测试数据结构定义
 
+use crate::protocol::constants::MessageType;
 use serde::{Deserialize, Serialize};
 
 #[cfg(feature = "test-data")]
@@ -43,6 +44,11 @@ pub struct TestData {
 }
 
 impl TestData {
+    /// 解析 `type_value` 对应的消息类型
+    pub fn message_type(&self) -> Option<MessageType> {
+        MessageType::from_type_value(&self.type_value)
+    }
+
     /// 解码请求帧的十六进制字符串
     #[cfg(feature = "test-data")]
     pub fn decode_request(&self) -> Result<Vec<u8>, hex::FromHexError> {
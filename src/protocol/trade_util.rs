@@ -0,0 +1,51 @@
+//! 成交明细工具函数
+
+use crate::protocol::types::{Price, Trade, TradeStatus};
+use std::time::Duration;
+
+/// 合并后的成交
+#[derive(Debug, Clone, PartialEq)]
+pub struct TickAgg {
+    pub first_time: i64,     // 第一笔成交时间（Unix时间戳，秒）
+    pub last_time: i64,      // 最后一笔成交时间（Unix时间戳，秒）
+    pub price: Price,        // 成交价
+    pub volume: i64,         // 合计成交量（手）
+    pub number: i64,         // 合计单数（历史数据无效）
+    pub status: TradeStatus, // 买卖方向
+    pub count: usize,        // 合并的成交笔数
+}
+
+/// 合并相邻的同价同向成交
+///
+/// 连续的、价格与方向都相同、且与该组第一笔的时间差不超过 `window` 的成交合并为一条，
+/// 成交量与单数累加，保留首末时间。价格或方向变化、超出时间窗口时开始新的一组
+pub fn aggregate_ticks(ticks: &[Trade], window: Duration) -> Vec<TickAgg> {
+    let window = window.as_secs() as i64;
+    let mut result: Vec<TickAgg> = Vec::new();
+
+    for t in ticks {
+        match result.last_mut() {
+            Some(agg)
+                if agg.price == t.price
+                    && agg.status == t.status
+                    && t.time - agg.first_time <= window =>
+            {
+                agg.last_time = t.time;
+                agg.volume += t.volume as i64;
+                agg.number += t.number as i64;
+                agg.count += 1;
+            }
+            _ => result.push(TickAgg {
+                first_time: t.time,
+                last_time: t.time,
+                price: t.price,
+                volume: t.volume as i64,
+                number: t.number as i64,
+                status: t.status,
+                count: 1,
+            }),
+        }
+    }
+
+    result
+}
@@ -1,7 +1,9 @@
 //! 协议数据类型定义
 
-use crate::protocol::constants::Exchange;
-use chrono::{FixedOffset, TimeZone, Utc};
+use crate::protocol::constants::{BlockFile, Exchange, KlineType};
+use crate::protocol::market::shares_per_lot;
+use crate::protocol::messages::is_index;
+use chrono::{FixedOffset, TimeZone, Timelike, Utc};
 use std::fmt;
 
 /// 格式化 Unix 毫秒时间戳为可读字符串
@@ -16,7 +18,7 @@ fn format_time(timestamp_secs: i64) -> String {
 // 移除不再需要的 is_leap_year
 
 /// 价格类型，单位为厘（1元 = 1000厘）
-#[derive(Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+#[derive(Clone, Copy, Default, PartialEq, Eq, PartialOrd, Ord)]
 pub struct Price(pub i64);
 
 impl Price {
@@ -31,6 +33,20 @@ impl Price {
     pub fn as_i64(self) -> i64 {
         self.0
     }
+
+    /// 精确的十进制表示：(尾数, 小数位数)，价格 = 尾数 / 10^小数位数
+    ///
+    /// 不经过浮点数，可直接交给外部的 decimal 库构造
+    pub fn decimal_parts(self) -> (i64, u32) {
+        (self.0, 3)
+    }
+
+    /// 精确的十进制字符串（单位元，3位小数），如 12.340、-0.005
+    pub fn to_decimal_string(self) -> String {
+        let sign = if self.0 < 0 { "-" } else { "" };
+        let abs = self.0.unsigned_abs();
+        format!("{}{}.{:03}", sign, abs / 1000, abs % 1000)
+    }
 }
 
 impl fmt::Debug for Price {
@@ -95,15 +111,31 @@ pub struct Kline {
     pub high: Price,     // 最高价
     pub low: Price,      // 最低价
     pub close: Price,    // 收盘价
-    pub order: i32,      // 成交单数
-    pub volume: i64,     // 成交量
-    pub amount: Price,   // 成交额
+    pub order: i32,      // 成交笔数（K线响应中没有该字段，解码结果恒为0）
+    pub volume: i64,     // 成交量（股/张），解码时已按K线类型、指数和每手数量统一单位
+    pub amount: Price,   // 成交额（厘，i64）
     pub time: i64,       // 时间（Unix时间戳，秒）
     pub up_count: i32,   // 上涨数量（指数有效）
     pub down_count: i32, // 下跌数量（指数有效）
 }
 
 impl Kline {
+    /// 成交量（手），每手数量见 [`shares_per_lot`]
+    pub fn volume_lots(&self, code: &str) -> i64 {
+        self.volume / shares_per_lot(code) as i64
+    }
+
+    /// 平均每笔成交量（股），成交笔数未知（为0）时返回 None
+    ///
+    /// K线协议（0x052D）的股票、基金和指数K线都不包含成交笔数，
+    /// 需要时可由分时成交明细按K线周期汇总后填入 `order`
+    pub fn avg_trade_size(&self) -> Option<f64> {
+        if self.order <= 0 {
+            return None;
+        }
+        Some(self.volume as f64 / self.order as f64)
+    }
+
     /// 格式化时间
     pub fn time_str(&self) -> String {
         format_time(self.time)
@@ -165,6 +197,25 @@ pub struct Trade {
     pub number: i32,         // 单数（历史数据无效）
 }
 
+impl Trade {
+    /// 是否为集合竞价成交
+    ///
+    /// 成交明细中没有区分集合竞价的标志字节，按成交时间（北京时间）判断：
+    /// - 09:30 之前为开盘集合竞价（通常为 09:25 的一笔）
+    /// - 14:57 及之后为收盘集合竞价（通常为 15:00 的一笔）
+    pub fn is_auction(&self) -> bool {
+        let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+        let minutes = match Utc.timestamp_opt(self.time, 0).single() {
+            Some(dt) => {
+                let t = dt.with_timezone(&beijing_offset);
+                t.hour() * 60 + t.minute()
+            }
+            None => return false,
+        };
+        minutes < 9 * 60 + 30 || minutes >= 14 * 60 + 57
+    }
+}
+
 impl fmt::Debug for Trade {
     fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
         write!(
@@ -198,6 +249,8 @@ impl fmt::Debug for TradeStatus {
 }
 
 /// 股票代码信息
+///
+/// 代码列表响应中没有拼音简称字段，按拼音首字母检索需由调用方根据名称生成
 #[derive(Clone)]
 pub struct StockCode {
     pub name: String,    // 股票名称
@@ -221,23 +274,34 @@ impl fmt::Debug for StockCode {
     }
 }
 
+/// 价格约定
+///
+/// 债券行情为每100元面值的净价，协议中没有全价（含应计利息）字段
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum PriceConvention {
+    #[default]
+    PerShare, // 每股/每份价格
+    PerHundredFace, // 每100元面值的净价（债券）
+}
+
 /// 行情信息
 #[derive(Clone)]
 pub struct QuoteInfo {
-    pub exchange: Exchange,      // 市场
-    pub code: String,            // 股票代码
-    pub active1: u16,            // 活跃度
-    pub k: K,                    // K线
-    pub server_time: String,     // 服务器时间
-    pub total_hand: i32,         // 总手
-    pub intuition: i32,          // 现量
-    pub amount: f64,             // 金额
-    pub inside_dish: i32,        // 内盘
-    pub outer_disc: i32,         // 外盘
-    pub buy_level: PriceLevels,  // 5档买盘
-    pub sell_level: PriceLevels, // 5档卖盘
-    pub rate: f64,               // 涨速
-    pub active2: u16,            // 活跃度
+    pub exchange: Exchange,                // 市场
+    pub code: String,                      // 股票代码
+    pub active1: u16,                      // 活跃度
+    pub k: K,                              // K线
+    pub server_time: String,               // 服务器时间
+    pub total_hand: i32,                   // 总手
+    pub intuition: i32,                    // 现量
+    pub amount: Price,                     // 成交额（厘，i64）
+    pub inside_dish: i32,                  // 内盘
+    pub outer_disc: i32,                   // 外盘
+    pub buy_level: PriceLevels,            // 5档买盘（第0档为最高买价，空档位在最后）
+    pub sell_level: PriceLevels,           // 5档卖盘（第0档为最低卖价，空档位在最后）
+    pub rate: f64,                         // 涨速
+    pub active2: u16,                      // 活跃度
+    pub price_convention: PriceConvention, // 价格约定
 }
 
 impl fmt::Debug for QuoteInfo {
@@ -259,7 +323,7 @@ impl fmt::Debug for QuoteInfo {
             change,
             change_pct,
             self.total_hand,
-            self.amount / 10000.0
+            self.amount.to_yuan() / 10000.0
         )?;
 
         // K线数据
@@ -314,16 +378,212 @@ impl fmt::Debug for QuoteInfo {
     }
 }
 
+impl QuoteInfo {
+    /// 当日成交均价（成交额 / 成交量），无成交时返回 None
+    ///
+    /// 行情响应中没有均价字段，按通达信的算法由总成交额和总手数计算；
+    /// 每手按100股（份）计，债券按每手10张计
+    pub fn avg_price(&self) -> Option<Price> {
+        let per_hand = match self.price_convention {
+            PriceConvention::PerShare => 100.0,
+            PriceConvention::PerHundredFace => 10.0,
+        };
+        if self.total_hand <= 0 {
+            return None;
+        }
+        let avg = self.amount.to_yuan() / (self.total_hand as f64 * per_hand);
+        Some(Price((avg * 1000.0).round() as i64))
+    }
+}
+
+/// 单只股票的5档盘口
+#[derive(Clone)]
+pub struct Depth {
+    pub exchange: Exchange,      // 市场
+    pub code: String,            // 股票代码
+    pub last_price: Price,       // 现价
+    pub server_time: String,     // 服务器时间
+    pub buy_level: PriceLevels,  // 5档买盘
+    pub sell_level: PriceLevels, // 5档卖盘
+}
+
+impl From<&QuoteInfo> for Depth {
+    fn from(q: &QuoteInfo) -> Self {
+        Self {
+            exchange: q.exchange,
+            code: q.code.clone(),
+            last_price: q.k.close,
+            server_time: q.server_time.clone(),
+            buy_level: q.buy_level.clone(),
+            sell_level: q.sell_level.clone(),
+        }
+    }
+}
+
+impl fmt::Debug for Depth {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{}{} 现价:{:.3}",
+            self.exchange.as_str(),
+            self.code,
+            self.last_price.to_yuan()
+        )?;
+        for (i, level) in self.sell_level.iter().enumerate().rev() {
+            write!(
+                f,
+                " 卖{}:{:.3}x{}",
+                i + 1,
+                level.price.to_yuan(),
+                level.number
+            )?;
+        }
+        for (i, level) in self.buy_level.iter().enumerate() {
+            write!(
+                f,
+                " 买{}:{:.3}x{}",
+                i + 1,
+                level.price.to_yuan(),
+                level.number
+            )?;
+        }
+        if !self.server_time.is_empty() {
+            write!(f, " 服务器:{}", self.server_time)?;
+        }
+        Ok(())
+    }
+}
+
+/// 当日开高低收汇总（来自实时行情）
+#[derive(Debug, Clone)]
+pub struct DailyOhlc {
+    pub last: Price,   // 昨收价
+    pub open: Price,   // 开盘价
+    pub high: Price,   // 最高价
+    pub low: Price,    // 最低价
+    pub close: Price,  // 收盘价，盘中为现价
+    pub volume: i32,   // 成交量（手）
+    pub amount: Price, // 成交额（厘，i64）
+}
+
+impl From<&QuoteInfo> for DailyOhlc {
+    fn from(q: &QuoteInfo) -> Self {
+        Self {
+            last: q.k.last,
+            open: q.k.open,
+            high: q.k.high,
+            low: q.k.low,
+            close: q.k.close,
+            volume: q.total_hand,
+            amount: q.amount,
+        }
+    }
+}
+
+/// 财务信息
+///
+/// 股本、资产、利润等数值为服务器原始值，单位为万股/万元
+#[derive(Debug, Clone)]
+pub struct FinanceInfo {
+    pub exchange: Exchange,         // 市场
+    pub code: String,               // 股票代码
+    pub float_shares: f64,          // 流通股本
+    pub province: u16,              // 所属省份
+    pub industry: u16,              // 所属行业
+    pub updated_date: u32,          // 更新日期 YYYYMMDD
+    pub ipo_date: u32,              // 上市日期 YYYYMMDD，0表示未知
+    pub total_shares: f64,          // 总股本
+    pub state_shares: f64,          // 国家股
+    pub promoter_shares: f64,       // 发起人法人股
+    pub legal_person_shares: f64,   // 法人股
+    pub b_shares: f64,              // B股
+    pub h_shares: f64,              // H股
+    pub staff_shares: f64,          // 职工股
+    pub total_assets: f64,          // 总资产
+    pub current_assets: f64,        // 流动资产
+    pub fixed_assets: f64,          // 固定资产
+    pub intangible_assets: f64,     // 无形资产
+    pub shareholders: f64,          // 股东人数
+    pub current_liabilities: f64,   // 流动负债
+    pub long_term_liabilities: f64, // 长期负债
+    pub capital_reserve: f64,       // 资本公积金
+    pub net_assets: f64,            // 净资产
+    pub main_revenue: f64,          // 主营收入
+    pub main_profit: f64,           // 主营利润
+    pub receivables: f64,           // 应收账款
+    pub operating_profit: f64,      // 营业利润
+    pub investment_income: f64,     // 投资收益
+    pub operating_cash_flow: f64,   // 经营现金流
+    pub total_cash_flow: f64,       // 总现金流
+    pub inventory: f64,             // 存货
+    pub total_profit: f64,          // 利润总额
+    pub profit_after_tax: f64,      // 税后利润
+    pub net_profit: f64,            // 净利润
+    pub undistributed_profit: f64,  // 未分配利润
+}
+
+impl FinanceInfo {
+    /// 上市日期（北京时间当天0点的 Unix 时间戳，秒），未知时返回 None
+    pub fn ipo_time(&self) -> Option<i64> {
+        if self.ipo_date == 0 {
+            return None;
+        }
+        let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+        beijing_offset
+            .with_ymd_and_hms(
+                (self.ipo_date / 10000) as i32,
+                (self.ipo_date % 10000) / 100,
+                self.ipo_date % 100,
+                0,
+                0,
+                0,
+            )
+            .single()
+            .map(|dt| dt.timestamp())
+    }
+}
+
+/// 服务器主动推送的通知帧
+#[derive(Debug, Clone)]
+pub struct ServerNotice {
+    pub msg_id: u32,   // 帧中的消息ID
+    pub msg_type: u16, // 消息类型（不在已知类型中）
+    pub time: i64,     // 接收时间（Unix时间戳，秒）
+    pub text: String,  // GBK解码后的内容
+}
+
 /// 集合竞价数据项
+///
+/// 每条记录是 09:15-09:25 期间某一时刻的竞价快照，按时间排列即为虚拟开盘价的变化过程
 #[derive(Clone)]
 pub struct CallAuction {
     pub time: i64,      // 时间（Unix时间戳，秒）
-    pub price: Price,   // 价格
+    pub price: Price,   // 虚拟开盘价（当前可最大成交的参考价）
     pub matched: i64,   // 匹配量（match 是关键字，改用 matched）
     pub unmatched: i64, // 未匹配量
     pub flag: i8,       // 标志，1表示未匹配量是买单，-1表示未匹配量是卖单
 }
 
+impl CallAuction {
+    /// 虚拟开盘价
+    pub fn reference_price(&self) -> Price {
+        self.price
+    }
+
+    /// 按虚拟开盘价可成交的数量
+    pub fn matchable_volume(&self) -> i64 {
+        self.matched
+    }
+
+    /// 相对昨收的跳空幅度（小数，如 0.02 表示高开 2%），昨收为0时返回0
+    pub fn gap(&self, last: Price) -> f64 {
+        if last.0 == 0 {
+            return 0.0;
+        }
+        (self.price.0 - last.0) as f64 / last.0 as f64
+    }
+}
+
 impl fmt::Debug for CallAuction {
     fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
         let side = if self.flag > 0 { "买" } else { "卖" };
@@ -382,6 +642,21 @@ impl Gbbq {
     pub fn is_xrxd(&self) -> bool {
         self.category == 1
     }
+
+    /// 按除权除息计算除权参考价
+    ///
+    /// 除权参考价 = (前收盘 - 每股分红 + 配股价 × 每股配股) / (1 + 每股送转 + 每股配股)，
+    /// 数据中的分红、送转、配股均为每10股的数量。非除权除息类型返回原价
+    pub fn ex_right_price(&self, prev_close: Price) -> Price {
+        if !self.is_xrxd() {
+            return prev_close;
+        }
+        let cash = self.c1 / 10.0;
+        let bonus = self.c3 / 10.0;
+        let rights = self.c4 / 10.0;
+        let price = (prev_close.to_yuan() - cash + self.c2 * rights) / (1.0 + bonus + rights);
+        Price((price * 1000.0).round() as i64)
+    }
 }
 
 impl Gbbq {
@@ -460,10 +735,28 @@ impl fmt::Debug for Gbbq {
 }
 
 /// K线响应数据
+///
+/// 服务器返回0条时 `list` 为空，不作为错误
 #[derive(Clone)]
 pub struct KlineResponse {
-    pub count: u16,
+    pub count: u16, // 条数（协议不提供分页前的总条数）
     pub list: Vec<Kline>,
+    pub partial: bool, // 最后一根K线是否为未收盘的当前周期K线（由客户端按当前时间和交易日历判断）
+}
+
+impl KlineResponse {
+    /// 按本次调用的需要保留或去掉未收盘K线
+    ///
+    /// `include_partial` 为 true 时原样返回（由 `partial` 标记），为 false 时去掉未收盘K线，
+    /// 只保留已收盘的K线（如回测）
+    pub fn with_partial(mut self, include_partial: bool) -> Self {
+        if !include_partial && self.partial {
+            self.list.pop();
+            self.count = self.list.len() as u16;
+            self.partial = false;
+        }
+        self
+    }
 }
 
 impl fmt::Debug for KlineResponse {
@@ -480,6 +773,8 @@ impl fmt::Debug for KlineResponse {
 }
 
 /// 分时数据响应
+///
+/// 服务器返回0条时 `list` 为空，不作为错误
 #[derive(Clone)]
 pub struct MinuteResponse {
     pub count: u16,
@@ -500,9 +795,11 @@ impl fmt::Debug for MinuteResponse {
 }
 
 /// 交易数据响应
+///
+/// 服务器返回0条时 `list` 为空，不作为错误
 #[derive(Clone)]
 pub struct TradeResponse {
-    pub count: u16,
+    pub count: u16, // 条数（协议不提供分页前的总条数）
     pub list: Vec<Trade>,
 }
 
@@ -520,6 +817,8 @@ impl fmt::Debug for TradeResponse {
 }
 
 /// 集合竞价响应
+///
+/// 服务器返回0条时 `list` 为空，不作为错误
 #[derive(Clone)]
 pub struct CallAuctionResponse {
     pub count: u16,
@@ -540,10 +839,22 @@ impl fmt::Debug for CallAuctionResponse {
 }
 
 /// 股本变迁响应
+///
+/// 服务器返回0条时 `list` 为空，不作为错误
 #[derive(Clone)]
 pub struct GbbqResponse {
     pub count: u16,
     pub list: Vec<Gbbq>,
+    pub unknown: Vec<UnknownGbbq>, // 无法识别类别的记录
+}
+
+/// 无法识别类别的股本变迁记录
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct UnknownGbbq {
+    pub code: String,  // 股票代码（带交易所前缀）
+    pub time: i64,     // 时间（Unix时间戳，秒）
+    pub category: i32, // 类别
+    pub raw: [u8; 16], // 原始的4个字段
 }
 
 impl fmt::Debug for GbbqResponse {
@@ -555,15 +866,65 @@ impl fmt::Debug for GbbqResponse {
         if self.list.len() > 10 {
             writeln!(f, "  ... 还有 {} 条", self.list.len() - 10)?;
         }
+        for u in &self.unknown {
+            writeln!(f, "  未知类别 {}: {:02X?}", u.category, u.raw)?;
+        }
         Ok(())
     }
 }
 
+/// 板块文件信息
+#[derive(Debug, Clone)]
+pub struct BlockMeta {
+    pub size: u32,    // 文件大小（字节）
+    pub hash: String, // 文件哈希
+}
+
+/// 板块
+#[derive(Clone)]
+pub struct Block {
+    pub name: String,       // 板块名称
+    pub block_type: u16,    // 板块类型
+    pub codes: Vec<String>, // 成分股代码（6位，不含交易所前缀）
+}
+
+impl fmt::Debug for Block {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "{} 类型:{} 成分股:{}只",
+            self.name,
+            self.block_type,
+            self.codes.len()
+        )
+    }
+}
+
+/// 股票所属板块
+#[derive(Debug, Clone)]
+pub struct BlockMembership {
+    pub file: BlockFile, // 板块文件
+    pub name: String,    // 板块名称
+    pub block_type: u16, // 板块类型
+}
+
 /// K线缓存信息（用于解码时的上下文）
 #[derive(Clone, Copy)]
 pub struct KlineCache {
     pub kline_type: u8, // K线类型
     pub is_index: bool, // 是否为指数
+    pub lot: u32,       // 每手数量（股票/基金100股，可转债10张）
+}
+
+impl KlineCache {
+    /// 按证券代码推断指数标志和每手数量
+    pub fn new(kline_type: KlineType, code: &str) -> Self {
+        Self {
+            kline_type: kline_type as u8,
+            is_index: is_index(code),
+            lot: shares_per_lot(code),
+        }
+    }
 }
 
 impl fmt::Debug for KlineCache {
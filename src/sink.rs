@@ -0,0 +1,135 @@
+//! 解码结果直接写入外部存储
+
+use crate::client::{Client, ClientError};
+use crate::protocol::*;
+use std::future::Future;
+use std::pin::Pin;
+
+/// 写入错误
+pub type SinkError = Box<dyn std::error::Error + Send + Sync>;
+
+/// 写入返回的 Future
+pub type SinkFuture<'a> = Pin<Box<dyn Future<Output = Result<(), SinkError>> + Send + 'a>>;
+
+/// 数据写入目标（如数据库、列式文件）
+///
+/// 每解码一批数据即调用一次，不在内存中累积全部结果。等待本批写入完成后才请求下一批，
+/// 写入较慢时后续请求随之放慢；返回错误时停止获取，错误以 [`ClientError::Sink`] 返回。
+/// 默认实现忽略对应的数据，只需实现用到的方法
+pub trait Sink: Send {
+    /// 写入一批K线（批内按时间升序）
+    fn write_klines<'a>(
+        &'a mut self,
+        _code: &'a str,
+        _kline_type: KlineType,
+        _klines: &'a [Kline],
+    ) -> SinkFuture<'a> {
+        Box::pin(async { Ok(()) })
+    }
+
+    /// 写入一批分时成交（批内按时间升序）
+    fn write_trades<'a>(&'a mut self, _code: &'a str, _trades: &'a [Trade]) -> SinkFuture<'a> {
+        Box::pin(async { Ok(()) })
+    }
+
+    /// 写入一批行情
+    fn write_quotes<'a>(&'a mut self, _quotes: &'a [QuoteInfo]) -> SinkFuture<'a> {
+        Box::pin(async { Ok(()) })
+    }
+}
+
+impl Client {
+    /// 获取全部K线并逐批写入 `sink`，返回写入的K线数量
+    ///
+    /// 每批最多800根，从最新的一批开始向前获取，批与批之间按时间倒序。
+    /// 分页期间服务器产生新K线时相邻两批会在边界重叠，重叠部分只写入一次
+    pub async fn kline_all_to_sink<S: Sink>(
+        &self,
+        kline_type: KlineType,
+        code: &str,
+        sink: &mut S,
+    ) -> Result<usize, ClientError> {
+        let code = qualify_code(code)?;
+        let batch_size = 800u16;
+        let mut start = 0u16;
+        let mut written = 0;
+        // 已写入的最早K线时间，之后的批次只写入比它更早的部分
+        let mut earliest: Option<i64> = None;
+        loop {
+            let resp = self.get_kline(kline_type, &code, start, batch_size).await?;
+            let len = resp.list.len();
+            let keep = match earliest {
+                Some(time) => resp.list.partition_point(|k| k.time < time),
+                None => len,
+            };
+            if keep > 0 {
+                sink.write_klines(&code, kline_type, &resp.list[..keep])
+                    .await
+                    .map_err(ClientError::Sink)?;
+                earliest = Some(resp.list[0].time);
+                written += keep;
+            }
+            if len < batch_size as usize {
+                return Ok(written);
+            }
+            start = match start.checked_add(batch_size) {
+                Some(start) => start,
+                None => return Ok(written),
+            };
+        }
+    }
+
+    /// 获取当日全部分时成交并逐批写入 `sink`，返回写入的成交数量
+    ///
+    /// 每批最多1800条，从最新的一批开始向前获取，批与批之间按时间倒序
+    pub async fn trade_all_to_sink<S: Sink>(
+        &self,
+        code: &str,
+        sink: &mut S,
+    ) -> Result<usize, ClientError> {
+        let code = qualify_code(code)?;
+        let batch_size = 1800u16;
+        let mut start = 0u16;
+        let mut written = 0;
+        loop {
+            let resp = self.get_trade(&code, start, batch_size).await?;
+            let len = resp.list.len();
+            if len > 0 {
+                sink.write_trades(&code, &resp.list)
+                    .await
+                    .map_err(ClientError::Sink)?;
+                written += len;
+            }
+            if len < batch_size as usize {
+                return Ok(written);
+            }
+            start = match start.checked_add(batch_size) {
+                Some(start) => start,
+                None => return Ok(written),
+            };
+        }
+    }
+
+    /// 获取行情并每80只写入一次 `sink`，返回写入的行情数量
+    pub async fn quotes_to_sink<S: Sink>(
+        &self,
+        codes: &[String],
+        sink: &mut S,
+    ) -> Result<usize, ClientError> {
+        let codes = codes
+            .iter()
+            .map(|c| qualify_code(c))
+            .collect::<Result<Vec<_>, _>>()?;
+        let mut written = 0;
+        for chunk in codes.chunks(80) {
+            let quotes = self.get_quote(chunk).await?;
+            if !quotes.is_empty() {
+                sink.write_quotes(&quotes)
+                    .await
+                    .map_err(ClientError::Sink)?;
+                written += quotes.len();
+            }
+        }
+        Ok(written)
+    }
+}
@@ -0,0 +1,353 @@
+//! 基于轮询的K线订阅，以及按批次推送的行情流
+
+use crate::client::{Client, ClientError};
+use crate::protocol::*;
+use log::debug;
+use std::collections::HashSet;
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::sync::mpsc;
+use tokio::task::JoinHandle;
+
+/// K线更新事件
+#[derive(Debug, Clone)]
+pub struct KlineUpdate {
+    pub kline: Kline,  // 最新的K线
+    pub partial: bool, // 是否为尚未收盘的K线，false 表示该K线已收盘
+}
+
+/// K线订阅事件
+#[derive(Debug, Clone)]
+pub enum KlineEvent {
+    Update(KlineUpdate),       // K线更新
+    Paused { resume_at: i64 }, // 非交易时段暂停轮询，resume_at 为预计恢复时间（Unix时间戳，秒）
+    Resumed,                   // 进入交易时段，恢复轮询
+}
+
+/// K线订阅配置
+#[derive(Debug, Clone)]
+pub struct SubscribeOptions {
+    /// 轮询间隔
+    pub interval: Duration,
+    /// 非交易时段（含周末和 `holidays`）暂停轮询
+    pub pause_outside_session: bool,
+    /// 午间休市时继续轮询
+    pub poll_during_lunch: bool,
+    /// 休市日（YYYYMMDD），库中没有内置节假日表
+    pub holidays: HashSet<u32>,
+}
+
+impl SubscribeOptions {
+    /// 创建配置，默认在非交易时段暂停，午间休市不轮询
+    pub fn new(interval: Duration) -> Self {
+        Self {
+            interval,
+            pause_outside_session: true,
+            poll_during_lunch: false,
+            holidays: HashSet::new(),
+        }
+    }
+
+    /// 设置是否在非交易时段暂停
+    pub fn with_pause_outside_session(mut self, pause: bool) -> Self {
+        self.pause_outside_session = pause;
+        self
+    }
+
+    /// 设置午间休市是否继续轮询
+    pub fn with_poll_during_lunch(mut self, poll: bool) -> Self {
+        self.poll_during_lunch = poll;
+        self
+    }
+
+    /// 设置休市日（YYYYMMDD）
+    pub fn with_holidays(mut self, holidays: HashSet<u32>) -> Self {
+        self.holidays = holidays;
+        self
+    }
+}
+
+/// K线订阅句柄，调用 [`KlineSubscription::stop`] 或丢弃句柄即停止轮询
+pub struct KlineSubscription {
+    handle: JoinHandle<()>,
+}
+
+impl KlineSubscription {
+    /// 停止订阅
+    pub fn stop(&self) {
+        self.handle.abort();
+    }
+}
+
+impl Drop for KlineSubscription {
+    fn drop(&mut self) {
+        self.handle.abort();
+    }
+}
+
+/// 判断K线数据是否有变化
+fn kline_changed(a: &Kline, b: &Kline) -> bool {
+    a.open != b.open
+        || a.high != b.high
+        || a.low != b.low
+        || a.close != b.close
+        || a.volume != b.volume
+        || a.amount != b.amount
+}
+
+/// 比较最近一次推送的K线与新获取的K线，返回需要推送的事件
+///
+/// 首次轮询只推送最新一根；之后推送新出现的K线、盘中有变化的K线，
+/// 以及由未收盘变为已收盘的K线。`is_partial` 判断K线是否未收盘，
+/// 订阅中使用 [`Client::is_partial`]，与其他K线方法共用休市日配置
+fn poll_updates(
+    last: &mut Option<KlineUpdate>,
+    list: &[Kline],
+    is_partial: impl Fn(&Kline) -> bool,
+) -> Vec<KlineUpdate> {
+    let mut updates = Vec::new();
+    let start = if last.is_none() {
+        list.len().saturating_sub(1)
+    } else {
+        0
+    };
+
+    for k in &list[start..] {
+        let update = KlineUpdate {
+            kline: k.clone(),
+            partial: is_partial(k),
+        };
+        let emit = match last {
+            None => true,
+            Some(prev) if k.time < prev.kline.time => false,
+            Some(prev) if k.time == prev.kline.time => {
+                prev.partial != update.partial || kline_changed(&prev.kline, k)
+            }
+            Some(_) => true,
+        };
+        if emit {
+            *last = Some(update.clone());
+            updates.push(update);
+        }
+    }
+
+    updates
+}
+
+impl Client {
+    /// 订阅K线更新
+    ///
+    /// 每隔 `interval` 请求最新两根K线，新K线出现、当前K线变化或K线收盘时推送事件。
+    /// 请求失败时推送错误并继续轮询；接收端关闭或句柄被丢弃时停止。
+    /// 不区分交易时段，需要在休市时暂停请使用 [`Client::subscribe_kline_with`]
+    pub fn subscribe_kline(
+        self: Arc<Self>,
+        kline_type: KlineType,
+        code: &str,
+        interval: Duration,
+    ) -> (
+        mpsc::Receiver<Result<KlineUpdate, ClientError>>,
+        KlineSubscription,
+    ) {
+        let options = SubscribeOptions::new(interval).with_pause_outside_session(false);
+        self.spawn_kline_poller(kline_type, code, options, |event| match event {
+            KlineEvent::Update(update) => Some(update),
+            _ => None,
+        })
+    }
+
+    /// 按配置订阅K线更新
+    ///
+    /// 开启 `pause_outside_session` 时，非交易时段停止请求并推送 [`KlineEvent::Paused`]，
+    /// 到下一个交易时段自动恢复并推送 [`KlineEvent::Resumed`]
+    pub fn subscribe_kline_with(
+        self: Arc<Self>,
+        kline_type: KlineType,
+        code: &str,
+        options: SubscribeOptions,
+    ) -> (
+        mpsc::Receiver<Result<KlineEvent, ClientError>>,
+        KlineSubscription,
+    ) {
+        self.spawn_kline_poller(kline_type, code, options, Some)
+    }
+
+    fn spawn_kline_poller<T: Send + 'static>(
+        self: Arc<Self>,
+        kline_type: KlineType,
+        code: &str,
+        options: SubscribeOptions,
+        map: fn(KlineEvent) -> Option<T>,
+    ) -> (mpsc::Receiver<Result<T, ClientError>>, KlineSubscription) {
+        let (tx, rx) = mpsc::channel(16);
+        let code = code.to_string();
+
+        let handle = tokio::spawn(async move {
+            let mut last: Option<KlineUpdate> = None;
+            let mut ticker = tokio::time::interval(options.interval);
+
+            loop {
+                ticker.tick().await;
+
+                let mut events = Vec::new();
+                if options.pause_outside_session {
+                    let now = self.now();
+                    let lunch = options.poll_during_lunch;
+                    if !is_trading_time(now, lunch, &options.holidays) {
+                        let resume_at = next_trading_time(now, lunch, &options.holidays)
+                            .unwrap_or(now + 24 * 3600);
+                        debug!("非交易时段，暂停K线订阅: {} 至 {}", code, resume_at);
+                        if let Some(event) = map(KlineEvent::Paused { resume_at }) {
+                            if tx.send(Ok(event)).await.is_err() {
+                                return;
+                            }
+                        }
+                        let wait = (resume_at - now).max(1) as u64;
+                        tokio::time::sleep(Duration::from_secs(wait)).await;
+                        ticker.reset();
+                        events.push(Ok(KlineEvent::Resumed));
+                    }
+                }
+
+                let result = self.get_kline(kline_type, &code, 0, 2).await;
+                match result {
+                    Ok(resp) => {
+                        let updates = poll_updates(&mut last, &resp.list, |k| {
+                            self.is_partial(kline_type, k)
+                        });
+                        events.extend(updates.into_iter().map(|u| Ok(KlineEvent::Update(u))));
+                    }
+                    Err(e) => events.push(Err(e)),
+                }
+
+                for event in events {
+                    let event = match event {
+                        Ok(event) => match map(event) {
+                            Some(event) => Ok(event),
+                            None => continue,
+                        },
+                        Err(e) => Err(e),
+                    };
+                    if tx.send(event).await.is_err() {
+                        debug!("K线订阅接收端已关闭: {}", code);
+                        return;
+                    }
+                }
+            }
+        });
+
+        (rx, KlineSubscription { handle })
+    }
+}
+
+/// 按时段边界定时重连的事件
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ScheduledReconnect {
+    pub at: i64, // 触发重连的时段边界（Unix时间戳，秒）
+}
+
+/// 定时重连句柄，调用 [`ReconnectSchedule::stop`] 或丢弃句柄即停止
+pub struct ReconnectSchedule {
+    handle: JoinHandle<()>,
+}
+
+impl ReconnectSchedule {
+    /// 停止定时重连
+    pub fn stop(&self) {
+        self.handle.abort();
+    }
+}
+
+impl Drop for ReconnectSchedule {
+    fn drop(&mut self) {
+        self.handle.abort();
+    }
+}
+
+impl Client {
+    /// 在每个交易日的时段边界主动重连，使每个交易时段都从新的连接开始
+    ///
+    /// 开盘、收盘前后部分服务器会短暂返回不一致的帧，长时间保持的连接容易因此错位。
+    /// `boundaries` 为北京时间当天的分钟数，默认可用 [`SESSION_BOUNDARIES`]，跳过周末和 `holidays`。
+    /// 重连需要取得连接锁，会等正在进行的请求完成后再断开。每次重连后推送事件，
+    /// 失败时推送错误并等待下一个边界；接收端关闭或句柄被丢弃时停止
+    pub fn schedule_session_reconnect(
+        self: Arc<Self>,
+        boundaries: &[u32],
+        holidays: HashSet<u32>,
+    ) -> (
+        mpsc::Receiver<Result<ScheduledReconnect, ClientError>>,
+        ReconnectSchedule,
+    ) {
+        let (tx, rx) = mpsc::channel(4);
+        let boundaries = boundaries.to_vec();
+
+        let handle = tokio::spawn(async move {
+            let mut last = i64::MIN;
+            loop {
+                let now = self.now();
+                let at = match next_session_boundary(now.max(last), &boundaries, &holidays) {
+                    Some(at) => at,
+                    None => return,
+                };
+                debug!("下次定时重连: {}", at);
+                tokio::time::sleep(Duration::from_secs((at - now).max(0) as u64)).await;
+                last = at;
+
+                let event = self.reconnect().await.map(|()| ScheduledReconnect { at });
+                if tx.send(event).await.is_err() {
+                    debug!("定时重连接收端已关闭");
+                    return;
+                }
+            }
+        });
+
+        (rx, ReconnectSchedule { handle })
+    }
+}
+
+/// 行情流每批请求的代码数量
+const QUOTE_STREAM_BATCH: usize = 80;
+
+impl Client {
+    /// 以通道逐条推送行情，适合全市场扫描
+    ///
+    /// 每80只股票一次请求，每批解码后立即推送，下游无需等待全部请求完成。
+    /// 通道容量为一批，接收端处理不及时时暂停请求，内存占用不随代码数量增长。
+    /// 出错时推送错误并结束；全部推送完或接收端关闭时通道关闭
+    pub fn stream_quotes(
+        self: Arc<Self>,
+        codes: &[String],
+    ) -> mpsc::Receiver<Result<QuoteInfo, ClientError>> {
+        let (tx, rx) = mpsc::channel(QUOTE_STREAM_BATCH);
+        let codes: Result<Vec<String>, MessageError> =
+            codes.iter().map(|c| qualify_code(c)).collect();
+
+        tokio::spawn(async move {
+            let codes = match codes {
+                Ok(codes) => codes,
+                Err(e) => {
+                    let _ = tx.send(Err(e.into())).await;
+                    return;
+                }
+            };
+            for chunk in codes.chunks(QUOTE_STREAM_BATCH) {
+                let quotes = match self.get_quote(chunk).await {
+                    Ok(quotes) => quotes,
+                    Err(e) => {
+                        let _ = tx.send(Err(e)).await;
+                        return;
+                    }
+                };
+                for quote in quotes {
+                    if tx.send(Ok(quote)).await.is_err() {
+                        debug!("行情流接收端已关闭");
+                        return;
+                    }
+                }
+            }
+        });
+
+        rx
+    }
+}
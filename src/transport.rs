@@ -0,0 +1,55 @@
+//! 客户端连接的传输层抽象
+
+use socket2::{SockRef, TcpKeepalive};
+use std::fmt;
+use std::future::Future;
+use std::io;
+use std::pin::Pin;
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::io::{AsyncRead, AsyncWrite};
+use tokio::net::TcpStream;
+
+/// 客户端读写使用的字节流
+///
+/// 任何实现了异步读写的类型都可以作为传输层，如 TCP 连接、
+/// `tokio::io::duplex` 创建的内存管道（测试时可在其上注入读写错误）
+pub trait Transport: AsyncRead + AsyncWrite + Unpin + Send + Sync {}
+
+impl<T: AsyncRead + AsyncWrite + Unpin + Send + Sync> Transport for T {}
+
+/// 建立连接返回的 Future
+pub type ConnectFuture = Pin<Box<dyn Future<Output = io::Result<Box<dyn Transport>>> + Send>>;
+
+/// 连接函数，参数为服务器地址（含端口），建立连接和重连时调用
+#[derive(Clone)]
+pub struct Connector(pub Arc<dyn Fn(&str) -> ConnectFuture + Send + Sync>);
+
+impl fmt::Debug for Connector {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Connector")
+    }
+}
+
+/// 建立 TCP 连接（默认的连接方式）
+///
+/// `keepalive` 不为 None 时开启系统层面的 TCP 保活，空闲该时长后开始探测，探测间隔相同
+pub async fn connect_tcp(
+    addr: &str,
+    keepalive: Option<Duration>,
+) -> io::Result<Box<dyn Transport>> {
+    let stream = TcpStream::connect(addr).await?;
+    stream.set_nodelay(true)?;
+    if let Some(interval) = keepalive {
+        set_tcp_keepalive(&stream, interval)?;
+    }
+    Ok(Box::new(stream))
+}
+
+/// 开启 TCP 保活，用于在没有心跳的空闲期发现半开连接（如网络分区后对端已不可达）
+pub fn set_tcp_keepalive(stream: &TcpStream, interval: Duration) -> io::Result<()> {
+    let keepalive = TcpKeepalive::new()
+        .with_time(interval)
+        .with_interval(interval);
+    SockRef::from(stream).set_tcp_keepalive(&keepalive)
+}
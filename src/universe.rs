@@ -0,0 +1,112 @@
+//! 全市场证券列表导出
+
+use crate::client::{Client, ClientError};
+use crate::protocol::*;
+use log::debug;
+use std::time::Duration;
+
+/// 证券类型
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SecurityKind {
+    Stock, // 股票
+    Etf,   // 场内基金（ETF/LOF）
+    Index, // 指数
+}
+
+/// 证券基础信息
+#[derive(Debug, Clone)]
+pub struct SecurityRecord {
+    pub exchange: Exchange,    // 交易所
+    pub code: String,          // 带交易所前缀的代码，如 sh600000
+    pub name: String,          // 名称
+    pub kind: SecurityKind,    // 类型
+    pub multiple: u16,         // 倍数
+    pub decimal: i8,           // 小数位
+    pub last_price: f64,       // 昨收价格（单位元，仅对指数有效）
+    pub ipo_time: Option<i64>, // 上市日期（Unix 时间戳，秒），仅股票查询
+}
+
+/// 按代码段判断证券类型，非股票/基金/指数（如债券、回购）返回 None
+fn security_kind(code: &str) -> Option<SecurityKind> {
+    if is_stock(code) {
+        Some(SecurityKind::Stock)
+    } else if is_etf(code) {
+        Some(SecurityKind::Etf)
+    } else if is_index(code) {
+        Some(SecurityKind::Index)
+    } else {
+        None
+    }
+}
+
+impl Client {
+    /// 导出全市场证券列表
+    ///
+    /// 结果包含股票、场内基金和指数，股票会额外查询财务信息以获取上市日期。
+    /// 数据量较大时建议使用 [`Client::export_universe_each`]
+    pub async fn export_universe(
+        &self,
+        finance_interval: Duration,
+    ) -> Result<Vec<SecurityRecord>, ClientError> {
+        let mut records = Vec::new();
+        self.export_universe_each(finance_interval, |r| records.push(r))
+            .await?;
+        Ok(records)
+    }
+
+    /// 逐条导出全市场证券列表
+    ///
+    /// 每查询一次财务信息后等待 `finance_interval`，避免请求过密被服务器断开。
+    /// 服务器不支持北京交易所（断开连接）时重连并跳过该市场，重连失败时返回错误
+    pub async fn export_universe_each<F>(
+        &self,
+        finance_interval: Duration,
+        mut on_record: F,
+    ) -> Result<(), ClientError>
+    where
+        F: FnMut(SecurityRecord),
+    {
+        for exchange in [Exchange::SZ, Exchange::SH, Exchange::BJ] {
+            let codes = match self.get_code_all(exchange).await {
+                Ok(resp) => resp.codes,
+                Err(e) if exchange == Exchange::BJ && e.is_connection() => {
+                    // 服务器以断开连接拒绝北京交易所的请求，重连后才能继续使用
+                    debug!("跳过北京交易所: {}", e);
+                    self.reconnect().await?;
+                    continue;
+                }
+                Err(e) => return Err(e),
+            };
+
+            for c in codes {
+                let code = format!("{}{}", exchange.as_str(), c.code);
+                let kind = match security_kind(&code) {
+                    Some(kind) => kind,
+                    None => continue,
+                };
+
+                let ipo_time = if kind == SecurityKind::Stock {
+                    let ipo_time = self.get_ipo_time(&code).await?;
+                    if !finance_interval.is_zero() {
+                        tokio::time::sleep(finance_interval).await;
+                    }
+                    ipo_time
+                } else {
+                    None
+                };
+
+                on_record(SecurityRecord {
+                    exchange,
+                    code,
+                    name: c.name,
+                    kind,
+                    multiple: c.multiple,
+                    decimal: c.decimal,
+                    last_price: c.last_price,
+                    ipo_time,
+                });
+            }
+        }
+        Ok(())
+    }
+}
@@ -0,0 +1,1535 @@
+//! 客户端测试（不依赖真实服务器）
+
+use std::sync::{Arc, Mutex};
+use tdx_rust::*;
+
+/// 演练模式的客户端，按发送顺序记录每个请求帧经 `record` 提取的内容
+async fn recording_dry_run_client<T: Send + 'static>(
+    record: fn(&RequestFrame) -> T,
+) -> (Client, Arc<Mutex<Vec<T>>>) {
+    let sent = Arc::new(Mutex::new(Vec::new()));
+    let recorder = sent.clone();
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_request_hook(move |frame| recorder.lock().unwrap().push(record(frame)));
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    (client, sent)
+}
+
+#[tokio::test]
+async fn test_dry_run_records_requests() {
+    let (client, sent) = recording_dry_run_client(|frame| frame.msg_type).await;
+
+    assert_eq!(client.get_count(Exchange::SH).await.unwrap(), 0);
+    assert!(client
+        .get_code_all(Exchange::SZ)
+        .await
+        .unwrap()
+        .codes
+        .is_empty());
+    assert!(client
+        .get_quote(&["sz000001".to_string()])
+        .await
+        .unwrap()
+        .is_empty());
+    assert!(client
+        .get_kline_day_all("sz000001")
+        .await
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(client.get_minute("sz000001").await.unwrap().list.is_empty());
+    assert!(client
+        .get_trade_all("sz000001")
+        .await
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(client.get_gbbq("sz000001").await.unwrap().list.is_empty());
+
+    let sent = sent.lock().unwrap();
+    assert_eq!(
+        *sent,
+        vec![
+            MessageType::Count,
+            MessageType::Code,
+            MessageType::Quote,
+            MessageType::Kline,
+            MessageType::HistoryMinute,
+            MessageType::MinuteTrade,
+            MessageType::Gbbq,
+        ]
+    );
+}
+
+#[test]
+fn test_raw_capture_byte_budget() {
+    let mut capture = RawCapture::new(RawCaptureConfig {
+        max_frames: 0,
+        max_bytes: 100,
+    });
+
+    capture.push(true, &[1u8; 40]);
+    capture.push(false, &[2u8; 40]);
+    assert_eq!(capture.bytes(), 80);
+
+    // 超出字节上限时淘汰最旧的帧
+    capture.push(false, &[3u8; 40]);
+    let frames = capture.frames();
+    assert_eq!(frames.len(), 2);
+    assert_eq!(frames[0].data[0], 2);
+    assert_eq!(frames[1].data[0], 3);
+    assert_eq!(capture.bytes(), 80);
+
+    // 单帧超过字节上限时不保留
+    capture.push(true, &[4u8; 101]);
+    assert_eq!(capture.frames().len(), 2);
+
+    let mut capture = RawCapture::new(RawCaptureConfig {
+        max_frames: 1,
+        max_bytes: 100,
+    });
+    capture.push(true, &[1u8; 10]);
+    capture.push(false, &[2u8; 10]);
+    assert_eq!(capture.frames().len(), 1);
+    assert_eq!(capture.bytes(), 10);
+}
+
+#[tokio::test]
+async fn test_clone_connection_keeps_options() {
+    let sent = Arc::new(Mutex::new(0));
+    let recorder = sent.clone();
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_request_hook(move |_| *recorder.lock().unwrap() += 1);
+
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    let worker = client.clone_connection().await.unwrap();
+    assert_eq!(worker.addr(), "127.0.0.1:7709");
+
+    worker.get_count(Exchange::SH).await.unwrap();
+    client.get_count(Exchange::SZ).await.unwrap();
+    assert_eq!(*sent.lock().unwrap(), 2);
+}
+
+#[tokio::test]
+async fn test_code_progress_reports_total() {
+    let client = Client::connect_with("127.0.0.1", ClientOptions::default().with_dry_run(true))
+        .await
+        .unwrap();
+
+    let mut reports = Vec::new();
+    client
+        .get_code_all_with_progress(Exchange::SH, |p| reports.push(p))
+        .await
+        .unwrap();
+    assert_eq!(
+        reports,
+        vec![Progress {
+            fetched: 0,
+            total: Some(0)
+        }]
+    );
+}
+
+#[tokio::test]
+async fn test_oversized_frame_discarded() {
+    // 握手响应72字节、代码数量响应2字节，10根K线的响应超过上限
+    let handler: Handler = Box::new(|msg_type, _| match msg_type {
+        t if t == MessageType::Count.as_u16() => Some((0x1C, 1234u16.to_le_bytes().to_vec())),
+        t if t == MessageType::Kline.as_u16() => Some((0x1C, kline_data(20240102..20240112))),
+        _ => None,
+    });
+    let options = ClientOptions::default().with_max_frame_size(100);
+    let client = mock_client(options, handler).await;
+
+    assert!(matches!(
+        client.get_kline_day("sz000001", 0, 10).await,
+        Err(ClientError::Protocol(FrameError::FrameTooLarge {
+            max: 100,
+            ..
+        }))
+    ));
+    // 超长的帧已被丢弃，后续请求不受影响
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+}
+
+#[tokio::test]
+async fn test_trade_progress_without_total() {
+    let client = Client::connect_with("127.0.0.1", ClientOptions::default().with_dry_run(true))
+        .await
+        .unwrap();
+
+    let mut reports = Vec::new();
+    client
+        .get_trade_all_with_progress("sz000001", |p| reports.push(p))
+        .await
+        .unwrap();
+    assert_eq!(
+        reports,
+        vec![Progress {
+            fetched: 0,
+            total: None
+        }]
+    );
+}
+
+#[tokio::test]
+async fn test_handshake_retry_on_fresh_socket() {
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+    let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap().to_string();
+
+    tokio::spawn(async move {
+        let mut buf = [0u8; 1024];
+        // 第一次连接读取握手请求后直接关闭
+        let (mut socket, _) = listener.accept().await.unwrap();
+        let _ = socket.read(&mut buf).await;
+        drop(socket);
+
+        // 第二次连接正常应答
+        let (mut socket, _) = listener.accept().await.unwrap();
+        let _ = socket.read(&mut buf).await;
+        let resp = response_frame(0x1C, &[1, 0, 0, 0], MessageType::Connect.as_u16(), &[0; 68]);
+        socket.write_all(&resp).await.unwrap();
+        let _ = socket.read(&mut buf).await;
+    });
+
+    let options = ClientOptions::default().with_handshake_retries(1);
+    let client = Client::connect_with(&addr, options).await.unwrap();
+    assert!(client.server_info().is_some());
+}
+
+#[tokio::test]
+async fn test_pipeline_typed_results() {
+    let (client, sent) = recording_dry_run_client(|frame| frame.msg_id).await;
+
+    let mut p = client.pipeline();
+    let count = p.count(Exchange::SZ);
+    let quotes = p.quote(&["sz000001".to_string()]).unwrap();
+    let klines = p.kline(KlineType::Day, "sz000001", 0, 10).unwrap();
+    assert_eq!(p.len(), 3);
+
+    let mut results = p.execute().await.unwrap();
+    assert_eq!(results.take(count).unwrap(), 0);
+    assert!(results.take(quotes).unwrap().is_empty());
+    assert!(results.take(klines).unwrap().list.is_empty());
+
+    // 每个请求分配了递增的消息ID
+    let ids = sent.lock().unwrap().clone();
+    assert_eq!(ids.len(), 3);
+    assert!(ids.windows(2).all(|w| w[1] == w[0] + 1));
+}
+
+#[tokio::test]
+async fn test_health_check_reports_empty_count() {
+    let options = ClientOptions::default().with_dry_run(true);
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+
+    // 演练模式下心跳成功，但代码数量为0，视为不健康
+    let report = client.health_check().await;
+    assert!(report.alive);
+    assert!(report.rtt.is_some());
+    assert_eq!(report.count, None);
+    assert!(report.error.is_some());
+    assert!(!report.is_healthy());
+}
+
+#[test]
+fn test_error_kind_classification() {
+    use std::io;
+
+    let io_err = || io::Error::from(io::ErrorKind::ConnectionReset);
+    let cases = vec![
+        (ClientError::Io(io_err()), ErrorKind::Connection),
+        (ClientError::Timeout, ErrorKind::Connection),
+        (ClientError::Disconnected, ErrorKind::Connection),
+        (ClientError::SessionExpired, ErrorKind::Connection),
+        (
+            ClientError::Protocol(FrameError::Io(io_err())),
+            ErrorKind::Connection,
+        ),
+        (ClientError::ServerError(0x0C), ErrorKind::Protocol),
+        (
+            ClientError::MsgIdMismatch {
+                expected: 1,
+                actual: 2,
+            },
+            ErrorKind::Protocol,
+        ),
+        (
+            ClientError::Protocol(FrameError::InvalidPrefix),
+            ErrorKind::Protocol,
+        ),
+        (
+            ClientError::Protocol(FrameError::UnknownMessageType(0xFFFF)),
+            ErrorKind::Protocol,
+        ),
+        (
+            ClientError::Protocol(FrameError::FrameTooLarge { size: 2, max: 1 }),
+            ErrorKind::Protocol,
+        ),
+        (
+            ClientError::Message(MessageError::VersionMismatch {
+                required: None,
+                message: String::new(),
+            }),
+            ErrorKind::Protocol,
+        ),
+        (
+            ClientError::Protocol(FrameError::InsufficientData),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Protocol(FrameError::LengthMismatch),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Protocol(FrameError::DecompressionError(String::new())),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Message(MessageError::InsufficientData),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Message(MessageError::ParseError(String::new())),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Message(MessageError::CountMismatch {
+                declared: 2,
+                decoded: 1,
+            }),
+            ErrorKind::Decode,
+        ),
+        (
+            ClientError::Message(MessageError::InvalidCode(String::new())),
+            ErrorKind::Other,
+        ),
+        (
+            ClientError::Message(MessageError::AmbiguousCode(String::new())),
+            ErrorKind::Other,
+        ),
+        (
+            ClientError::UnsupportedMarket(String::new()),
+            ErrorKind::Other,
+        ),
+        (ClientError::Cache(io_err()), ErrorKind::Other),
+        (ClientError::Sink("full".into()), ErrorKind::Other),
+        (ClientError::Other(String::new()), ErrorKind::Other),
+    ];
+    for (err, kind) in cases {
+        assert_eq!(err.kind(), kind, "{:?}", err);
+        assert_eq!(err.is_connection(), kind == ErrorKind::Connection);
+        assert_eq!(err.is_protocol(), kind == ErrorKind::Protocol);
+        assert_eq!(err.is_decode(), kind == ErrorKind::Decode);
+    }
+}
+
+#[test]
+fn test_reconnect_backoff_growth() {
+    use std::time::Duration;
+
+    let backoff = ReconnectBackoff {
+        base: Duration::from_millis(100),
+        max: Duration::from_secs(1),
+        jitter: 0.0,
+        max_attempts: 0,
+    };
+    assert_eq!(backoff.delay(0), Duration::from_millis(100));
+    assert_eq!(backoff.delay(2), Duration::from_millis(400));
+    assert_eq!(backoff.delay(10), Duration::from_secs(1));
+
+    // 浮动后不超过 ±jitter 比例
+    let backoff = ReconnectBackoff {
+        jitter: 0.5,
+        ..backoff
+    };
+    for attempt in 0..5 {
+        let base = ReconnectBackoff {
+            jitter: 0.0,
+            ..backoff
+        }
+        .delay(attempt);
+        let delay = backoff.delay(attempt);
+        assert!(delay >= base.mul_f64(0.5) && delay <= base.mul_f64(1.5));
+    }
+}
+
+#[tokio::test]
+async fn test_metrics_json_keys() {
+    use std::time::Duration;
+
+    let metrics = Metrics::default();
+    metrics.record_request(0x044E, Duration::from_millis(30));
+    metrics.record_request(0x044E, Duration::from_secs(10));
+    metrics.record_error();
+    metrics.record_sent(12);
+    metrics.record_received(16);
+
+    let json = metrics.snapshot().to_json("tdx");
+    assert_eq!(json["tdx.requests.0x044E"], 2);
+    assert_eq!(json["tdx.errors"], 1);
+    assert_eq!(json["tdx.bytes_sent"], 12);
+    assert_eq!(json["tdx.bytes_received"], 16);
+    assert_eq!(json["tdx.rtt_ms.le_50"], 1);
+    assert_eq!(json["tdx.rtt_ms.inf"], 1);
+
+    // 未开启时不统计
+    let options = ClientOptions::default().with_dry_run(true);
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    assert!(client.metrics_json().is_none());
+
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_metrics("tdx");
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    assert_eq!(client.metrics_json().unwrap()["tdx.reconnects"], 0);
+}
+
+#[tokio::test]
+async fn test_refresh_universe_if_changed() {
+    let (client, sent) = recording_dry_run_client(|frame| frame.msg_type).await;
+    assert!(client.cached_code_list(Exchange::SZ).await.is_none());
+
+    // 首次调用下载全部市场
+    assert!(client.refresh_universe_if_changed().await.unwrap());
+    assert!(client
+        .cached_code_list(Exchange::SZ)
+        .await
+        .unwrap()
+        .is_empty());
+
+    // 数量未变化时只查询数量
+    sent.lock().unwrap().clear();
+    assert!(!client.refresh_universe_if_changed().await.unwrap());
+    assert!(sent
+        .lock()
+        .unwrap()
+        .iter()
+        .all(|t| *t == MessageType::Count));
+}
+
+#[tokio::test]
+async fn test_stream_quotes_batches() {
+    let sent = Arc::new(Mutex::new(0));
+    let recorder = sent.clone();
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_request_hook(move |_| *recorder.lock().unwrap() += 1);
+    let client = Arc::new(Client::connect_with("127.0.0.1", options).await.unwrap());
+
+    let codes: Vec<String> = (0..200).map(|i| format!("sz{:06}", i)).collect();
+    let mut rx = client.stream_quotes(&codes);
+    // 演练模式下没有行情，全部批次请求完后通道关闭
+    assert!(rx.recv().await.is_none());
+    assert_eq!(*sent.lock().unwrap(), 3);
+}
+
+#[tokio::test]
+async fn test_new_listings_dry_run() {
+    let (client, sent) = recording_dry_run_client(|frame| frame.msg_type).await;
+
+    let known: std::collections::HashSet<String> =
+        ["sz000001".to_string(), "SH600000".to_string()].into();
+    let listings = client
+        .new_listings(&[Exchange::SZ, Exchange::SH], &known)
+        .await
+        .unwrap();
+    assert!(listings.is_empty());
+
+    // 不带前缀的代码无法确定市场
+    let bare: std::collections::HashSet<String> = ["600000".to_string()].into();
+    assert!(matches!(
+        client.new_listings(&[Exchange::SH], &bare).await,
+        Err(ClientError::Message(MessageError::AmbiguousCode(_)))
+    ));
+    assert_eq!(
+        *sent.lock().unwrap(),
+        vec![MessageType::Code, MessageType::Code]
+    );
+}
+
+/// 构造响应帧（数据域不压缩）
+fn response_frame(control: u8, msg_id: &[u8], msg_type: u16, data: &[u8]) -> Vec<u8> {
+    let mut resp = vec![0xB1, 0xCB, 0x74, 0x00, control];
+    resp.extend_from_slice(msg_id);
+    resp.push(0);
+    resp.extend_from_slice(&msg_type.to_le_bytes());
+    resp.extend_from_slice(&(data.len() as u16).to_le_bytes());
+    resp.extend_from_slice(&(data.len() as u16).to_le_bytes());
+    resp.extend_from_slice(data);
+    resp
+}
+
+/// 模拟服务器的请求处理函数
+///
+/// 参数为消息类型和请求数据域，返回 (control, 响应数据域)，返回 None 时断开连接。
+/// 握手请求由模拟服务器直接应答，不经过处理函数
+type Handler = Box<dyn FnMut(u16, &[u8]) -> Option<(u8, Vec<u8>)> + Send>;
+
+/// 模拟服务器在应答前主动推送的帧，参数为请求的消息ID和消息类型
+type Push = Box<dyn FnMut(&[u8], u16) -> Vec<u8> + Send>;
+
+/// 在内存管道上运行模拟服务器
+async fn serve(stream: tokio::io::DuplexStream, handler: Handler) {
+    serve_with_push(stream, handler, Box::new(|_, _| Vec::new())).await
+}
+
+/// 在内存管道上运行模拟服务器，每个非握手请求的应答前先写入 `push` 返回的帧
+async fn serve_with_push(
+    mut stream: tokio::io::DuplexStream,
+    mut handler: Handler,
+    mut push: Push,
+) {
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+    loop {
+        let mut header = [0u8; 10];
+        if stream.read_exact(&mut header).await.is_err() {
+            return;
+        }
+        let mut body = vec![0u8; u16::from_le_bytes([header[6], header[7]]) as usize];
+        if stream.read_exact(&mut body).await.is_err() {
+            return;
+        }
+        let msg_type = u16::from_le_bytes([body[0], body[1]]);
+        let (control, data) = if msg_type == MessageType::Connect.as_u16() {
+            let mut data = vec![0u8; 68];
+            data.extend_from_slice(b"mock");
+            (0x1C, data)
+        } else {
+            match handler(msg_type, &body[2..]) {
+                Some(resp) => resp,
+                None => return,
+            }
+        };
+        let mut resp = Vec::new();
+        if msg_type != MessageType::Connect.as_u16() {
+            resp.extend(push(&header[1..5], msg_type));
+        }
+        resp.extend(response_frame(control, &header[1..5], msg_type, &data));
+        if stream.write_all(&resp).await.is_err() {
+            return;
+        }
+    }
+}
+
+/// 启动模拟服务器，返回客户端一端
+fn spawn_server(handler: Handler) -> tokio::io::DuplexStream {
+    let (client_end, server_end) = tokio::io::duplex(64 * 1024);
+    tokio::spawn(serve(server_end, handler));
+    client_end
+}
+
+/// 每次连接依次使用 `streams` 中的下一个，用完后拒绝连接；返回的列表记录每次连接的地址
+fn mock_connector<T: Transport + 'static>(
+    options: ClientOptions,
+    streams: Vec<T>,
+) -> (ClientOptions, Arc<Mutex<Vec<String>>>) {
+    let streams = Mutex::new(std::collections::VecDeque::from(streams));
+    let addrs = Arc::new(Mutex::new(Vec::new()));
+    let recorder = addrs.clone();
+    let options = options.with_connector(move |addr| {
+        recorder.lock().unwrap().push(addr.to_string());
+        let stream = streams.lock().unwrap().pop_front();
+        Box::pin(async move {
+            stream
+                .map(|s| Box::new(s) as Box<dyn Transport>)
+                .ok_or_else(|| std::io::ErrorKind::ConnectionRefused.into())
+        })
+    });
+    (options, addrs)
+}
+
+/// 连接到单个模拟服务器的客户端
+async fn mock_client(options: ClientOptions, handler: Handler) -> Client {
+    let (options, _) = mock_connector(options, vec![spawn_server(handler)]);
+    Client::connect_with("mock", options).await.unwrap()
+}
+
+/// 编码日K线响应的数据域，每根K线的价格差值相同
+fn kline_data(dates: impl ExactSizeIterator<Item = u32>) -> Vec<u8> {
+    let mut data = (dates.len() as u16).to_le_bytes().to_vec();
+    for date in dates {
+        data.extend_from_slice(&date.to_le_bytes());
+        for diff in [10000, 100, 200, -100] {
+            data.extend_from_slice(&encode_varint(diff));
+        }
+        data.extend_from_slice(&[0u8; 8]);
+    }
+    data
+}
+
+/// 应答心跳、代码数量（固定1234）和K线请求（两根日K线）
+fn count_kline_handler() -> Handler {
+    Box::new(|msg_type, _| match msg_type {
+        t if t == MessageType::Heart.as_u16() => Some((0x1C, Vec::new())),
+        t if t == MessageType::Count.as_u16() => Some((0x1C, 1234u16.to_le_bytes().to_vec())),
+        t if t == MessageType::Kline.as_u16() => {
+            Some((0x1C, kline_data([20240102, 20240103].into_iter())))
+        }
+        _ => None,
+    })
+}
+
+/// 握手后断开连接
+fn hang_up_handler() -> Handler {
+    Box::new(|_, _| None)
+}
+
+#[tokio::test]
+async fn test_reconnect_over_memory_transport() {
+    // 第一个连接握手后断开，第二个连接正常应答
+    let options = ClientOptions::default().with_reconnect_backoff(
+        std::time::Duration::from_millis(1),
+        std::time::Duration::from_millis(1),
+        0.0,
+    );
+    let streams = vec![
+        spawn_server(hang_up_handler()),
+        spawn_server(count_kline_handler()),
+    ];
+    let (options, addrs) = mock_connector(options, streams);
+
+    let client = Client::connect_with("mock", options).await.unwrap();
+    assert_eq!(client.server_info().unwrap().info, "mock");
+
+    let err = client.get_count(Exchange::SZ).await.unwrap_err();
+    assert!(err.is_connection(), "{:?}", err);
+
+    client.reconnect().await.unwrap();
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+    assert_eq!(*addrs.lock().unwrap(), vec!["mock:7709", "mock:7709"]);
+}
+
+#[tokio::test]
+async fn test_short_handshake_response() {
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+    // 握手响应只有4字节，之后按模拟服务器正常应答
+    let (client_end, mut server_end) = tokio::io::duplex(64 * 1024);
+    tokio::spawn(async move {
+        let mut header = [0u8; 10];
+        server_end.read_exact(&mut header).await.unwrap();
+        let mut body = vec![0u8; u16::from_le_bytes([header[6], header[7]]) as usize];
+        server_end.read_exact(&mut body).await.unwrap();
+        let resp = response_frame(
+            0x1C,
+            &header[1..5],
+            MessageType::Connect.as_u16(),
+            &[1, 2, 3, 4],
+        );
+        server_end.write_all(&resp).await.unwrap();
+        serve(server_end, count_kline_handler()).await;
+    });
+    let (options, _) = mock_connector(ClientOptions::default(), vec![client_end]);
+
+    let client = Client::connect_with("mock", options).await.unwrap();
+    let info = client.server_info().unwrap();
+    assert_eq!(info.header, vec![1, 2, 3, 4]);
+    assert!(info.info.is_empty());
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+}
+
+/// 上海返回一个指数，深圳为空，北京交易所的请求直接断开连接
+fn universe_handler() -> Handler {
+    Box::new(|msg_type, data| match msg_type {
+        t if t == MessageType::Count.as_u16() => Some((0x1C, 1234u16.to_le_bytes().to_vec())),
+        t if t == MessageType::Code.as_u16() => match data[0] {
+            0 => Some((0x1C, vec![0, 0])),
+            1 => {
+                let mut record = b"000001".to_vec();
+                record.extend_from_slice(&100u16.to_le_bytes());
+                record.extend_from_slice(b"SZZS\0\0\0\0");
+                record.resize(29, 0);
+                let mut resp = 1u16.to_le_bytes().to_vec();
+                resp.extend(record);
+                Some((0x1C, resp))
+            }
+            _ => None,
+        },
+        _ => None,
+    })
+}
+
+#[tokio::test]
+async fn test_export_universe_reconnects_after_bj() {
+    let options = ClientOptions::default().with_reconnect_backoff(
+        std::time::Duration::from_millis(1),
+        std::time::Duration::from_millis(1),
+        0.0,
+    );
+    let streams = vec![
+        spawn_server(universe_handler()),
+        spawn_server(universe_handler()),
+    ];
+    let (options, addrs) = mock_connector(options, streams);
+    let client = Client::connect_with("mock", options).await.unwrap();
+
+    // 跳过北京交易所后重连，连接仍可使用
+    let records = client
+        .export_universe(std::time::Duration::ZERO)
+        .await
+        .unwrap();
+    assert_eq!(records.len(), 1);
+    assert_eq!(records[0].code, "sh000001");
+    assert_eq!(records[0].kind, SecurityKind::Index);
+    assert_eq!(addrs.lock().unwrap().len(), 2);
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+
+    // 无法重连时返回错误
+    let err = client
+        .export_universe(std::time::Duration::ZERO)
+        .await
+        .unwrap_err();
+    assert!(err.is_connection(), "{:?}", err);
+}
+
+#[tokio::test]
+async fn test_subscribe_kline_updates() {
+    // 每次轮询依次返回以下K线，标记的K线成交量有变化，用完后重复最后一次。
+    // 价格按前一根K线差分编码，各次轮询保留同一根首K线以免价格变化
+    let polls = vec![
+        vec![(20240102, false), (20240103, false)],
+        vec![(20240102, false), (20240103, false)],
+        vec![(20240102, false), (20240103, true)],
+        vec![(20240102, false), (20240103, true), (20240104, false)],
+    ];
+    let mut poll = 0;
+    let handler: Handler = Box::new(move |msg_type, _| {
+        if msg_type != MessageType::Kline.as_u16() {
+            return None;
+        }
+        let bars = &polls[poll.min(polls.len() - 1)];
+        poll += 1;
+        let mut data = kline_data(bars.iter().map(|&(date, _)| date));
+        let bar_len = (data.len() - 2) / bars.len();
+        for (i, &(_, changed)) in bars.iter().enumerate() {
+            if changed {
+                let offset = 2 + (i + 1) * bar_len - 8;
+                data[offset..offset + 4].copy_from_slice(&[0, 0, 0x40, 79]);
+            }
+        }
+        Some((0x1C, data))
+    });
+    let client = Arc::new(mock_client(ClientOptions::default(), handler).await);
+    let (mut rx, _subscription) = client.subscribe_kline(
+        KlineType::Day,
+        "sz000001",
+        std::time::Duration::from_millis(5),
+    );
+
+    // 首次只推送最新一根，未变化时不推送，之后推送变化的K线和新K线
+    let first = rx.recv().await.unwrap().unwrap().kline;
+    let updated = rx.recv().await.unwrap().unwrap().kline;
+    let new = rx.recv().await.unwrap().unwrap().kline;
+    assert_eq!(updated.time, first.time);
+    assert_ne!(updated.volume, first.volume);
+    assert!(new.time > updated.time);
+
+    tokio::time::sleep(std::time::Duration::from_millis(30)).await;
+    assert!(rx.try_recv().is_err());
+}
+
+#[tokio::test]
+async fn test_failed_reconnect_keeps_connection() {
+    let options = ClientOptions::default().with_reconnect_backoff(
+        std::time::Duration::from_millis(1),
+        std::time::Duration::from_millis(1),
+        0.0,
+    );
+    let streams = vec![
+        spawn_server(count_kline_handler()),
+        spawn_server(count_kline_handler()),
+    ];
+    let (options, addrs) = mock_connector(options, streams);
+    let client = Client::connect_with("mock", options).await.unwrap();
+
+    // 新连接握手成功后才替换，并重新计算连接时长
+    tokio::time::sleep(std::time::Duration::from_millis(50)).await;
+    assert!(client.health_check().await.uptime >= std::time::Duration::from_millis(50));
+    client.reconnect().await.unwrap();
+    assert!(client.health_check().await.uptime < std::time::Duration::from_millis(50));
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+
+    // 没有可用的新连接时重连失败，原连接仍可使用
+    assert!(client.reconnect().await.is_err());
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+    assert!(addrs.lock().unwrap().len() > 2);
+}
+
+#[tokio::test]
+async fn test_get_detail_partial() {
+    let (client, sent) = recording_dry_run_client(|frame| frame.msg_type).await;
+
+    // 演练模式下没有行情，只有分时部分成功
+    let detail = client.get_detail("sz000001").await.unwrap();
+    assert_eq!(detail.code, "sz000001");
+    assert!(detail.quote.is_none());
+    assert!(detail.minute.is_some());
+    assert_eq!(detail.errors.len(), 1);
+    assert!(!detail.is_complete());
+    assert_eq!(
+        *sent.lock().unwrap(),
+        vec![MessageType::Quote, MessageType::Minute]
+    );
+}
+
+#[tokio::test]
+async fn test_server_time_offset_from_quote() {
+    let content = std::fs::read_to_string("tdx-test/test-data/quote.json").unwrap();
+    let test_data: TestData = serde_json::from_str(&content).unwrap();
+    let bytes = test_data.decode_response().unwrap();
+    let quote = ResponseFrame::decode(&bytes).unwrap().data().to_vec();
+    let quote_at = move |times: [i32; 2]| -> Handler {
+        // 将样本中两只股票的行情时间（13:25:17、13:25:21）替换为指定时间
+        let mut data = quote.clone();
+        for (from, to) in [13252999, 13253581].into_iter().zip(times) {
+            let (from, to) = (encode_varint(from), encode_varint(to));
+            assert_eq!(from.len(), to.len());
+            let pos = data.windows(from.len()).position(|w| w == from).unwrap();
+            data[pos..pos + to.len()].copy_from_slice(&to);
+        }
+        Box::new(move |msg_type, _| {
+            (msg_type == MessageType::Quote.as_u16()).then(|| (0x1C, data.clone()))
+        })
+    };
+    let options = || ClientOptions::default().with_time_source(TimeSource::ServerTime);
+    let codes = ["sz000001".to_string(), "sh600008".to_string()];
+    let seconds_of_day = |t: i64| (t + 8 * 3600).rem_euclid(86400);
+
+    // 交易时段内的行情时间不论与本机相差多少都采用，取最新的一只
+    let client = mock_client(options(), quote_at([13252999, 13253581])).await;
+    client.get_quote(&codes).await.unwrap();
+    let expected = 13 * 3600 + 25 * 60 + 21;
+    assert!((seconds_of_day(client.now()) - expected).abs() <= 2);
+
+    // 收盘后停留的行情时间视为过时，只采用仍在交易时段内的一只
+    let client = mock_client(options(), quote_at([13252999, 20253581])).await;
+    client.get_quote(&codes).await.unwrap();
+    let expected = 13 * 3600 + 25 * 60 + 17;
+    assert!((seconds_of_day(client.now()) - expected).abs() <= 2);
+
+    // 都已过时，仍按本机时钟
+    let client = mock_client(options(), quote_at([20252999, 20253581])).await;
+    client.get_quote(&codes).await.unwrap();
+    let local = chrono::Utc::now().timestamp();
+    assert!((client.now() - local).abs() <= 1);
+}
+
+#[tokio::test]
+async fn test_custom_time_source() {
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_time_source(TimeSource::Custom(Clock(Arc::new(|| 1_718_000_000))));
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    assert_eq!(client.now(), 1_718_000_000);
+
+    // 尚未获取到服务器时间时按本机时钟
+    let options = ClientOptions::default()
+        .with_dry_run(true)
+        .with_time_source(TimeSource::ServerTime);
+    let client = Client::connect_with("127.0.0.1", options).await.unwrap();
+    let local = chrono::Utc::now().timestamp();
+    assert!((client.now() - local).abs() <= 1);
+}
+
+/// 记录写入的K线，超过 `limit` 根时返回错误
+struct KlineSink {
+    klines: Vec<Kline>,
+    limit: usize,
+}
+
+impl Sink for KlineSink {
+    fn write_klines<'a>(
+        &'a mut self,
+        code: &'a str,
+        _kline_type: KlineType,
+        klines: &'a [Kline],
+    ) -> SinkFuture<'a> {
+        Box::pin(async move {
+            assert_eq!(code, "sz000001");
+            // 模拟异步存储的写入延迟
+            tokio::task::yield_now().await;
+            if self.klines.len() + klines.len() > self.limit {
+                return Err("存储已满".into());
+            }
+            self.klines.extend_from_slice(klines);
+            Ok(())
+        })
+    }
+}
+
+#[tokio::test]
+async fn test_kline_all_to_sink() {
+    let client = mock_client(ClientOptions::default(), count_kline_handler()).await;
+    let mut sink = KlineSink {
+        klines: Vec::new(),
+        limit: 10,
+    };
+    let written = client
+        .kline_all_to_sink(KlineType::Day, "sz000001", &mut sink)
+        .await
+        .unwrap();
+    assert_eq!(written, 2);
+    assert_eq!(sink.klines.len(), 2);
+    assert_eq!(sink.klines[0].close, Price(10100));
+
+    // 写入失败时停止并返回错误
+    let client = mock_client(ClientOptions::default(), count_kline_handler()).await;
+    let mut sink = KlineSink {
+        klines: Vec::new(),
+        limit: 1,
+    };
+    let err = client
+        .kline_all_to_sink(KlineType::Day, "sz000001", &mut sink)
+        .await
+        .unwrap_err();
+    assert!(matches!(err, ClientError::Sink(_)));
+    assert!(sink.klines.is_empty());
+}
+
+#[tokio::test]
+async fn test_kline_all_to_sink_dedups_page_boundary() {
+    // 第二页（start=800）在边界处与第一页重叠一根，只写入一次
+    let client = mock_client(
+        ClientOptions::default(),
+        paged_kline_handler(1000, true, Default::default()),
+    )
+    .await;
+    let mut sink = KlineSink {
+        klines: Vec::new(),
+        limit: usize::MAX,
+    };
+    let written = client
+        .kline_all_to_sink(KlineType::Day, "sz000001", &mut sink)
+        .await
+        .unwrap();
+    assert_eq!(written, 1000);
+    assert_eq!(sink.klines.len(), 1000);
+    let mut times: Vec<i64> = sink.klines.iter().map(|k| k.time).collect();
+    times.sort_unstable();
+    times.dedup();
+    assert_eq!(times.len(), 1000);
+}
+
+#[tokio::test]
+async fn test_partial_bar_consistent_across_methods() {
+    // 2024-01-03 10:00（北京时间），第二根日K线尚未收盘
+    let at = |now: i64| {
+        ClientOptions::default().with_time_source(TimeSource::Custom(Clock(Arc::new(move || now))))
+    };
+
+    // 财务信息返回错误响应，不截断上市日期
+    let handler = || finance_handler(None, count_kline_handler());
+    let client = mock_client(at(1_704_247_200), handler()).await;
+    let single = client.get_kline_day("sz000001", 0, 10).await.unwrap();
+    let all = client
+        .get_kline_all(KlineType::Day, "sz000001")
+        .await
+        .unwrap();
+    let ending = client
+        .get_kline_ending_at(KlineType::Day, "sz000001", i64::MAX, 10)
+        .await
+        .unwrap();
+    for resp in [single, all, ending] {
+        assert!(resp.partial);
+        assert_eq!(resp.list.len(), 2);
+        let closed = resp.with_partial(false);
+        assert!(!closed.partial);
+        assert_eq!(closed.list.len(), 1);
+        assert_eq!(closed.count, 1);
+    }
+
+    // 收盘后两根K线都已收盘，去掉未收盘K线不影响结果
+    let client = mock_client(at(1_704_265_200), handler()).await;
+    let resp = client.get_kline_day("sz000001", 0, 10).await.unwrap();
+    assert!(!resp.partial);
+    assert_eq!(resp.with_partial(false).list.len(), 2);
+}
+
+#[tokio::test]
+async fn test_raw_frame_exchange() {
+    let client = mock_client(ClientOptions::default(), count_kline_handler()).await;
+
+    let frame = Count::request(0x1234, Exchange::SZ);
+    client.send_raw_frame(&frame.encode()).await.unwrap();
+    let response = client.read_frame().await.unwrap();
+    assert_eq!(response.msg_id, 0x1234);
+    assert_eq!(response.msg_type, MessageType::Count.as_u16());
+    assert_eq!(Count::decode_response(&response.data).unwrap(), 1234);
+
+    // 常规请求不受影响
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+
+    let client = Client::connect_with("mock", ClientOptions::default().with_dry_run(true))
+        .await
+        .unwrap();
+    assert!(matches!(
+        client.send_raw_frame(&frame.encode()).await,
+        Err(ClientError::Disconnected)
+    ));
+}
+
+/// 服务器通知样本（消息ID为0，类型0x0BB8）
+fn notice_frame() -> Vec<u8> {
+    let content = std::fs::read_to_string("tdx-test/test-data/notice.json").unwrap();
+    let test_data: TestData = serde_json::from_str(&content).unwrap();
+    test_data.decode_response().unwrap()
+}
+
+/// 连接到每次应答前先推送 `push` 帧的模拟服务器
+async fn pushing_client(options: ClientOptions, handler: Handler, push: Push) -> Client {
+    let (client_end, server_end) = tokio::io::duplex(64 * 1024);
+    tokio::spawn(serve_with_push(server_end, handler, push));
+    let (options, _) = mock_connector(options, vec![client_end]);
+    Client::connect_with("mock", options).await.unwrap()
+}
+
+#[tokio::test]
+async fn test_notice_between_request_and_response() {
+    let notices = Arc::new(Mutex::new(Vec::new()));
+    let recorder = notices.clone();
+    let options = ClientOptions::default()
+        .with_notice_handler(move |notice| recorder.lock().unwrap().push(notice.clone()));
+    let client = pushing_client(
+        options,
+        count_kline_handler(),
+        Box::new(|_, _| notice_frame()),
+    )
+    .await;
+
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+    assert_eq!(client.get_count(Exchange::SH).await.unwrap(), 1234);
+    let notices = notices.lock().unwrap();
+    assert_eq!(notices.len(), 2);
+    assert_eq!(notices[0].msg_id, 0);
+    assert_eq!(notices[0].msg_type, 0x0BB8);
+    // 数据域为GBK文本“系统将于今晚22:00维护”
+    assert_eq!(notices[0].text, gbk_to_utf8(&notice_frame()[16..]));
+}
+
+#[tokio::test]
+async fn test_unknown_type_for_issued_msg_id() {
+    // 消息ID是当前请求的，但类型未知：不是通知，按协议错误返回
+    let client = pushing_client(
+        ClientOptions::default(),
+        count_kline_handler(),
+        Box::new(|msg_id, _| response_frame(0x1C, msg_id, 0x0BB8, b"x")),
+    )
+    .await;
+    assert!(matches!(
+        client.get_count(Exchange::SZ).await,
+        Err(ClientError::Protocol(FrameError::UnknownMessageType(
+            0x0BB8
+        )))
+    ));
+}
+
+#[tokio::test]
+async fn test_read_frame_returns_unknown_types() {
+    let client = pushing_client(
+        ClientOptions::default(),
+        count_kline_handler(),
+        Box::new(|_, _| notice_frame()),
+    )
+    .await;
+
+    let frame = Count::request(0x1234, Exchange::SZ);
+    client.send_raw_frame(&frame.encode()).await.unwrap();
+    // 类型不在 MessageType 中的帧原样返回，不会被当作通知吞掉
+    let notice = client.read_frame().await.unwrap();
+    assert_eq!(notice.msg_id, 0);
+    assert_eq!(notice.msg_type, 0x0BB8);
+    assert_eq!(notice.data, notice_frame()[16..].to_vec());
+    let response = client.read_frame().await.unwrap();
+    assert_eq!(response.msg_id, 0x1234);
+    assert_eq!(response.msg_type, MessageType::Count.as_u16());
+}
+
+/// 分页K线：从2020-01-01起共 `total` 根日K线，`grow` 为 true 时每次请求后新增一根，
+/// 使相邻两页在边界重叠一根；`starts` 记录每次请求的起始位置
+fn paged_kline_handler(mut total: usize, grow: bool, starts: Arc<Mutex<Vec<usize>>>) -> Handler {
+    let first_day = chrono::NaiveDate::from_ymd_opt(2020, 1, 1).unwrap();
+    Box::new(move |msg_type, req| {
+        if msg_type != MessageType::Kline.as_u16() {
+            return None;
+        }
+        let start = u16::from_le_bytes([req[12], req[13]]) as usize;
+        let count = u16::from_le_bytes([req[14], req[15]]) as usize;
+        starts.lock().unwrap().push(start);
+        let end = total.saturating_sub(start);
+        let begin = end.saturating_sub(count);
+        if grow {
+            total += 1;
+        }
+        let dates = (begin..end).map(|i| {
+            let date = first_day + chrono::Duration::days(i as i64);
+            date.format("%Y%m%d").to_string().parse::<u32>().unwrap()
+        });
+        Some((0x1C, kline_data(dates)))
+    })
+}
+
+#[tokio::test]
+async fn test_paged_klines_dedup_at_boundary() {
+    let assert_unique = |resp: &KlineResponse, len: usize| {
+        assert_eq!(resp.list.len(), len);
+        assert_eq!(resp.count as usize, len);
+        assert!(resp.list.windows(2).all(|w| w[0].time < w[1].time));
+    };
+
+    // 第二页（start=800）在边界处与第一页重叠一根
+    let client = mock_client(
+        ClientOptions::default(),
+        paged_kline_handler(1000, true, Default::default()),
+    )
+    .await;
+    let all = client
+        .get_kline_all(KlineType::Day, "sz000001")
+        .await
+        .unwrap();
+    assert_unique(&all, 1000);
+
+    // 时间范围恰好跨越页边界
+    let client = mock_client(
+        ClientOptions::default(),
+        finance_handler(None, paged_kline_handler(1000, true, Default::default())),
+    )
+    .await;
+    let start_time = all.list[199].time;
+    let range = client
+        .get_kline_all_util(KlineType::Day, "sz000001", |k| k.time >= start_time)
+        .await
+        .unwrap();
+    assert_unique(&range, 801);
+    assert_eq!(range.list[0].time, start_time);
+
+    let client = mock_client(
+        ClientOptions::default(),
+        finance_handler(None, paged_kline_handler(1000, true, Default::default())),
+    )
+    .await;
+    let ending = client
+        .get_kline_ending_at(KlineType::Day, "sz000001", i64::MAX, 801)
+        .await
+        .unwrap();
+    assert_unique(&ending, 801);
+}
+
+#[tokio::test]
+async fn test_kline_file_cache_fetches_missing_head() {
+    let dir = std::env::temp_dir().join(format!("tdx-cache-test-{}", std::process::id()));
+    let _ = std::fs::remove_dir_all(&dir);
+    let starts = Arc::new(Mutex::new(Vec::new()));
+    let client = mock_client(
+        ClientOptions::default(),
+        finance_handler(None, paged_kline_handler(2000, false, starts.clone())),
+    )
+    .await;
+    let cache = KlineFileCache::new(&client, &dir);
+    let all = client
+        .get_kline_all(KlineType::Day, "sz000001")
+        .await
+        .unwrap();
+    let time_of = |i: usize| all.list[i].time as u64;
+
+    // 首次只下载最近400根
+    starts.lock().unwrap().clear();
+    let resp = cache
+        .cached_kline(KlineType::Day, "sz000001", time_of(1600), u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(resp.list.len(), 400);
+    assert_eq!(*starts.lock().unwrap(), vec![0]);
+
+    // 起始时间更早时只补充缓存之前的部分，不重新下载已缓存的K线
+    starts.lock().unwrap().clear();
+    let resp = cache
+        .cached_kline(KlineType::Day, "sz000001", time_of(1000), u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(resp.list.len(), 1000);
+    assert_eq!(resp.count, 1000);
+    assert_eq!(resp.list[0].time as u64, time_of(1000));
+    assert!(resp.list.windows(2).all(|w| w[0].time < w[1].time));
+    assert_eq!(*starts.lock().unwrap(), vec![0, 400]);
+
+    // 补充页整页写入缓存（已缓存1200根）；之后起始时间早于第一根K线（如上市晚于起始时间）时，
+    // 缓存之前没有数据，只多一次空请求
+    starts.lock().unwrap().clear();
+    let resp = cache
+        .cached_kline(KlineType::Day, "sz000001", 0, u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(resp.list.len(), 2000);
+    assert_eq!(*starts.lock().unwrap(), vec![0, 1200, 2000]);
+    starts.lock().unwrap().clear();
+    let resp = cache
+        .cached_kline(KlineType::Day, "sz000001", 0, u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(resp.list.len(), 2000);
+    assert_eq!(*starts.lock().unwrap(), vec![0, 2000]);
+
+    let _ = std::fs::remove_dir_all(&dir);
+}
+
+/// 应答财务信息请求（`ipo_date` 为 None 时返回错误响应），其他请求交给 `inner`
+fn finance_handler(ipo_date: Option<u32>, mut inner: Handler) -> Handler {
+    Box::new(move |msg_type, req| {
+        if msg_type != MessageType::FinanceInfo.as_u16() {
+            return inner(msg_type, req);
+        }
+        match ipo_date {
+            Some(date) => {
+                let mut data = vec![0u8; 145];
+                data[21..25].copy_from_slice(&date.to_le_bytes());
+                Some((0x1C, data))
+            }
+            None => Some((CONTROL_ERROR, vec![0])),
+        }
+    })
+}
+
+#[tokio::test]
+async fn test_kline_all_during_clamps_to_ipo() {
+    let handler = |ipo_date| {
+        finance_handler(
+            ipo_date,
+            paged_kline_handler(1000, false, Default::default()),
+        )
+    };
+
+    // 起始时间早于上市日期时截断到上市日期
+    let client = mock_client(ClientOptions::default(), handler(Some(20210101))).await;
+    let resp = client
+        .get_kline_all_during(KlineType::Day, "sz000001", 0, u64::MAX)
+        .await
+        .unwrap();
+    let first = chrono::DateTime::from_timestamp(resp.list[0].time, 0).unwrap();
+    assert_eq!(first.date_naive().to_string(), "2021-01-01");
+    assert_eq!(resp.list.len(), 1000 - 366);
+
+    // 上市日期按代码缓存，其他接口同样截断
+    let finance = Arc::new(Mutex::new(0));
+    let recorder = finance.clone();
+    let options = ClientOptions::default().with_request_hook(move |frame| {
+        if frame.msg_type == MessageType::FinanceInfo {
+            *recorder.lock().unwrap() += 1;
+        }
+    });
+    let client = mock_client(options, handler(Some(20210101))).await;
+    let util = client
+        .get_kline_all_util(KlineType::Day, "sz000001", |_| true)
+        .await
+        .unwrap();
+    assert_eq!(util.list.len(), 1000 - 366);
+    let ending = client
+        .get_kline_ending_at(KlineType::Day, "sz000001", i64::MAX, 2000)
+        .await
+        .unwrap();
+    assert_eq!(ending.list.len(), 1000 - 366);
+    let dir = std::env::temp_dir().join(format!("tdx-ipo-test-{}", std::process::id()));
+    let _ = std::fs::remove_dir_all(&dir);
+    let cached = KlineFileCache::new(&client, &dir)
+        .cached_kline(KlineType::Day, "sz000001", 0, u64::MAX)
+        .await
+        .unwrap();
+    let _ = std::fs::remove_dir_all(&dir);
+    assert_eq!(cached.list.len(), 1000 - 366);
+    assert_eq!(*finance.lock().unwrap(), 1);
+
+    // ETF 不查询上市日期
+    let etf = client
+        .get_kline_all_during(KlineType::Day, "sh510300", 0, u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(etf.list.len(), 1000);
+    assert_eq!(*finance.lock().unwrap(), 1);
+
+    // 获取上市日期失败时不截断，K线照常返回
+    let client = mock_client(ClientOptions::default(), handler(None)).await;
+    let resp = client
+        .get_kline_all_during(KlineType::Day, "sz000001", 0, u64::MAX)
+        .await
+        .unwrap();
+    assert_eq!(resp.list.len(), 1000);
+}
+
+/// 统计写入次数的传输层
+struct CountingStream {
+    inner: tokio::io::DuplexStream,
+    writes: Arc<std::sync::atomic::AtomicUsize>,
+}
+
+impl tokio::io::AsyncRead for CountingStream {
+    fn poll_read(
+        mut self: std::pin::Pin<&mut Self>,
+        cx: &mut std::task::Context<'_>,
+        buf: &mut tokio::io::ReadBuf<'_>,
+    ) -> std::task::Poll<std::io::Result<()>> {
+        std::pin::Pin::new(&mut self.inner).poll_read(cx, buf)
+    }
+}
+
+impl tokio::io::AsyncWrite for CountingStream {
+    fn poll_write(
+        mut self: std::pin::Pin<&mut Self>,
+        cx: &mut std::task::Context<'_>,
+        buf: &[u8],
+    ) -> std::task::Poll<std::io::Result<usize>> {
+        self.writes
+            .fetch_add(1, std::sync::atomic::Ordering::SeqCst);
+        std::pin::Pin::new(&mut self.inner).poll_write(cx, buf)
+    }
+
+    fn poll_flush(
+        mut self: std::pin::Pin<&mut Self>,
+        cx: &mut std::task::Context<'_>,
+    ) -> std::task::Poll<std::io::Result<()>> {
+        std::pin::Pin::new(&mut self.inner).poll_flush(cx)
+    }
+
+    fn poll_shutdown(
+        mut self: std::pin::Pin<&mut Self>,
+        cx: &mut std::task::Context<'_>,
+    ) -> std::task::Poll<std::io::Result<()>> {
+        std::pin::Pin::new(&mut self.inner).poll_shutdown(cx)
+    }
+}
+
+#[tokio::test]
+async fn test_pipeline_coalesced_writes() {
+    for (coalesce, expected_writes) in [(true, 1), (false, 3)] {
+        let writes = Arc::new(std::sync::atomic::AtomicUsize::new(0));
+        let stream = CountingStream {
+            inner: spawn_server(count_kline_handler()),
+            writes: writes.clone(),
+        };
+        let options = ClientOptions::default().with_coalesce_writes(coalesce);
+        let (options, _) = mock_connector(options, vec![stream]);
+        let client = Client::connect_with("mock", options).await.unwrap();
+        writes.store(0, std::sync::atomic::Ordering::SeqCst);
+
+        let mut p = client.pipeline();
+        let slots = [
+            p.count(Exchange::SZ),
+            p.count(Exchange::SH),
+            p.count(Exchange::BJ),
+        ];
+        let mut results = p.execute().await.unwrap();
+        for slot in slots {
+            assert_eq!(results.take(slot).unwrap(), 1234);
+        }
+        assert_eq!(
+            writes.load(std::sync::atomic::Ordering::SeqCst),
+            expected_writes
+        );
+    }
+}
+#[tokio::test]
+async fn test_each_history_minute_skips_non_trading_days() {
+    let client = Client::connect_with("127.0.0.1", ClientOptions::default().with_dry_run(true))
+        .await
+        .unwrap();
+
+    // 2024-09-13（周五）至 2024-09-18，周末和中秋节（16、17日）休市
+    let holidays: std::collections::HashSet<u32> = [20240916, 20240917].into_iter().collect();
+    let mut dates = Vec::new();
+    let days = client
+        .each_history_minute("sz000001", 20240913, 20240918, &holidays, |date, minute| {
+            assert_eq!(minute.count, 0);
+            dates.push(date);
+            Ok::<_, ClientError>(())
+        })
+        .await
+        .unwrap();
+    assert_eq!(days, 2);
+    assert_eq!(dates, [20240913, 20240918]);
+
+    // 回调出错时停止
+    let err = client
+        .each_history_minute("sz000001", 20240913, 20240918, &holidays, |_, _| {
+            Err(ClientError::Other("stop".to_string()))
+        })
+        .await
+        .unwrap_err();
+    assert!(matches!(err, ClientError::Other(_)));
+}
+
+#[tokio::test]
+async fn test_tcp_keepalive() {
+    let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap();
+    let stream = tokio::net::TcpStream::connect(addr).await.unwrap();
+    let socket = socket2::SockRef::from(&stream);
+    assert!(!socket.keepalive().unwrap());
+
+    tdx_rust::transport::set_tcp_keepalive(&stream, std::time::Duration::from_secs(30)).unwrap();
+    assert!(socket.keepalive().unwrap());
+
+    let options = ClientOptions::default().with_tcp_keepalive(std::time::Duration::from_secs(30));
+    assert_eq!(
+        options.tcp_keepalive,
+        Some(std::time::Duration::from_secs(30))
+    );
+}
+
+/// 之后的请求都以指定的 control 和数据域应答
+fn control_handler(control: u8, data: &'static [u8]) -> Handler {
+    Box::new(move |_, _| Some((control, data.to_vec())))
+}
+
+#[tokio::test]
+async fn test_rehandshake_policy() {
+    // 第一个连接以 `control` 应答请求，重新握手后的连接正常应答
+    let connect = |control: u8, data: &'static [u8], options: ClientOptions| async move {
+        let options = options.with_reconnect_backoff(
+            std::time::Duration::from_millis(1),
+            std::time::Duration::from_millis(1),
+            0.0,
+        );
+        let streams = vec![
+            spawn_server(control_handler(control, data)),
+            spawn_server(count_kline_handler()),
+        ];
+        let (options, _) = mock_connector(options, streams);
+        Client::connect_with("mock", options).await.unwrap()
+    };
+    let expired = |options| connect(CONTROL_ERROR, &[], options);
+
+    // 未开启时直接返回会话过期
+    let client = expired(ClientOptions::default()).await;
+    let err = client.get_count(Exchange::SZ).await.unwrap_err();
+    assert!(matches!(err, ClientError::SessionExpired));
+
+    // 默认条件：会话过期后重新握手并重试
+    let client = expired(ClientOptions::default().with_rehandshake_on(&[])).await;
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+
+    // 带数据的错误响应是协议错误，不重新握手
+    let options = ClientOptions::default().with_rehandshake_on(&[]);
+    let client = connect(CONTROL_ERROR, &[1, 0], options).await;
+    let err = client.get_count(Exchange::SZ).await.unwrap_err();
+    assert!(matches!(err, ClientError::ServerError(CONTROL_ERROR)));
+    assert!(err.is_protocol());
+
+    // 带成功标志的 control 默认视为正常响应，注册后触发重新握手
+    let client = connect(0x1D, &[1, 0], ClientOptions::default()).await;
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1);
+    let options = ClientOptions::default().with_rehandshake_on(&[0x1D]);
+    let client = connect(0x1D, &[1, 0], options).await;
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+
+    // 自定义条件不匹配时不重试
+    let options = ClientOptions::default().with_rehandshake_when(|e| e.is_protocol());
+    let client = expired(options).await;
+    assert!(matches!(
+        client.get_count(Exchange::SZ).await,
+        Err(ClientError::SessionExpired)
+    ));
+}
+
+#[tokio::test]
+async fn test_schedule_session_reconnect() {
+    // 2024-01-05（周五）14:59:59，1秒后到达收盘边界
+    let close = 1_704_438_000;
+    let options = ClientOptions::default()
+        .with_time_source(TimeSource::Custom(Clock(Arc::new(move || close - 1))));
+    let streams = vec![
+        spawn_server(count_kline_handler()),
+        spawn_server(count_kline_handler()),
+    ];
+    let (options, addrs) = mock_connector(options, streams);
+    let client = Arc::new(Client::connect_with("mock", options).await.unwrap());
+
+    let (mut events, schedule) = client
+        .clone()
+        .schedule_session_reconnect(&SESSION_BOUNDARIES, Default::default());
+    let event = events.recv().await.unwrap().unwrap();
+    assert_eq!(event.at, close);
+    assert_eq!(addrs.lock().unwrap().len(), 2);
+    assert_eq!(client.get_count(Exchange::SZ).await.unwrap(), 1234);
+    schedule.stop();
+}
+
+/// 编码板块文件：每个板块为 (名称, 板块类型, 成分股代码)
+fn block_file(blocks: &[(&str, u16, &[&str])]) -> Vec<u8> {
+    let mut data = vec![0u8; 384];
+    data.extend_from_slice(&(blocks.len() as u16).to_le_bytes());
+    for (name, block_type, codes) in blocks {
+        let mut block = name.as_bytes().to_vec();
+        block.resize(9, 0);
+        block.extend_from_slice(&(codes.len() as u16).to_le_bytes());
+        block.extend_from_slice(&block_type.to_le_bytes());
+        for code in codes.iter() {
+            block.extend_from_slice(code.as_bytes());
+            block.push(0);
+        }
+        block.resize(9 + 2 + 2 + 2800, 0);
+        data.extend_from_slice(&block);
+    }
+    data
+}
+
+/// 应答板块文件信息和内容请求，`metas` 记录板块文件信息请求的次数
+fn block_handler(metas: Arc<Mutex<usize>>) -> Handler {
+    let file = |name: &[u8]| match name {
+        b"block_gn.dat" => block_file(&[("GN1", 2, &["000001", "600000"])]),
+        b"block_fg.dat" => block_file(&[]),
+        b"block_zs.dat" => block_file(&[("ZS1", 3, &["000001"])]),
+        _ => Vec::new(),
+    };
+    let name = |data: &[u8]| data.split(|b| *b == 0).next().unwrap_or_default().to_vec();
+    Box::new(move |msg_type, req| {
+        if msg_type == MessageType::BlockMeta.as_u16() {
+            *metas.lock().unwrap() += 1;
+            let mut data = (file(&name(req)).len() as u32).to_le_bytes().to_vec();
+            data.resize(38, 0);
+            Some((0x1C, data))
+        } else if msg_type == MessageType::BlockInfo.as_u16() {
+            let start = u32::from_le_bytes(req[0..4].try_into().unwrap()) as usize;
+            let size = u32::from_le_bytes(req[4..8].try_into().unwrap()) as usize;
+            let content = file(&name(&req[8..]));
+            let chunk = &content[start..(start + size).min(content.len())];
+            let mut data = (chunk.len() as u32).to_le_bytes().to_vec();
+            data.extend_from_slice(chunk);
+            Some((0x1C, data))
+        } else {
+            None
+        }
+    })
+}
+
+#[tokio::test]
+async fn test_blocks_for_code() {
+    let metas = Arc::new(Mutex::new(0));
+    let client = mock_client(ClientOptions::default(), block_handler(metas.clone())).await;
+
+    // 并发的首次调用只下载一次板块文件（每个文件一次信息请求）
+    let (sz, sh) = tokio::join!(
+        client.blocks_for_code("sz000001"),
+        client.blocks_for_code("sh600000")
+    );
+    assert_eq!(*metas.lock().unwrap(), 3);
+
+    let sz = sz.unwrap();
+    assert_eq!(sz.len(), 2);
+    assert_eq!((sz[0].file, sz[0].block_type), (BlockFile::Concept, 2));
+    assert_eq!((sz[1].file, sz[1].block_type), (BlockFile::Index, 3));
+    let sh = sh.unwrap();
+    assert_eq!(sh.len(), 1);
+    assert_eq!(sh[0].file, BlockFile::Concept);
+
+    // 上证指数与平安银行代码相同，但不属于平安银行的板块
+    assert!(client.blocks_for_code("sh000001").await.unwrap().is_empty());
+    assert!(matches!(
+        client.blocks_for_code("000001").await,
+        Err(ClientError::Message(MessageError::AmbiguousCode(_)))
+    ));
+    assert_eq!(*metas.lock().unwrap(), 3);
+}
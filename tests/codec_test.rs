@@ -0,0 +1,85 @@
+//! 编解码基础函数测试（随机输入）
+
+use tdx_rust::protocol::*;
+
+/// 简单的线性同余随机数生成器，保证测试可复现
+struct Lcg(u64);
+
+impl Lcg {
+    fn next_u32(&mut self) -> u32 {
+        self.0 = self
+            .0
+            .wrapping_mul(6364136223846793005)
+            .wrapping_add(1442695040888963407);
+        (self.0 >> 32) as u32
+    }
+
+    fn bytes(&mut self, len: usize) -> Vec<u8> {
+        (0..len).map(|_| self.next_u32() as u8).collect()
+    }
+}
+
+#[test]
+fn test_varint_round_trip() {
+    let mut rng = Lcg(1);
+    let mut values = vec![0, 1, -1, 63, 64, -64, i32::MAX, i32::MIN, i32::MIN + 1];
+    values.extend((0..10000).map(|_| rng.next_u32() as i32));
+
+    for value in values {
+        let encoded = encode_varint(value);
+        let (decoded, consumed) = decode_varint(&encoded);
+        assert_eq!(decoded, value, "编码: {:02X?}", encoded);
+        assert_eq!(consumed, encoded.len());
+
+        let mut reader = ByteReader::new(&encoded);
+        assert_eq!(reader.read_varint().unwrap(), value);
+        assert_eq!(reader.remaining(), 0);
+    }
+}
+
+#[test]
+fn test_random_bytes_never_panic() {
+    let mut rng = Lcg(2);
+    for _ in 0..10000 {
+        let len = (rng.next_u32() % 12) as usize;
+        let data = rng.bytes(len);
+
+        let (_, consumed) = decode_varint(&data);
+        assert!(consumed <= data.len());
+        decode_volume(&data);
+        decode_volume2(&data);
+
+        let mut reader = ByteReader::new(&data);
+        while reader.remaining() > 0 {
+            let before = reader.position();
+            match rng.next_u32() % 5 {
+                0 => reader.read_varint().map(|_| ()),
+                1 => reader.read_price().map(|_| ()),
+                2 => reader.read_volume().map(|_| ()),
+                3 => reader.read_u16().map(|_| ()),
+                _ => reader.read_u32().map(|_| ()),
+            }
+            .unwrap_or_else(|_| assert_eq!(reader.position(), before));
+            if reader.position() == before {
+                break;
+            }
+        }
+    }
+}
+
+#[test]
+fn test_byte_reader_truncated() {
+    // 继续位置位但没有后续字节
+    let mut reader = ByteReader::new(&[0x80]);
+    assert!(matches!(
+        reader.read_varint(),
+        Err(MessageError::InsufficientData)
+    ));
+    assert_eq!(reader.position(), 0);
+
+    let mut reader = ByteReader::new(&[0x01, 0x02, 0x03]);
+    assert!(reader.read_u32().is_err());
+    assert_eq!(reader.read_u16().unwrap(), 0x0201);
+    assert_eq!(reader.read_u8().unwrap(), 0x03);
+    assert!(reader.read_u8().is_err());
+}
@@ -0,0 +1,396 @@
+//! K线工具测试
+
+use chrono::{FixedOffset, TimeZone};
+use std::collections::HashSet;
+use tdx_rust::protocol::test_data::TestData;
+use tdx_rust::protocol::*;
+
+/// 构造指定日期（北京时间15:00）的日K线
+fn day_kline(year: i32, month: u32, day: u32, close: i64, volume: i64, amount: i64) -> Kline {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let time = beijing_offset
+        .with_ymd_and_hms(year, month, day, 15, 0, 0)
+        .unwrap()
+        .timestamp();
+    Kline {
+        last: Price(close - 10),
+        open: Price(close - 5),
+        high: Price(close + 20),
+        low: Price(close - 20),
+        close: Price(close),
+        order: 0,
+        volume,
+        amount: Price(amount),
+        time,
+        up_count: 0,
+        down_count: 0,
+    }
+}
+
+#[test]
+fn test_resample_month_preserves_amount() {
+    // 2024年3月的交易日，成交额使用难以用浮点数精确表示的值
+    let days = [
+        1, 4, 5, 6, 7, 8, 11, 12, 13, 14, 15, 18, 19, 20, 21, 22, 25, 26, 27, 28, 29,
+    ];
+    let daily: Vec<Kline> = days
+        .iter()
+        .enumerate()
+        .map(|(i, &d)| {
+            let amount = 1_234_567_890_123 + i as i64 * 100_000_000_007;
+            day_kline(
+                2024,
+                3,
+                d,
+                10_000 + i as i64,
+                987_654_321 + i as i64,
+                amount,
+            )
+        })
+        .collect();
+
+    let monthly = resample_klines(&daily, ResamplePeriod::Month);
+    assert_eq!(monthly.len(), 1);
+
+    let month = &monthly[0];
+    let amount_sum: i64 = daily.iter().map(|k| k.amount.as_i64()).sum();
+    let volume_sum: i64 = daily.iter().map(|k| k.volume).sum();
+    assert_eq!(month.amount.as_i64(), amount_sum);
+    assert_eq!(month.volume, volume_sum);
+    assert_eq!(month.open, daily[0].open);
+    assert_eq!(month.last, daily[0].last);
+    assert_eq!(month.close, daily[daily.len() - 1].close);
+    assert_eq!(month.time, daily[daily.len() - 1].time);
+
+    // 按周合并后，各周成交额之和同样等于日成交额之和
+    let weekly = resample_klines(&daily, ResamplePeriod::Week);
+    assert_eq!(weekly.len(), 5);
+    let weekly_sum: i64 = weekly.iter().map(|k| k.amount.as_i64()).sum();
+    assert_eq!(weekly_sum, amount_sum);
+}
+
+#[test]
+fn test_kline_binary_round_trip() {
+    let list = vec![
+        day_kline(2024, 3, 1, 10_000, 1_000, 10_000_000),
+        day_kline(2024, 3, 4, 10_500, 2_000, 21_000_000),
+    ];
+    let data = encode_klines(&list);
+    let decoded = decode_klines(&data).unwrap();
+    assert_eq!(decoded.len(), 2);
+    assert_eq!(decoded[1].close, list[1].close);
+    assert_eq!(decoded[1].amount, list[1].amount);
+    assert_eq!(decoded[1].time, list[1].time);
+
+    assert!(decode_klines(&data[..data.len() - 1]).is_err());
+}
+
+#[test]
+fn test_is_partial_bar() {
+    let k = day_kline(2024, 3, 4, 10_000, 1_000, 10_000_000);
+
+    // 当天收盘前，日K线未收盘；收盘后已收盘
+    assert!(is_partial_bar(KlineType::Day, &k, k.time - 3600));
+    assert!(!is_partial_bar(KlineType::Day, &k, k.time));
+
+    // 周K线在本周结束前始终未收盘
+    assert!(is_partial_bar(KlineType::Week, &k, k.time + 86400));
+    assert!(!is_partial_bar(KlineType::Week, &k, k.time + 7 * 86400));
+}
+
+/// 构造一根日K线的响应数据
+fn encode_day_bar(date: u32, open: i32, close: i32, high: i32, low: i32) -> Vec<u8> {
+    let mut data = date.to_le_bytes().to_vec();
+    for diff in [open, close, high, low] {
+        data.extend_from_slice(&encode_varint(diff));
+    }
+    data.extend_from_slice(&[0u8; 8]); // 成交量、成交额
+    data
+}
+
+#[test]
+fn test_kline_decode_count_mismatch() {
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+    let bar = encode_day_bar(20240102, 10000, 100, 200, -100);
+
+    let mut data = 1u16.to_le_bytes().to_vec();
+    data.extend_from_slice(&bar);
+    let resp = KlineMsg::decode_response(&data, cache).unwrap();
+    assert_eq!(resp.list.len(), 1);
+
+    // 声明2根，实际只有1根
+    let mut data = 2u16.to_le_bytes().to_vec();
+    data.extend_from_slice(&bar);
+    match KlineMsg::decode_response(&data, cache) {
+        Err(MessageError::CountMismatch { declared, decoded }) => {
+            assert_eq!((declared, decoded), (2, 1));
+        }
+        other => panic!("期望 CountMismatch, 得到 {:?}", other),
+    }
+
+    // 声明数量之后的填充字节忽略
+    let mut data = 1u16.to_le_bytes().to_vec();
+    data.extend_from_slice(&bar);
+    data.extend_from_slice(&[0u8; 14]);
+    let resp = KlineMsg::decode_response(&data, cache).unwrap();
+    assert_eq!(resp.list.len(), 1);
+    assert_eq!(resp.list[0].close, Price(10100));
+}
+
+#[test]
+fn test_kline_decode_partial_keeps_prefix() {
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+    let mut data = 3u16.to_le_bytes().to_vec();
+    data.extend_from_slice(&encode_day_bar(20240102, 10000, 100, 200, -100));
+    data.extend_from_slice(&encode_day_bar(20240103, 0, 50, 80, -20));
+    let third = encode_day_bar(20240104, 0, 10, 20, -10);
+    data.extend_from_slice(&third[..third.len() - 3]);
+
+    let (list, err) = KlineMsg::decode_response_partial(&data, cache);
+    assert_eq!(list.len(), 2);
+    assert_eq!(list[1].close, Price(10150));
+    assert!(matches!(err, Some(MessageError::InsufficientData)));
+
+    // 去掉截断的第三根后，两根完整K线与声明的数量不符
+    let complete = &data[..data.len() - third.len() + 3];
+    let (list, err) = KlineMsg::decode_response_partial(complete, cache);
+    assert_eq!(list.len(), 2);
+    assert!(matches!(err, Some(MessageError::CountMismatch { .. })));
+}
+
+#[test]
+fn test_kline_amount_beyond_32_bits() {
+    // 成交额编码：[低位, 中位, 高位, 指数]，值为 2^(指数*2-127) 乘以尾数
+    let amounts: [([u8; 4], i64); 3] = [
+        ([0, 0, 0, 79], 1 << 31),
+        ([0, 0, 0x40, 79], 3 << 30),
+        ([0, 0, 0, 81], 1 << 35),
+    ];
+    for (bytes, yuan) in amounts {
+        assert_eq!(decode_volume2(&bytes), yuan as f64);
+    }
+
+    for is_index in [false, true] {
+        let cache = KlineCache {
+            is_index,
+            ..KlineCache::new(KlineType::Day, "sz000001")
+        };
+        let mut data = (amounts.len() as u16).to_le_bytes().to_vec();
+        for (i, (bytes, _)) in amounts.iter().enumerate() {
+            let bar = encode_day_bar(20240102 + i as u32, 10000, 100, 200, -100);
+            data.extend_from_slice(&bar[..bar.len() - 8]);
+            data.extend_from_slice(&[0u8; 4]);
+            data.extend_from_slice(bytes);
+            if is_index {
+                data.extend_from_slice(&[0u8; 4]); // 上涨/下跌数量
+            }
+        }
+
+        let resp = KlineMsg::decode_response(&data, cache).unwrap();
+        for (k, (_, yuan)) in resp.list.iter().zip(amounts) {
+            assert_eq!(k.amount.as_i64(), yuan * 1000);
+        }
+    }
+}
+
+#[test]
+fn test_aggregate_intraday_matches_daily() {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let open_time = beijing_offset
+        .with_ymd_and_hms(2024, 3, 1, 9, 31, 0)
+        .unwrap()
+        .timestamp();
+    let minutes: Vec<Kline> = (0..240)
+        .map(|i| {
+            let mut k = day_kline(2024, 3, 1, 10_000 + i % 7, 100 + i, 1_000_000 + i);
+            k.time = open_time + i * 60;
+            k
+        })
+        .collect();
+    assert!(aggregate_intraday(&[]).is_none());
+
+    let day = aggregate_intraday(&minutes).unwrap();
+    assert_eq!(day.time, day_kline(2024, 3, 1, 0, 0, 0).time);
+    assert_eq!(day.open, minutes[0].open);
+    assert_eq!(day.close, minutes[239].close);
+    assert_eq!(day.high, Price(10_006 + 20));
+    assert_eq!(day.low, Price(10_000 - 20));
+    assert_eq!(day.volume, minutes.iter().map(|k| k.volume).sum::<i64>());
+    assert_eq!(
+        day.amount.as_i64(),
+        minutes.iter().map(|k| k.amount.as_i64()).sum::<i64>()
+    );
+    assert!(compare_klines(&day, &day, 0.0).is_empty());
+
+    // 成交量相差1%，超过0.1%的容差
+    let mut daily = day.clone();
+    daily.volume = day.volume * 101 / 100;
+    let diffs = compare_klines(&daily, &day, 0.001);
+    assert_eq!(diffs.len(), 1);
+    assert_eq!(diffs[0].field, "volume");
+    assert_eq!(diffs[0].expected, daily.volume);
+    assert!(compare_klines(&daily, &day, 0.02).is_empty());
+}
+
+#[test]
+fn test_is_partial_bar_in_calendar() {
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let at = |month: u32, day: u32, hour: u32| {
+        beijing_offset
+            .with_ymd_and_hms(2024, month, day, hour, 0, 0)
+            .unwrap()
+            .timestamp()
+    };
+    // 2024-03-01（周五）的周K线
+    let k = day_kline(2024, 3, 1, 10_000, 1_000, 10_000_000);
+    let none = HashSet::new();
+    assert!(is_partial_bar_in(KlineType::Week, &k, at(3, 1, 10), &none));
+    // 周五收盘后和周末本周已没有交易时段
+    assert!(!is_partial_bar_in(KlineType::Week, &k, at(3, 1, 16), &none));
+    assert!(!is_partial_bar_in(KlineType::Week, &k, at(3, 2, 10), &none));
+    assert!(is_partial_bar(KlineType::Week, &k, at(3, 2, 10)));
+
+    // 周四（2024-02-29）收盘后，周五休市时本周已收盘
+    let k = day_kline(2024, 2, 29, 10_000, 1_000, 10_000_000);
+    assert!(is_partial_bar_in(KlineType::Week, &k, at(2, 29, 16), &none));
+    let holidays: HashSet<u32> = [20240301].into_iter().collect();
+    assert!(!is_partial_bar_in(
+        KlineType::Week,
+        &k,
+        at(2, 29, 16),
+        &holidays
+    ));
+
+    // 日K线与日历无关
+    assert!(is_partial_bar_in(
+        KlineType::Day,
+        &k,
+        at(2, 29, 10),
+        &holidays
+    ));
+    assert!(!is_partial_bar_in(
+        KlineType::Day,
+        &k,
+        at(2, 29, 16),
+        &holidays
+    ));
+}
+
+#[test]
+fn test_resample_week_across_chinese_new_year() {
+    // 2024年春节休市 2月9日（周五）至2月17日，2月18日（周日）调休不开市
+    let days = [
+        (1, 29),
+        (1, 30),
+        (1, 31),
+        (2, 1),
+        (2, 2),
+        (2, 5),
+        (2, 6),
+        (2, 7),
+        (2, 8),
+        (2, 19),
+        (2, 20),
+        (2, 21),
+        (2, 22),
+        (2, 23),
+    ];
+    let daily: Vec<Kline> = days
+        .iter()
+        .enumerate()
+        .map(|(i, &(m, d))| {
+            day_kline(
+                2024,
+                m,
+                d,
+                10_000 + i as i64 * 10,
+                1_000 + i as i64,
+                100_000,
+            )
+        })
+        .collect();
+
+    // 按自然周分组的预期结果：每周一根，时间为该周最后一个交易日，整周休市的2月12日那周没有K线。
+    // 与服务器周K线的比对见 test_resample_week_matches_server_cny2024
+    let weekly = [
+        (day_kline(2024, 2, 2, 0, 0, 0).time, 0..5),
+        (day_kline(2024, 2, 8, 0, 0, 0).time, 5..9),
+        (day_kline(2024, 2, 23, 0, 0, 0).time, 9..14),
+    ];
+
+    let resampled = resample_klines(&daily, ResamplePeriod::Week);
+    assert_eq!(resampled.len(), weekly.len());
+    for (bar, (time, range)) in resampled.iter().zip(weekly) {
+        let days = &daily[range];
+        assert_eq!(bar.time, time);
+        assert_eq!(bar.open, days[0].open);
+        assert_eq!(bar.close, days[days.len() - 1].close);
+        assert_eq!(bar.high, days.iter().map(|k| k.high).max().unwrap());
+        assert_eq!(bar.low, days.iter().map(|k| k.low).min().unwrap());
+        assert_eq!(bar.volume, days.iter().map(|k| k.volume).sum::<i64>());
+    }
+
+    // 跨年的一周合并为一根
+    let new_year = [
+        day_kline(2024, 12, 30, 10_000, 1, 1),
+        day_kline(2024, 12, 31, 10_000, 1, 1),
+        day_kline(2025, 1, 2, 10_000, 1, 1),
+        day_kline(2025, 1, 3, 10_000, 1, 1),
+        day_kline(2025, 1, 6, 10_000, 1, 1),
+    ];
+    let resampled = resample_klines(&new_year, ResamplePeriod::Week);
+    assert_eq!(resampled.len(), 2);
+    assert_eq!(resampled[0].time, new_year[3].time);
+    assert_eq!(resampled[0].volume, 4);
+}
+
+/// 加载采集的K线测试数据
+fn load_captured_klines(name: &str) -> Vec<Kline> {
+    let path = format!("tdx-test/test-data/{}.json", name);
+    let content = std::fs::read_to_string(&path)
+        .unwrap_or_else(|_| panic!("缺少 {}，需先运行 examples/capture 从服务器采集", path));
+    let test_data: TestData = serde_json::from_str(&content).unwrap();
+    let response = ResponseFrame::decode(&test_data.decode_response().unwrap()).unwrap();
+    let kline_type = if name.contains("week") {
+        KlineType::Week
+    } else {
+        KlineType::Day
+    };
+    KlineMsg::decode_response(response.data(), KlineCache::new(kline_type, "sz000001"))
+        .unwrap()
+        .list
+}
+
+#[test]
+#[ignore = "需要先用 examples/capture 采集 kline_day_cny2024.json 和 kline_week_cny2024.json"]
+fn test_resample_week_matches_server_cny2024() {
+    // 2024-01-29（周一）至 2024-03-01（周五），中间是春节休市的一整周
+    let beijing_offset = FixedOffset::east_opt(8 * 3600).unwrap();
+    let from = beijing_offset
+        .with_ymd_and_hms(2024, 1, 29, 0, 0, 0)
+        .unwrap()
+        .timestamp();
+    let to = beijing_offset
+        .with_ymd_and_hms(2024, 3, 1, 23, 59, 59)
+        .unwrap()
+        .timestamp();
+    let in_range = |k: &Kline| k.time >= from && k.time <= to;
+
+    let daily: Vec<Kline> = load_captured_klines("kline_day_cny2024")
+        .into_iter()
+        .filter(in_range)
+        .collect();
+    let server: Vec<Kline> = load_captured_klines("kline_week_cny2024")
+        .into_iter()
+        .filter(in_range)
+        .collect();
+    assert!(!daily.is_empty());
+
+    let resampled = resample_klines(&daily, ResamplePeriod::Week);
+    assert_eq!(resampled.len(), server.len());
+    for (local, server) in resampled.iter().zip(&server) {
+        assert_eq!(local.time, server.time);
+        // 服务器成交额是浮点编码，与日成交额之和有舍入差异
+        assert!(compare_klines(server, local, 1e-4).is_empty());
+    }
+}
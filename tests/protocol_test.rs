@@ -12,6 +12,12 @@ fn load_test_data(filename: &str) -> Result<TestData, Box<dyn std::error::Error>
     Ok(data)
 }
 
+/// 解码行情测试数据（sz000001、sh600008）
+fn load_quotes() -> Vec<QuoteInfo> {
+    let bytes = load_test_data("quote").unwrap().decode_response().unwrap();
+    Quote::decode_response(ResponseFrame::decode(&bytes).unwrap().data()).unwrap()
+}
+
 #[test]
 fn test_connect_request() {
     let test_data = load_test_data("connect").unwrap();
@@ -51,6 +57,10 @@ fn test_connect_response() {
     let info = Connect::decode_response(&response.data).unwrap();
     assert!(!info.is_empty());
     println!("连接响应信息: {}", info);
+
+    let connect = Connect::decode_connect_response(&response.data).unwrap();
+    assert_eq!(connect.header.len(), 68);
+    assert_eq!(connect.info, info.trim());
 }
 
 #[test]
@@ -81,23 +91,23 @@ fn test_count_request() {
     // 解码请求帧
     let request_bytes = test_data.decode_request().unwrap();
 
-    // 解析请求帧
+    // 解析请求帧，数据域中的交易所为深圳
     let frame = RequestFrame::decode(&request_bytes).unwrap();
     assert_eq!(frame.msg_type, MessageType::Count);
-    // 注意：测试数据中 exchange 是 0x00（深圳），但我们的实现使用 Exchange::SH (0x01)
-    // 这里只验证数据域格式正确
-    assert_eq!(frame.data.len(), 6);
+    assert_eq!(Count::decode_request(&frame.data).unwrap(), Exchange::SZ);
 
-    // 验证编码（只验证数据域，MsgID可能不同）
-    // 注意：测试数据使用 Exchange::SZ (0x00)，我们的实现使用 Exchange::SH (0x01)
-    // 这里只验证帧格式正确，不验证具体交易所值
-    let count_frame = Count::request(3, Exchange::SZ);
-    let encoded = count_frame.encode();
-    assert_eq!(encoded[0], PREFIX);
-    assert_eq!(encoded[5], 0x01); // Control
-    assert_eq!(&encoded[10..12], &request_bytes[10..12]); // Type
-    // 数据域应该匹配（除了交易所字段）
-    assert_eq!(encoded.len(), request_bytes.len());
+    // 编码结果与测试数据完全一致
+    assert_eq!(frame.data, Count::encode(Exchange::SZ));
+    assert_eq!(Count::request(3, Exchange::SZ).encode(), request_bytes);
+
+    // 各市场编解码对称
+    for exchange in [Exchange::SZ, Exchange::SH, Exchange::BJ] {
+        assert_eq!(
+            Count::decode_request(&Count::encode(exchange)).unwrap(),
+            exchange
+        );
+    }
+    assert!(Count::decode_request(&[0x00]).is_err());
 }
 
 #[test]
@@ -232,3 +242,1131 @@ fn test_frame_decode_all() {
         }
     }
 }
+
+#[test]
+fn test_block_parse_file() {
+    // 文件头(384) + 数量(2) + 板块(名称9 + 数量2 + 类型2 + 400x7)
+    let mut data = vec![0u8; 384];
+    data.extend_from_slice(&2u16.to_le_bytes());
+    for (name, codes) in [("BK1", vec!["000001", "600000"]), ("BK2", vec!["600000"])] {
+        let mut block = name.as_bytes().to_vec();
+        block.resize(9, 0);
+        block.extend_from_slice(&(codes.len() as u16).to_le_bytes());
+        block.extend_from_slice(&2u16.to_le_bytes());
+        for code in &codes {
+            block.extend_from_slice(code.as_bytes());
+            block.push(0);
+        }
+        block.resize(9 + 2 + 2 + 2800, 0);
+        data.extend_from_slice(&block);
+    }
+
+    let blocks = BlockMsg::parse_file(&data).unwrap();
+    assert_eq!(blocks.len(), 2);
+    assert_eq!(blocks[0].name, "BK1");
+    assert_eq!(blocks[0].block_type, 2);
+    assert_eq!(blocks[0].codes, vec!["000001", "600000"]);
+    assert_eq!(blocks[1].codes, vec!["600000"]);
+
+    // 截断的文件应返回错误
+    assert!(BlockMsg::parse_file(&data[..384 + 2 + 20]).is_err());
+}
+
+#[test]
+fn test_frame_scanner_buffered() {
+    let count = load_test_data("count").unwrap().decode_response().unwrap();
+    let quote = load_test_data("quote").unwrap().decode_response().unwrap();
+
+    // 两个完整帧 + 被截断的第三帧
+    let mut stream = count.clone();
+    stream.extend_from_slice(&quote);
+    stream.extend_from_slice(&count[..10]);
+
+    let mut scanner = FrameScanner::new(stream.as_slice());
+    assert_eq!(
+        scanner.scan().unwrap().unwrap().msg_type,
+        MessageType::Count
+    );
+    assert_eq!(
+        scanner.scan().unwrap().unwrap().msg_type,
+        MessageType::Quote
+    );
+    assert!(scanner.scan().is_none());
+    assert_eq!(scanner.buffered(), &count[..10]);
+}
+
+#[test]
+fn test_diff_quotes() {
+    let prev = load_quotes();
+    assert!(prev.len() >= 2);
+
+    // 第一只价格上涨、第二只消失
+    let mut cur: Vec<QuoteInfo> = prev.iter().rev().skip(1).cloned().collect();
+    cur[0].k.close = Price(cur[0].k.close.0 + 10);
+
+    let changes = diff_quotes(&prev, &cur);
+    assert_eq!(changes.len(), 2);
+    assert_eq!(changes[0].code, prev[0].code);
+    assert_eq!(changes[0].kind, QuoteChangeKind::Updated);
+    assert_eq!(changes[0].direction, PriceDirection::Up);
+    assert_eq!(changes[1].code, prev[1].code);
+    assert_eq!(changes[1].kind, QuoteChangeKind::Removed);
+
+    // 相同快照没有变化
+    assert!(diff_quotes(&prev, &prev).is_empty());
+}
+
+#[test]
+fn test_code_classification_with_exchange() {
+    // 带交易所前缀时，上海 000xxx 为指数而非深圳股票
+    assert!(is_index("sh000001"));
+    assert!(!is_stock("sh000001"));
+    assert!(is_stock("sz000001"));
+    assert!(!is_index("sz000001"));
+    assert!(is_index("sz399006"));
+    assert!(is_index("sh999999"));
+    assert!(is_index("bj899050"));
+}
+
+#[test]
+fn test_frame_too_large() {
+    let bytes = load_test_data("count").unwrap().decode_response().unwrap();
+    let frame = ResponseFrame::decode(&bytes).unwrap();
+
+    match ResponseFrame::decode_with_max(&bytes, frame.length as usize - 1) {
+        Err(FrameError::FrameTooLarge { size, max }) => {
+            assert_eq!(size, frame.length as usize);
+            assert_eq!(max, frame.length as usize - 1);
+        }
+        other => panic!("期望 FrameTooLarge, 得到 {:?}", other.map(|f| f.msg_type)),
+    }
+    assert!(ResponseFrame::decode_with_max(&bytes, frame.length as usize).is_ok());
+}
+
+#[test]
+fn test_response_trailing_padding() {
+    let test_data = load_test_data("count_padded").unwrap();
+    let bytes = test_data.decode_response().unwrap();
+    let frame = ResponseFrame::decode(&bytes).unwrap();
+    assert_eq!(
+        Some(frame.data().to_vec()),
+        test_data.decode_response_data().unwrap()
+    );
+    assert_eq!(Count::decode_response(frame.data()).unwrap(), 456);
+
+    // 数据不足帧头声明的长度仍视为错误
+    let unpadded = load_test_data("count").unwrap().decode_response().unwrap();
+    assert!(matches!(
+        ResponseFrame::decode(&unpadded[..unpadded.len() - 1]),
+        Err(FrameError::InsufficientData)
+    ));
+}
+
+#[test]
+fn test_quote_flow() {
+    let prev = load_quotes().remove(0);
+
+    let mut cur = prev.clone();
+    cur.total_hand += 10;
+    cur.amount = Price(cur.amount.0 + Price::from_yuan(10.0 * 100.0 * 12.5).0);
+    cur.k.close = Price(cur.k.close.0 + 10);
+
+    let flow = quote_flow(&prev, &cur);
+    assert!(!flow.new_day);
+    assert_eq!(flow.volume_delta, 10);
+    assert_eq!(flow.avg_price, Price::from_yuan(12.5));
+    assert_eq!(flow.direction, PriceDirection::Up);
+
+    // 累计成交量回落视为新交易日
+    let mut next_day = prev.clone();
+    next_day.total_hand = 5;
+    next_day.amount = Price::from_yuan(5.0 * 100.0 * 10.0);
+    let flow = quote_flow(&prev, &next_day);
+    assert!(flow.new_day);
+    assert_eq!(flow.volume_delta, 5);
+    assert_eq!(flow.avg_price, Price::from_yuan(10.0));
+}
+
+#[test]
+fn test_trading_status() {
+    let quote = load_quotes().remove(0);
+    assert_eq!(trading_status(&quote), TradingStatus::Normal);
+
+    let mut halted = quote.clone();
+    halted.k.open = Price(0);
+    halted.total_hand = 0;
+    assert_eq!(trading_status(&halted), TradingStatus::Halted);
+    assert_eq!(TradingStatus::Halted.to_string(), "停牌");
+}
+
+#[test]
+fn test_trade_etf_decode() {
+    let test_data = load_test_data("trade_etf").unwrap();
+    let request_bytes = test_data.decode_request().unwrap();
+    let request = TradeMsg::request(8, "sh510300", 0, 10).unwrap();
+    assert_eq!(request.encode(), request_bytes);
+
+    let response_bytes = test_data.decode_response().unwrap();
+    let response = ResponseFrame::decode(&response_bytes).unwrap();
+    let cache = TradeCache {
+        date: "20240102".to_string(),
+        code: "sh510300".to_string(),
+    };
+    let resp = TradeMsg::decode_response(response.data(), &cache).unwrap();
+
+    // 场内基金价格差值单位为厘
+    assert_eq!(resp.count, 2);
+    assert_eq!(resp.list[0].price, Price::from_yuan(3.912));
+    assert_eq!(resp.list[0].volume, 1200);
+    assert_eq!(resp.list[0].number, 15);
+    assert_eq!(resp.list[0].status, TradeStatus::Buy);
+    assert_eq!(resp.list[1].price, Price::from_yuan(3.914));
+    assert_eq!(resp.list[1].volume, 300);
+    assert_eq!(resp.list[1].status, TradeStatus::Sell);
+
+    assert!(is_etf("sz161725"));
+    assert!(is_etf("sh501018"));
+}
+
+#[test]
+fn test_finance_info_decode() {
+    let request = FinanceInfoMsg::request(1, "sz000001").unwrap();
+    assert_eq!(request.msg_type, MessageType::FinanceInfo);
+    assert_eq!(request.data, b"\x01\x00\x00000001".to_vec());
+
+    let mut data = vec![0x01, 0x00, 0x00];
+    data.extend_from_slice(b"000001");
+    data.extend_from_slice(&1_940_000f32.to_le_bytes()); // 流通股本
+    data.extend_from_slice(&18u16.to_le_bytes()); // 省份
+    data.extend_from_slice(&1u16.to_le_bytes()); // 行业
+    data.extend_from_slice(&20240331u32.to_le_bytes()); // 更新日期
+    data.extend_from_slice(&19910403u32.to_le_bytes()); // 上市日期
+    for i in 0..30 {
+        data.extend_from_slice(&(i as f32).to_le_bytes());
+    }
+
+    let info = FinanceInfoMsg::decode_response(&data).unwrap();
+    assert_eq!(info.exchange, Exchange::SZ);
+    assert_eq!(info.code, "000001");
+    assert_eq!(info.float_shares, 1_940_000.0);
+    assert_eq!(info.ipo_date, 19910403);
+    assert_eq!(info.total_shares, 0.0);
+    assert_eq!(info.undistributed_profit, 27.0);
+    assert_eq!(info.ipo_time(), Some(670608000));
+
+    assert!(FinanceInfoMsg::decode_response(&data[..100]).is_err());
+}
+
+#[test]
+fn test_response_raw_bytes() {
+    for name in ["count", "quote", "trade_etf"] {
+        let bytes = load_test_data(name).unwrap().decode_response().unwrap();
+        let frame = ResponseFrame::decode(&bytes).unwrap();
+        assert_eq!(frame.raw_bytes(), bytes, "{}", name);
+    }
+}
+
+#[test]
+fn test_quote_decode_keyed_by_embedded_code() {
+    let response_bytes = load_test_data("quote").unwrap().decode_response().unwrap();
+    let response = ResponseFrame::decode(&response_bytes).unwrap();
+    let data = response.data();
+
+    // 去掉第一只股票，模拟服务器跳过了无效代码
+    let second = data.windows(7).position(|w| w == b"\x01600008").unwrap();
+    let mut partial = data[..2].to_vec();
+    partial.extend_from_slice(&1u16.to_le_bytes());
+    partial.extend_from_slice(&data[second..]);
+
+    let full = Quote::decode_response(data).unwrap();
+    let quotes = Quote::decode_response(&partial).unwrap();
+    assert_eq!(quotes.len(), 1);
+    assert_eq!(quotes[0].exchange, Exchange::SH);
+    assert_eq!(quotes[0].code, "600008");
+    assert_eq!(quotes[0].k.close, full[1].k.close);
+}
+
+#[test]
+fn test_code_formats() {
+    for input in ["sh688001", "SH688001", "688001.SH", "688001.SS"] {
+        assert_eq!(
+            parse_code_flexible(input).unwrap(),
+            (Exchange::SH, "688001".to_string()),
+            "{}",
+            input
+        );
+    }
+
+    assert_eq!(
+        format_code("000001.SZ", CodeStyle::Prefix).unwrap(),
+        "sz000001"
+    );
+    assert_eq!(
+        format_code("sh600000", CodeStyle::UpperPrefix).unwrap(),
+        "SH600000"
+    );
+    assert_eq!(
+        format_code("sh600000", CodeStyle::Suffix).unwrap(),
+        "600000.SH"
+    );
+    assert_eq!(
+        format_code("SH688001", CodeStyle::Yahoo).unwrap(),
+        "688001.SS"
+    );
+    assert_eq!(
+        format_code("bj920001", CodeStyle::Yahoo).unwrap(),
+        "920001.BJ"
+    );
+
+    assert!(matches!(
+        parse_code_flexible("688001"),
+        Err(MessageError::AmbiguousCode(_))
+    ));
+    assert!(parse_code_flexible("600000.HK").is_err());
+    assert!(parse_code_flexible("sh60000a").is_err());
+}
+
+#[test]
+fn test_session_expired_signature() {
+    let bytes = load_test_data("session_expired")
+        .unwrap()
+        .decode_response()
+        .unwrap();
+    let response = ResponseFrame::decode(&bytes).unwrap();
+    assert_eq!(response.control, CONTROL_ERROR);
+    assert!(!response.is_success());
+    assert!(response.is_session_expired());
+
+    // 正常响应和带数据的错误响应都不是会话过期
+    let mut bytes = load_test_data("count").unwrap().decode_response().unwrap();
+    assert!(!ResponseFrame::decode(&bytes).unwrap().is_session_expired());
+    bytes[4] = CONTROL_ERROR;
+    let response = ResponseFrame::decode(&bytes).unwrap();
+    assert!(!response.is_success());
+    assert!(!response.is_session_expired());
+}
+
+#[test]
+fn test_aggregate_ticks() {
+    let tick = |time: i64, price: i64, volume: i32, status: TradeStatus| Trade {
+        time,
+        price: Price(price),
+        volume,
+        status,
+        number: 1,
+    };
+    let ticks = vec![
+        tick(0, 10000, 5, TradeStatus::Buy),
+        tick(1, 10000, 3, TradeStatus::Buy),
+        tick(2, 10000, 2, TradeStatus::Sell), // 方向变化
+        tick(3, 10010, 4, TradeStatus::Sell), // 价格变化
+        tick(9, 10010, 1, TradeStatus::Sell), // 超出窗口
+    ];
+
+    let aggs = aggregate_ticks(&ticks, std::time::Duration::from_secs(5));
+    assert_eq!(aggs.len(), 4);
+    assert_eq!((aggs[0].volume, aggs[0].count), (8, 2));
+    assert_eq!((aggs[0].first_time, aggs[0].last_time), (0, 1));
+    assert_eq!(aggs[1].status, TradeStatus::Sell);
+    assert_eq!(aggs[2].price, Price(10010));
+    assert_eq!(aggs[3].first_time, 9);
+}
+
+#[test]
+fn test_trade_is_auction() {
+    // 2024-01-02 00:00 北京时间
+    let day = 1704124800;
+    let trade = |hour: i64, minute: i64| Trade {
+        time: day + hour * 3600 + minute * 60,
+        price: Price(10000),
+        volume: 1,
+        status: TradeStatus::Neutral,
+        number: 1,
+    };
+    assert!(trade(9, 25).is_auction());
+    assert!(trade(9, 29).is_auction());
+    assert!(!trade(9, 30).is_auction());
+    assert!(!trade(14, 56).is_auction());
+    assert!(trade(14, 57).is_auction());
+    assert!(trade(15, 0).is_auction());
+}
+
+#[test]
+fn test_price_decimal() {
+    assert_eq!(Price(12340).decimal_parts(), (12340, 3));
+    assert_eq!(Price(12340).to_decimal_string(), "12.340");
+    assert_eq!(Price(-5).to_decimal_string(), "-0.005");
+    assert_eq!(Price(0).to_decimal_string(), "0.000");
+}
+
+#[test]
+fn test_market_rules() {
+    let main = market_rules("sh600000").unwrap();
+    assert_eq!(main.board, Board::Main);
+    assert_eq!(main.price_tick, Price(10));
+    assert!(main.is_valid_quantity(300));
+    assert!(!main.is_valid_quantity(150));
+
+    let star = market_rules("sh688001").unwrap();
+    assert_eq!(star.board, Board::Star);
+    assert!(star.is_valid_quantity(201));
+    assert!(!star.is_valid_quantity(100));
+
+    assert_eq!(market_rules("sz300750").unwrap().board, Board::ChiNext);
+    assert_eq!(market_rules("bj920001").unwrap().board, Board::Bj);
+
+    let fund = market_rules("sh510300").unwrap();
+    assert_eq!(fund.board, Board::Fund);
+    assert_eq!(fund.round_price(Price(3912)), Price(3912));
+    assert_eq!(main.round_price(Price(12345)), Price(12350));
+    assert_eq!(main.round_price(Price(12344)), Price(12340));
+
+    // 指数不可交易
+    assert!(market_rules("sh000001").is_err());
+}
+
+#[test]
+fn test_custom_decompressor() {
+    // 压缩长度2、解压长度4，自定义解压函数把每个字节重复两次
+    let mut frame = ResponseFrame::new(
+        PREFIX_RESP,
+        0x1C,
+        1,
+        0,
+        MessageType::Count,
+        2,
+        4,
+        vec![0xC8, 0x01],
+    );
+    frame
+        .decompress_with(|data, length| {
+            assert_eq!(length, 4);
+            Ok(data.iter().flat_map(|&b| [b, b]).collect())
+        })
+        .unwrap();
+    assert_eq!(frame.data(), &[0xC8, 0xC8, 0x01, 0x01]);
+    assert_eq!(frame.raw_bytes()[16..], [0xC8, 0x01]);
+
+    // 解压长度不符仍然报错
+    let mut frame = ResponseFrame::new(
+        PREFIX_RESP,
+        0x1C,
+        1,
+        0,
+        MessageType::Count,
+        2,
+        4,
+        vec![0xC8, 0x01],
+    );
+    assert!(matches!(
+        frame.decompress_with(|data, _| Ok(data.to_vec())),
+        Err(FrameError::LengthMismatch)
+    ));
+}
+
+#[test]
+fn test_adjusted_change() {
+    let mut quote = load_quotes().remove(0);
+    quote.k.last = Price::from_yuan(20.0);
+    quote.k.close = Price::from_yuan(10.2);
+
+    // 10送10派5元：除权参考价 (20 - 0.5) / 2 = 9.75
+    let xdxr = Gbbq {
+        code: "sz000001".to_string(),
+        time: 0,
+        category: 1,
+        c1: 5.0,
+        c2: 0.0,
+        c3: 10.0,
+        c4: 0.0,
+    };
+    assert_eq!(xdxr.ex_right_price(quote.k.last), Price(9750));
+
+    let raw = adjusted_change(&quote, None);
+    assert!((raw - (-0.49)).abs() < 1e-9);
+    let adjusted = adjusted_change(&quote, Some(&xdxr));
+    assert!((adjusted - (0.45 / 9.75)).abs() < 1e-9);
+}
+
+#[test]
+fn test_trading_session() {
+    use chrono::{FixedOffset, TimeZone};
+    use std::collections::HashSet;
+
+    let bj = FixedOffset::east_opt(8 * 3600).unwrap();
+    let at = |y, m, d, h, min| bj.with_ymd_and_hms(y, m, d, h, min, 0).unwrap().timestamp();
+    let none = HashSet::new();
+
+    // 2024-01-05 周五
+    assert!(is_trading_time(at(2024, 1, 5, 10, 0), false, &none));
+    assert!(!is_trading_time(at(2024, 1, 5, 12, 0), false, &none));
+    assert!(is_trading_time(at(2024, 1, 5, 12, 0), true, &none));
+    assert!(!is_trading_time(at(2024, 1, 5, 15, 0), false, &none));
+
+    // 午间休市恢复到13:00，收盘后跳过周末到周一09:15
+    assert_eq!(
+        next_trading_time(at(2024, 1, 5, 12, 0), false, &none),
+        Some(at(2024, 1, 5, 13, 0))
+    );
+    assert_eq!(
+        next_trading_time(at(2024, 1, 5, 16, 0), false, &none),
+        Some(at(2024, 1, 8, 9, 15))
+    );
+
+    // 2024-01-01 元旦休市
+    let derived = holidays_from_trading_days(&[20231229, 20240102, 20240103]);
+    assert_eq!(derived, [20240101].into_iter().collect());
+
+    // 节假日由调用方提供
+    let holidays: HashSet<u32> = [20240108].into_iter().collect();
+    assert_eq!(
+        next_trading_time(at(2024, 1, 5, 16, 0), false, &holidays),
+        Some(at(2024, 1, 9, 9, 15))
+    );
+}
+
+#[test]
+fn test_price_limits_st() {
+    assert!(is_st_name("*ST金泰"));
+    assert!(is_st_name("ST曙光"));
+    assert!(!is_st_name("浦发银行"));
+    assert!(is_delisted_name("*ST西发退"));
+    assert!(!is_delisted_name("*ST金泰"));
+
+    // 主板 10%
+    let (up, down) = price_limits("sh600000", "浦发银行", Price::from_yuan(10.0)).unwrap();
+    assert_eq!((up, down), (Price(11000), Price(9000)));
+
+    // 主板风险警示 5%：3.33 × 1.05 = 3.4965 → 3.50，3.33 × 0.95 = 3.1635 → 3.16
+    let (up, down) = price_limits("sh600385", "*ST金泰", Price(3330)).unwrap();
+    assert_eq!((up, down), (Price(3500), Price(3160)));
+
+    // 创业板风险警示仍为 20%
+    let (up, down) = price_limits("sz300001", "*ST特锐", Price::from_yuan(10.0)).unwrap();
+    assert_eq!((up, down), (Price(12000), Price(8000)));
+}
+
+#[test]
+fn test_call_auction_reference_price() {
+    // 1条快照：09:20:30 虚拟开盘价10.2，匹配1000，未匹配卖单50
+    let mut data = 1u16.to_le_bytes().to_vec();
+    data.extend_from_slice(&(9u16 * 60 + 20).to_le_bytes());
+    data.extend_from_slice(&10.2f32.to_le_bytes());
+    data.extend_from_slice(&1000u32.to_le_bytes());
+    data.extend_from_slice(&(-50i16).to_le_bytes());
+    data.extend_from_slice(&[0, 0, 0, 30]);
+    let resp = CallAuctionMsg::decode_response(&data).unwrap();
+
+    let snapshot = &resp.list[0];
+    assert_eq!(snapshot.reference_price(), Price(10200));
+    assert_eq!(snapshot.matchable_volume(), 1000);
+    assert_eq!((snapshot.unmatched, snapshot.flag), (50, -1));
+    assert!((snapshot.gap(Price(10000)) - 0.02).abs() < 1e-9);
+    assert_eq!(snapshot.gap(Price(0)), 0.0);
+}
+
+#[test]
+fn test_price_scale_shared_by_decoders() {
+    assert!(is_bond("sh113050"));
+    assert!(is_bond("sz123001"));
+    assert!(!is_bond("sz000001"));
+    assert!(!is_bond("sh600008"));
+
+    for (code, scale) in [
+        ("sz000001", 10),
+        ("sh000001", 10),
+        ("sh510300", 1),
+        ("sz161725", 1),
+        ("sh113050", 1),
+        ("sz123001", 1),
+    ] {
+        assert_eq!(price_scale(code), scale, "{}", code);
+
+        // 同一价格差值在行情、分时和分笔成交中换算出相同的厘值
+        let diff = 3912;
+        let mut quote = vec![0, 0, 1, 0, code[..2].eq("sh") as u8];
+        quote.extend_from_slice(code[2..].as_bytes());
+        quote.extend_from_slice(&[0, 0]);
+        quote.extend_from_slice(&encode_varint(diff));
+        quote.extend_from_slice(&[0; 4]); // 其余4个价格差值
+        quote.extend_from_slice(&[0; 4]); // 服务器时间、保留字段、总手、现量
+        quote.extend_from_slice(&[0; 4]); // 成交额
+        quote.extend_from_slice(&[0; 4]); // 内盘、外盘、2个保留字段
+        quote.extend_from_slice(&[0; 20]); // 5档买卖价差和数量
+        quote.extend_from_slice(&[0; 2 + 4 + 2 + 2]); // 保留字段、涨速、活跃度
+        let quote = Quote::decode_response(&quote).unwrap().remove(0);
+
+        let mut minute = vec![1, 0, 0, 0, 0, 0];
+        for value in [diff, 0, 1] {
+            minute.extend_from_slice(&encode_varint(value));
+        }
+        let minute = MinuteMsg::decode_response(&minute, "20240102", code).unwrap();
+
+        let mut trade = vec![1, 0];
+        trade.extend_from_slice(&(9 * 60 + 30u16).to_le_bytes());
+        for value in [diff, 1, 1, 0, 0] {
+            trade.extend_from_slice(&encode_varint(value));
+        }
+        let cache = TradeCache {
+            date: "20240102".to_string(),
+            code: code.to_string(),
+        };
+        let trade = TradeMsg::decode_response(&trade, &cache).unwrap();
+
+        let expected = diff as i64 * scale;
+        assert_eq!(quote.k.close.0, expected, "{}", code);
+        assert_eq!(minute.list[0].price.0, expected, "{}", code);
+        assert_eq!(trade.list[0].price.0, expected, "{}", code);
+        let convention = if is_bond(code) {
+            PriceConvention::PerHundredFace
+        } else {
+            PriceConvention::PerShare
+        };
+        assert_eq!(quote.price_convention, convention);
+    }
+}
+
+#[test]
+fn test_connect_version_mismatch() {
+    // 正常的握手响应
+    let test_data = load_test_data("connect").unwrap();
+    let response = ResponseFrame::decode(&test_data.decode_response().unwrap()).unwrap();
+    assert!(Connect::decode_response(&response.data).is_ok());
+
+    let mut data = vec![0u8; 4];
+    data.extend_from_slice(&utf8_to_gbk("客户端版本过低,请升级到7.65版本"));
+    data.push(0);
+    match Connect::decode_response(&data) {
+        Err(MessageError::VersionMismatch { required, message }) => {
+            assert_eq!(required.as_deref(), Some("7.65"));
+            assert_eq!(message, "客户端版本过低,请升级到7.65版本");
+        }
+        other => panic!("应返回版本不匹配: {:?}", other),
+    }
+
+    let err = tdx_rust::ClientError::from(
+        Connect::decode_response(&utf8_to_gbk("版本不匹配")).unwrap_err(),
+    );
+    assert!(err.is_protocol());
+
+    // 结构完整的正常响应即使服务器信息中含有关键词也不视为拒绝
+    let mut data = response.data.clone();
+    data.truncate(68);
+    data.extend_from_slice(&utf8_to_gbk("上海双线主站 请升级到最新版本以获得更好体验"));
+    let info = Connect::decode_response(&data).unwrap();
+    assert!(info.contains("请升级"));
+
+    // 不足68字节且没有拒绝提示
+    assert!(matches!(
+        Connect::decode_response(&[0u8; 10]),
+        Err(MessageError::InsufficientData)
+    ));
+}
+
+#[test]
+fn test_decode_batch_keeps_order() {
+    let mut frames = Vec::new();
+    for name in ["connect", "count", "quote", "heartbeat"] {
+        frames.push(load_test_data(name).unwrap().decode_response().unwrap());
+    }
+    frames.insert(2, vec![0u8; 8]);
+    let frames: Vec<Vec<u8>> = frames.iter().cycle().take(50).cloned().collect();
+
+    let serial = decode_batch(&frames, 1);
+    let parallel = decode_batch(&frames, 4);
+    assert_eq!(parallel.len(), frames.len());
+    for (s, p) in serial.iter().zip(&parallel) {
+        match (s, p) {
+            (Ok(s), Ok(p)) => {
+                assert_eq!(s.msg_type, p.msg_type);
+                assert_eq!(s.data, p.data);
+            }
+            (Err(_), Err(_)) => {}
+            _ => panic!("并行解码结果与顺序解码不一致"),
+        }
+    }
+    // 单帧出错不影响其余帧
+    assert!(parallel[2].is_err());
+    assert_eq!(parallel.iter().filter(|r| r.is_ok()).count(), 40);
+}
+
+#[test]
+fn test_quote_amount_beyond_32_bits() {
+    let test_data = load_test_data("quote").unwrap();
+    let response = ResponseFrame::decode(&test_data.decode_response().unwrap()).unwrap();
+    let amount = Quote::decode_response(&response.data).unwrap()[0].amount;
+    // 第一只股票成交额字段的位置
+    let pos = response
+        .data
+        .windows(4)
+        .position(|w| Price((decode_volume2(w) * 1000.0) as i64) == amount)
+        .unwrap();
+
+    // 编码同 K 线成交额：3*2^30 元（超过 2^31）、2^35 元（超过 2^32）
+    for (bytes, yuan) in [([0, 0, 0x40, 79], 3i64 << 30), ([0, 0, 0, 81], 1 << 35)] {
+        let mut data = response.data.clone();
+        data[pos..pos + 4].copy_from_slice(&bytes);
+        let quote = Quote::decode_response(&data).unwrap().remove(0);
+        assert_eq!(quote.amount, Price(yuan * 1000));
+        assert_eq!(DailyOhlc::from(&quote).amount, quote.amount);
+
+        let breadth = market_breadth(&[quote.clone(), quote.clone()]);
+        assert_eq!(breadth.amount, Price(yuan * 2000));
+        let mut next = quote.clone();
+        next.total_hand += 1;
+        next.amount = Price(quote.amount.0 * 2);
+        assert_eq!(quote_flow(&quote, &next).amount_delta, quote.amount);
+    }
+}
+
+#[test]
+fn test_quote_avg_price() {
+    let mut quote = load_quotes().remove(0);
+
+    quote.total_hand = 2000;
+    quote.amount = Price::from_yuan(2_468_000.0);
+    assert_eq!(quote.avg_price(), Some(Price(12340)));
+
+    quote.price_convention = PriceConvention::PerHundredFace;
+    assert_eq!(quote.avg_price(), Some(Price(123400)));
+
+    quote.total_hand = 0;
+    assert_eq!(quote.avg_price(), None);
+}
+
+#[test]
+fn test_gbbq_unknown_category() {
+    let record = |category: u8, fields: [f32; 4]| {
+        let mut r = vec![0u8];
+        r.extend_from_slice(b"000001");
+        r.push(0);
+        r.extend_from_slice(&20240612u32.to_le_bytes());
+        r.push(category);
+        for f in fields {
+            r.extend_from_slice(&f.to_le_bytes());
+        }
+        r
+    };
+    let mut data = vec![0u8; 9];
+    data.extend_from_slice(&2u16.to_le_bytes());
+    data.extend(record(1, [2.5, 0.0, 3.0, 0.0]));
+    data.extend(record(99, [1.0, 2.0, 3.0, 4.0]));
+
+    let resp = GbbqMsg::decode_response(&data).unwrap();
+    assert_eq!(resp.count, 2);
+    assert_eq!(resp.list.len(), 1);
+    assert_eq!(resp.list[0].c1, 2.5);
+    assert_eq!(resp.list[0].c3, 3.0);
+
+    assert_eq!(resp.unknown.len(), 1);
+    let unknown = &resp.unknown[0];
+    assert_eq!(unknown.code, "sz000001");
+    assert_eq!(unknown.category, 99);
+    assert_eq!(unknown.raw[12..16], 4.0f32.to_le_bytes());
+}
+
+#[test]
+fn test_server_time_of_day() {
+    // 14:30 + 0.5分钟
+    assert_eq!(
+        server_time_of_day("14305000"),
+        Some(14 * 3600 + 30 * 60 + 30)
+    );
+    // 偏移前两位不小于60时按小时的百万分之一：0.75小时 = 45分
+    assert_eq!(server_time_of_day("9750000"), Some(9 * 3600 + 45 * 60));
+    assert_eq!(server_time_of_day("0"), Some(0));
+    assert_eq!(server_time_of_day("25000000"), None);
+    assert_eq!(server_time_of_day(""), None);
+
+    // 抓包样本中两只股票的行情时间相差几秒
+    let quotes = load_quotes();
+    let times: Vec<_> = quotes.iter().map(|q| q.server_time.as_str()).collect();
+    assert_eq!(times, ["13252999", "13253581"]);
+    assert_eq!(server_time_of_day(times[0]), Some(13 * 3600 + 25 * 60 + 17));
+    assert_eq!(server_time_of_day(times[1]), Some(13 * 3600 + 25 * 60 + 21));
+}
+
+#[test]
+fn test_ambiguous_code_rejected() {
+    // 000001 既是平安银行（深圳）也是上证指数（上海）
+    assert!(is_ambiguous_code("000001"));
+    assert!(matches!(
+        qualify_code("000001"),
+        Err(MessageError::AmbiguousCode(_))
+    ));
+    assert!(matches!(
+        KlineMsg::request(1, KlineType::Day, "000001", 0, 10),
+        Err(MessageError::AmbiguousCode(_))
+    ));
+
+    // 带前缀的代码正常
+    assert_eq!(
+        decode_code("sh000001").unwrap(),
+        (Exchange::SH, "000001".to_string())
+    );
+    assert_eq!(
+        decode_code("sz000001").unwrap(),
+        (Exchange::SZ, "000001".to_string())
+    );
+    assert_eq!(qualify_code("SH600000").unwrap(), "sh600000");
+
+    // 不带前缀的6位代码一律拒绝，即使数字本身只对应一个市场
+    for code in ["600000", "399001", "300750", "510300"] {
+        assert!(matches!(
+            qualify_code(code),
+            Err(MessageError::AmbiguousCode(_))
+        ));
+    }
+}
+
+#[test]
+fn test_normalize_levels_best_first() {
+    let level = |buy: bool, price: i64, number: i32| PriceLevel {
+        buy,
+        price: Price(price),
+        number,
+    };
+
+    // 卖盘按价格从高到低返回时，整理后第0档为最低卖价
+    let mut sell = [
+        level(false, 10050, 5),
+        level(false, 10040, 4),
+        level(false, 10030, 3),
+        level(false, 10020, 2),
+        level(false, 10010, 1),
+    ];
+    normalize_levels(&mut sell);
+    let prices: Vec<i64> = sell.iter().map(|l| l.price.0).collect();
+    assert_eq!(prices, [10010, 10020, 10030, 10040, 10050]);
+    assert_eq!(sell[0].number, 1);
+
+    // 买盘第0档为最高买价，空档位排在最后
+    let mut buy = [
+        level(true, 0, 0),
+        level(true, 9990, 3),
+        level(true, 10000, 1),
+        level(true, 9980, 0),
+        level(true, 9970, 7),
+    ];
+    normalize_levels(&mut buy);
+    let prices: Vec<i64> = buy.iter().map(|l| l.price.0).collect();
+    assert_eq!(prices, [10000, 9990, 9970, 0, 9980]);
+
+    // 真实行情解码后同样满足该约定
+    for q in load_quotes() {
+        assert!(q
+            .buy_level
+            .windows(2)
+            .all(|w| w[1].number == 0 || w[0].price >= w[1].price));
+        assert!(q
+            .sell_level
+            .windows(2)
+            .all(|w| w[1].number == 0 || w[0].price <= w[1].price));
+    }
+}
+
+#[test]
+fn test_message_type_from_type_value() {
+    assert_eq!(
+        MessageType::from_type_value("0x000D"),
+        Some(MessageType::Connect)
+    );
+    assert_eq!(
+        MessageType::from_type_value("0x052d"),
+        Some(MessageType::Kline)
+    );
+    assert_eq!(
+        MessageType::from_type_value(" 044E "),
+        Some(MessageType::Count)
+    );
+    assert_eq!(MessageType::from_type_value("0xFFFF"), None);
+    assert_eq!(MessageType::from_type_value("connect"), None);
+
+    // 每个测试数据的 type_value 都对应已知的消息类型，且与请求帧一致
+    for entry in fs::read_dir("tdx-test/test-data").unwrap() {
+        let path = entry.unwrap().path();
+        // index.json 是测试数据目录，不是单个接口的数据；notice.json 是服务器推送，类型不在已知类型中
+        if path.extension().map_or(true, |ext| ext != "json")
+            || path.ends_with("index.json")
+            || path.ends_with("notice.json")
+        {
+            continue;
+        }
+        let test_data: TestData =
+            serde_json::from_str(&fs::read_to_string(&path).unwrap()).unwrap();
+        let msg_type = test_data
+            .message_type()
+            .unwrap_or_else(|| panic!("{:?}: 未知的 type_value {}", path, test_data.type_value));
+        let request = test_data.decode_request().unwrap();
+        if let Ok(frame) = RequestFrame::decode(&request) {
+            assert_eq!(frame.msg_type, msg_type, "{:?}", path);
+        }
+    }
+}
+
+#[test]
+fn test_market_breadth() {
+    let base = load_quotes().remove(0);
+    let quote = |close: i64, last: i64, halted: bool| {
+        let mut q = base.clone();
+        q.k.close = Price(close);
+        q.k.last = Price(last);
+        q.total_hand = if halted { 0 } else { 100 };
+        q.amount = Price::from_yuan(if halted { 0.0 } else { 1000.0 });
+        if halted {
+            q.k.open = Price(0);
+        }
+        q
+    };
+
+    let quotes = [
+        quote(10100, 10000, false),
+        quote(10200, 10000, false),
+        quote(9900, 10000, false),
+        quote(10000, 10000, false),
+        quote(10000, 10000, true),
+        quote(10000, 0, false),
+    ];
+    let breadth = market_breadth(&quotes);
+    assert_eq!(breadth.advancing, 2);
+    assert_eq!(breadth.declining, 1);
+    assert_eq!(breadth.unchanged, 1);
+    assert_eq!(breadth.halted, 1);
+    assert_eq!(breadth.total(), 4);
+    assert_eq!(breadth.volume, 400);
+    assert_eq!(breadth.amount, Price::from_yuan(4000.0));
+}
+
+#[test]
+fn test_decode_preallocates_declared_count() {
+    // 3根日K线
+    let mut data = 3u16.to_le_bytes().to_vec();
+    for date in [20240102u32, 20240103, 20240104] {
+        data.extend_from_slice(&date.to_le_bytes());
+        for diff in [10000, 100, 200, -100] {
+            data.extend_from_slice(&encode_varint(diff));
+        }
+        data.extend_from_slice(&[0u8; 8]);
+    }
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+    let klines = KlineMsg::decode_response(&data, cache).unwrap();
+    assert_eq!(klines.list.len(), 3);
+    assert!(klines.list.capacity() >= 3);
+
+    // 声明数量远大于数据时按数据长度预分配，并报告数量不一致
+    let mut bogus = data.clone();
+    bogus[..2].copy_from_slice(&u16::MAX.to_le_bytes());
+    let mut list = Vec::new();
+    let err = KlineMsg::decode_response_into(&bogus, cache, &mut list).unwrap_err();
+    assert!(matches!(
+        err,
+        MessageError::CountMismatch {
+            declared: 65535,
+            decoded: 3
+        }
+    ));
+    assert!(list.capacity() < 65535);
+
+    // 2只股票代码
+    let mut data = 2u16.to_le_bytes().to_vec();
+    for code in [b"600000", b"600004"] {
+        let mut record = [0u8; 29];
+        record[..6].copy_from_slice(code);
+        data.extend_from_slice(&record);
+    }
+    let codes = Code::decode_response(&data).unwrap();
+    assert_eq!(codes.codes.len(), 2);
+    assert_eq!(codes.codes.capacity(), 2);
+}
+
+#[test]
+fn test_next_session_boundary() {
+    use chrono::{FixedOffset, TimeZone};
+    use std::collections::HashSet;
+
+    let bj = FixedOffset::east_opt(8 * 3600).unwrap();
+    let at = |y, m, d, h, min| bj.with_ymd_and_hms(y, m, d, h, min, 0).unwrap().timestamp();
+    let none = HashSet::new();
+
+    // 2024-01-05 周五：开盘前到09:15，盘中到15:00，收盘时刻之后跳过周末
+    let next = |now| next_session_boundary(now, &SESSION_BOUNDARIES, &none);
+    assert_eq!(next(at(2024, 1, 5, 8, 0)), Some(at(2024, 1, 5, 9, 15)));
+    assert_eq!(next(at(2024, 1, 5, 10, 0)), Some(at(2024, 1, 5, 15, 0)));
+    assert_eq!(next(at(2024, 1, 5, 15, 0)), Some(at(2024, 1, 8, 9, 15)));
+
+    // 自定义边界（09:30 连续竞价开始），顺序无关
+    let boundaries = [15 * 60, 9 * 60 + 30];
+    let holidays: HashSet<u32> = [20240108].into_iter().collect();
+    assert_eq!(
+        next_session_boundary(at(2024, 1, 5, 16, 0), &boundaries, &holidays),
+        Some(at(2024, 1, 9, 9, 30))
+    );
+    assert_eq!(
+        next_session_boundary(at(2024, 1, 5, 16, 0), &[], &none),
+        None
+    );
+}
+
+#[test]
+fn test_empty_and_truncated_responses() {
+    let cache = KlineCache::new(KlineType::Day, "sz000001");
+    let trade_cache = TradeCache {
+        date: "20240102".to_string(),
+        code: "sh510300".to_string(),
+    };
+
+    // 数量为0的完整响应返回空列表
+    assert!(Code::decode_response(&[0, 0]).unwrap().codes.is_empty());
+    assert!(Quote::decode_response(&[0, 0, 0, 0]).unwrap().is_empty());
+    assert!(KlineMsg::decode_response(&[0, 0], cache)
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(MinuteMsg::decode_response(&[0; 6], "20240102", "sz000001")
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(TradeMsg::decode_response(&[0, 0], &trade_cache)
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(HistoryTradeMsg::decode_response(&[0; 6], &trade_cache)
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(CallAuctionMsg::decode_response(&[0, 0])
+        .unwrap()
+        .list
+        .is_empty());
+    assert!(GbbqMsg::decode_response(&[0; 11]).unwrap().list.is_empty());
+    assert!(BlockMsg::decode_response(&[0; 4]).unwrap().is_empty());
+
+    // 空数据返回错误
+    assert!(Code::decode_response(&[]).is_err());
+    assert!(Quote::decode_response(&[]).is_err());
+    assert!(KlineMsg::decode_response(&[], cache).is_err());
+    assert!(MinuteMsg::decode_response(&[], "20240102", "sz000001").is_err());
+    assert!(TradeMsg::decode_response(&[], &trade_cache).is_err());
+    assert!(HistoryTradeMsg::decode_response(&[], &trade_cache).is_err());
+    assert!(CallAuctionMsg::decode_response(&[]).is_err());
+    assert!(GbbqMsg::decode_response(&[]).is_err());
+    assert!(FinanceInfoMsg::decode_response(&[]).is_err());
+    assert!(BlockMsg::decode_meta_response(&[]).is_err());
+    assert!(BlockMsg::decode_response(&[]).is_err());
+
+    // 任意位置截断都返回错误而不是 panic
+    let frame = |name: &str| {
+        let bytes = load_test_data(name).unwrap().decode_response().unwrap();
+        ResponseFrame::decode(&bytes).unwrap().data().to_vec()
+    };
+    let quote = frame("quote");
+    for len in 0..quote.len() {
+        assert!(
+            Quote::decode_response(&quote[..len]).is_err(),
+            "quote {}",
+            len
+        );
+    }
+    let trade = frame("trade_etf");
+    for len in 0..trade.len() {
+        assert!(
+            TradeMsg::decode_response(&trade[..len], &trade_cache).is_err(),
+            "trade {}",
+            len
+        );
+    }
+
+    let mut minute = vec![2, 0, 0, 0, 0, 0];
+    for value in [3912, 0, 1200, -2, 0, 300] {
+        minute.extend_from_slice(&encode_varint(value));
+    }
+    assert_eq!(
+        MinuteMsg::decode_response(&minute, "20240102", "sz000001")
+            .unwrap()
+            .list
+            .len(),
+        2
+    );
+    for len in 0..minute.len() {
+        assert!(
+            MinuteMsg::decode_response(&minute[..len], "20240102", "sz000001").is_err(),
+            "minute {}",
+            len
+        );
+    }
+
+    // 未匹配量为 i16::MIN 时不溢出
+    let mut auction = vec![1, 0];
+    auction.extend_from_slice(&(9 * 60 + 20u16).to_le_bytes());
+    auction.extend_from_slice(&10.5f32.to_le_bytes());
+    auction.extend_from_slice(&1000u32.to_le_bytes());
+    auction.extend_from_slice(&i16::MIN.to_le_bytes());
+    auction.extend_from_slice(&[0, 0, 0, 30]);
+    let list = CallAuctionMsg::decode_response(&auction).unwrap().list;
+    assert_eq!(list[0].unmatched, 32768);
+    assert_eq!(list[0].flag, -1);
+    for len in 0..auction.len() {
+        assert!(
+            CallAuctionMsg::decode_response(&auction[..len]).is_err(),
+            "auction {}",
+            len
+        );
+    }
+
+    let mut block = 8u32.to_le_bytes().to_vec();
+    block.extend_from_slice(&[1; 8]);
+    assert_eq!(BlockMsg::decode_response(&block).unwrap().len(), 8);
+    assert!(BlockMsg::decode_response(&block[..10]).is_err());
+}
+
+#[test]
+fn test_kline_volume_units_per_type() {
+    // sz000001 日K线样本：首根原始成交量 1914493（手），成交额 2301340928000 厘
+    let data = load_test_data("kline")
+        .unwrap()
+        .decode_response_data()
+        .unwrap()
+        .unwrap();
+    let first = |cache: KlineCache, data: &[u8]| {
+        KlineMsg::decode_response(data, cache)
+            .unwrap()
+            .list
+            .remove(0)
+    };
+
+    let day = first(KlineCache::new(KlineType::Day, "sz000001"), &data);
+    assert_eq!(day.volume, 191_449_300);
+    assert_eq!(day.volume_lots("sz000001"), 1_914_493);
+    // 成交均价应落在当根K线的价格区间内，说明单位换算正确
+    let average = day.amount.as_i64() / day.volume;
+    assert!(day.low.as_i64() <= average && average <= day.high.as_i64());
+
+    let cases = [
+        (KlineType::Minute5, 1_914_493),
+        (KlineType::Minute15, 1_914_493),
+        (KlineType::Minute30, 1_914_493),
+        (KlineType::Minute60, 1_914_493),
+        (KlineType::Day2, 1_914_493),
+        (KlineType::Week, 191_449_300),
+        (KlineType::Month, 191_449_300),
+        (KlineType::Minute, 1_914_493),
+        (KlineType::Minute2, 1_914_493),
+        (KlineType::Day, 191_449_300),
+        (KlineType::Quarter, 191_449_300),
+        (KlineType::Year, 191_449_300),
+    ];
+    for (kline_type, volume) in cases {
+        let stock = first(KlineCache::new(kline_type, "sz000001"), &data);
+        assert_eq!(stock.volume, volume, "{:?}", kline_type);
+
+        // 可转债1手=10张
+        let bond = first(KlineCache::new(kline_type, "sz123001"), &data);
+        assert_eq!(bond.volume, volume / 10, "{:?}", kline_type);
+
+        // 指数额外乘以100；只解码首根，其后4字节被当作上涨/下跌数量
+        let mut single = data.clone();
+        single[..2].copy_from_slice(&1u16.to_le_bytes());
+        let index = first(KlineCache::new(kline_type, "sh000001"), &single);
+        assert_eq!(index.volume, volume * 100, "{:?}", kline_type);
+    }
+}